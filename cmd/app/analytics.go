@@ -0,0 +1,143 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/KarrenAeris/crud/pkg/analytics"
+)
+
+// наибольший размер топа товаров
+const maxTopLimit = 100
+
+func (s *Server) handleManagerGetRevenue(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	from, to, err := reportPeriod(r)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	bucket := r.URL.Query().Get("bucket")
+	if bucket == "" {
+		bucket = analytics.BucketDay
+	}
+
+	items, err := s.analyticsSvc.Revenue(r.Context(), from, to, bucket)
+	if errors.Is(err, analytics.ErrInvalidBucket) {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, r, items)
+}
+
+func (s *Server) handleManagerGetTopProducts(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	from, to, err := reportPeriod(r)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	by := r.URL.Query().Get("by")
+	if by == "" {
+		by = analytics.ByRevenue
+	}
+
+	limit := 10
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxTopLimit {
+			//вызываем фукцию для ответа с ошибкой
+			errorWriter(w, r, http.StatusBadRequest, errors.New("invalid limit"))
+			return
+		}
+	}
+
+	items, err := s.analyticsSvc.TopProducts(r.Context(), from, to, by, limit)
+	if errors.Is(err, analytics.ErrInvalidOrder) {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, r, items)
+}
+
+func (s *Server) handleManagerGetBasket(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	from, to, err := reportPeriod(r)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	item, err := s.analyticsSvc.Basket(r.Context(), from, to)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, r, item)
+}
+
+func (s *Server) handleManagerGetCustomerStats(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	item, err := s.analyticsSvc.Customers(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, r, item)
+}
+
+func (s *Server) handleManagerRefreshAnalytics(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	var err error
+	if r.URL.Query().Get("full") == "true" {
+		err = s.analyticsSvc.Rebuild(r.Context())
+	} else {
+		err = s.analyticsSvc.Refresh(r.Context())
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, r, map[string]interface{}{"status": "ok"})
+}
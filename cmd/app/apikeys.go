@@ -0,0 +1,112 @@
+package app
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/KarrenAeris/crud/pkg/apikeys"
+	"github.com/KarrenAeris/crud/pkg/types"
+	"github.com/KarrenAeris/crud/pkg/validation"
+)
+
+// apiKeyScopes - области доступа ключей API по маршрутам (метод и шаблон пути), остальные маршруты ключам недоступны
+var apiKeyScopes = map[string]string{
+	"GET /api/managers/products":                apikeys.ScopeProductsRead,
+	"POST /api/managers/products":               apikeys.ScopeProductsWrite,
+	"DELETE /api/managers/products/{id:[0-9]+}": apikeys.ScopeProductsWrite,
+}
+
+// apiKeyScope возвращает область доступа, нужную для маршрута запроса
+func apiKeyScope(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return ""
+	}
+	path, err := route.GetPathTemplate()
+	if err != nil {
+		return ""
+	}
+	return apiKeyScopes[r.Method+" "+path]
+}
+
+func (s *Server) handleManagerGetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	items, err := s.apiKeySvc.All(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, r, items)
+}
+
+func (s *Server) handleManagerCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.adminID(w, r)
+	if !ok {
+		return
+	}
+
+	var item struct {
+		Name   string    `json:"name" validate:"required,max=255"`
+		Scopes []string  `json:"scopes" validate:"required"`
+		Expire time.Time `json:"expire" validate:"required"`
+	}
+	if !s.decodeJSON(w, r, &item) {
+		return
+	}
+
+	key, created, err := s.apiKeySvc.Create(r.Context(), id, item.Name, item.Scopes, item.Expire)
+	switch err {
+	case nil:
+	case apikeys.ErrUnknownScope:
+		errs := validation.Errors{"scopes": "must be one of: " + strings.Join(apikeys.Scopes, ", ")}
+		respondJSONWithCode(w, r, http.StatusUnprocessableEntity, map[string]interface{}{"errors": errs})
+		return
+	case apikeys.ErrInvalidExpire:
+		errs := validation.Errors{"expire": "must be in the future"}
+		respondJSONWithCode(w, r, http.StatusUnprocessableEntity, map[string]interface{}{"errors": errs})
+		return
+	default:
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	// сам ключ отдаётся только здесь, в БД хранится лишь его хеш
+	respondJSON(w, r, map[string]interface{}{"key": key, "api_key": created})
+}
+
+func (s *Server) handleManagerRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	keyID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	item, err := s.apiKeySvc.Revoke(r.Context(), keyID)
+	if err == types.ErrNotFound {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, r, item)
+}
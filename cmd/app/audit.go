@@ -0,0 +1,79 @@
+package app
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/KarrenAeris/crud/pkg/types"
+)
+
+func (s *Server) handleManagerGetAudit(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	filter := &types.AuditFilter{
+		ActorType: query.Get("actor_type"),
+		Action:    query.Get("action"),
+		Entity:    query.Get("entity"),
+	}
+
+	var err error
+	ints := []struct {
+		name  string
+		value *int64
+	}{{"actor_id", &filter.ActorID}, {"entity_id", &filter.EntityID}}
+	for _, param := range ints {
+		if value := query.Get(param.name); value != "" {
+			*param.value, err = strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				//вызываем фукцию для ответа с ошибкой
+				errorWriter(w, r, http.StatusBadRequest, err)
+				return
+			}
+		}
+	}
+
+	if value := query.Get("limit"); value != "" {
+		if filter.Limit, err = strconv.Atoi(value); err != nil {
+			//вызываем фукцию для ответа с ошибкой
+			errorWriter(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if value := query.Get("offset"); value != "" {
+		if filter.Offset, err = strconv.Atoi(value); err != nil {
+			//вызываем фукцию для ответа с ошибкой
+			errorWriter(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	if value := query.Get("from"); value != "" {
+		if filter.From, err = time.Parse(reportDateLayout, value); err != nil {
+			//вызываем фукцию для ответа с ошибкой
+			errorWriter(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if value := query.Get("to"); value != "" {
+		if filter.To, err = time.Parse(reportDateLayout, value); err != nil {
+			//вызываем фукцию для ответа с ошибкой
+			errorWriter(w, r, http.StatusBadRequest, err)
+			return
+		}
+		// to включительно
+		filter.To = filter.To.AddDate(0, 0, 1)
+	}
+
+	items, err := s.auditSvc.Entries(r.Context(), filter)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, r, items)
+}
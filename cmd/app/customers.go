@@ -1,7 +1,6 @@
 package app
 
 import (
-	"encoding/json"
 	"net/http"
 
 	"github.com/KarrenAeris/crud/pkg/customers"
@@ -11,11 +10,9 @@ import (
 func (s *Server) handleCustomerRegistration(w http.ResponseWriter, r *http.Request) {
 
 	//обявляем структура клиента для запраса
-	var item *customers.Customer
+	item := &customers.Customer{}
 
-	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
-		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusBadRequest, err)
+	if !s.decodeJSON(w, r, item) {
 		return
 	}
 
@@ -23,7 +20,7 @@ func (s *Server) handleCustomerRegistration(w http.ResponseWriter, r *http.Reque
 	hashed, err := bcrypt.GenerateFromPassword([]byte(item.Password), bcrypt.DefaultCost)
 	if err != nil {
 		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusInternalServerError, err)
+		errorWriter(w, r, http.StatusInternalServerError, err)
 		return
 	}
 	//и поставляем хеш в поле парол
@@ -35,37 +32,50 @@ func (s *Server) handleCustomerRegistration(w http.ResponseWriter, r *http.Reque
 	//если получили ошибку то отвечаем с ошибкой
 	if err != nil {
 		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusInternalServerError, err)
+		errorWriter(w, r, http.StatusInternalServerError, err)
 		return
 	}
 	//вызываем функцию для ответа в формате JSON
-	respondJSON(w, customer)
+	respondJSON(w, r, customer)
 }
 
 func (s *Server) handleCustomerGetToken(w http.ResponseWriter, r *http.Request) {
 	//обявляем структуру для запроса
-	var item *struct {
-		Login    string `json:"login"`
-		Password string `json:"password"`
-	}
+	item := &struct {
+		Login    string `json:"login" validate:"required"`
+		Password string `json:"password" validate:"required"`
+	}{}
 	//извелекаем данные из запраса
-	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
-		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusBadRequest, err)
+	if !s.decodeJSON(w, r, item) {
 		return
 	}
 	//взываем из сервиса  securitySvc метод AuthenticateCustomer
 	token, err := s.customerSvc.Token(r.Context(), item.Login, item.Password)
 
 	if err != nil {
-		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusBadRequest, err)
+		loginError(w, r, err, http.StatusBadRequest)
 		return
 	}
 
 	//вызываем функцию для ответа в формате JSON
-	respondJSON(w, map[string]interface{}{"status": "ok", "token": token})
+	respondJSON(w, r, tokenResponse(token))
+
+}
+
+func (s *Server) handleCustomerRefreshToken(w http.ResponseWriter, r *http.Request) {
+	item := &refreshRequest{}
+	if !s.decodeJSON(w, r, item) {
+		return
+	}
 
+	token, err := s.customerSvc.Refresh(r.Context(), item.RefreshToken)
+	if err != nil {
+		refreshError(w, r, err)
+		return
+	}
+
+	//вызываем функцию для ответа в формате JSON
+	respondJSON(w, r, tokenResponse(token))
 }
 
 func (s *Server) handleCustomerGetProducts(w http.ResponseWriter, r *http.Request) {
@@ -73,10 +83,10 @@ func (s *Server) handleCustomerGetProducts(w http.ResponseWriter, r *http.Reques
 	items, err := s.customerSvc.Products(r.Context())
 	if err != nil {
 		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusBadRequest, err)
+		errorWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	respondJSON(w, items)
+	respondJSON(w, r, items)
 
 }
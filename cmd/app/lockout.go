@@ -0,0 +1,75 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/KarrenAeris/crud/pkg/lockout"
+	"github.com/KarrenAeris/crud/pkg/types"
+	"github.com/KarrenAeris/crud/pkg/utils"
+	"github.com/KarrenAeris/crud/pkg/validation"
+)
+
+func (s *Server) handleManagerUnlockLogin(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	// user_type пустой - телефон разблокируется и для покупателя, и для продавца
+	var item struct {
+		UserType string `json:"user_type" validate:"oneof=customer manager"`
+		Phone    string `json:"phone" validate:"phone"`
+		IP       string `json:"ip" validate:"max=64"`
+	}
+	if !s.decodeJSON(w, r, &item) {
+		return
+	}
+	if item.Phone == "" && item.IP == "" {
+		errs := validation.Errors{"phone": "phone or ip is required", "ip": "phone or ip is required"}
+		respondJSONWithCode(w, r, http.StatusUnprocessableEntity, map[string]interface{}{"errors": errs})
+		return
+	}
+
+	if item.Phone != "" {
+		phone, err := utils.NormalizePhone(item.Phone)
+		if err != nil {
+			//вызываем фукцию для ответа с ошибкой
+			errorWriter(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		userTypes := []string{types.UserCustomer, types.UserManager}
+		if item.UserType != "" {
+			userTypes = []string{item.UserType}
+		}
+		for _, userType := range userTypes {
+			if err = s.lockoutSvc.UnlockPhone(r.Context(), userType, phone); err != nil {
+				//вызываем фукцию для ответа с ошибкой
+				errorWriter(w, r, http.StatusInternalServerError, err)
+				return
+			}
+		}
+	}
+
+	if item.IP != "" {
+		if err := s.lockoutSvc.UnlockIP(r.Context(), item.IP); err != nil {
+			//вызываем фукцию для ответа с ошибкой
+			errorWriter(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	respondJSON(w, r, map[string]interface{}{"status": "ok"})
+}
+
+// loginError отвечает на ошибку входа: если вход временно запрещён - 429 с Retry-After, иначе status
+func loginError(w http.ResponseWriter, r *http.Request, err error, status int) {
+	var lockErr *lockout.Error
+	if errors.As(err, &lockErr) {
+		w.Header().Set("Retry-After", strconv.Itoa(lockErr.RetryAfterSeconds()))
+		status = http.StatusTooManyRequests
+	}
+	//вызываем фукцию для ответа с ошибкой
+	errorWriter(w, r, status, err)
+}
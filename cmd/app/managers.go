@@ -1,9 +1,7 @@
 package app
 
 import (
-	"encoding/json"
 	"errors"
-	"fmt"
 	"net/http"
 	"strconv"
 
@@ -20,39 +18,39 @@ func (s *Server) handleManagerRegistration(w http.ResponseWriter, r *http.Reques
 	id, err := middleware.Authentication(r.Context())
 	if err != nil {
 		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusBadRequest, err)
+		errorWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 	if id == 0 {
 		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusForbidden, err)
+		errorWriter(w, r, http.StatusForbidden, err)
 		return
 	}
 
 	if !s.managerSvc.IsAdmin(r.Context(), id) {
 		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusForbidden, err)
+		errorWriter(w, r, http.StatusForbidden, err)
 		return
 	}
 
 	var regItem struct {
-		ID    int64    `json:"id"`
-		Name  string   `json:"name"`
-		Phone string   `json:"phone"`
-		Roles []string `json:"roles"`
+		ID     int64    `json:"id"`
+		Name   string   `json:"name" validate:"required,max=255"`
+		Phone  string   `json:"phone" validate:"required,phone"`
+		Salary int64    `json:"salary" validate:"min=0"`
+		Plan   int64    `json:"plan" validate:"min=0"`
+		Roles  []string `json:"roles"`
 	}
 
-	err = json.NewDecoder(r.Body).Decode(&regItem)
-
-	if err != nil {
-		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusInternalServerError, err)
+	if !s.decodeJSON(w, r, &regItem) {
 		return
 	}
 	item := &types.Manager{
-		ID:    regItem.ID,
-		Name:  regItem.Name,
-		Phone: regItem.Phone,
+		ID:     regItem.ID,
+		Name:   regItem.Name,
+		Phone:  regItem.Phone,
+		Salary: regItem.Salary,
+		Plan:   regItem.Plan,
 	}
 
 	for _, role := range regItem.Roles {
@@ -63,98 +61,108 @@ func (s *Server) handleManagerRegistration(w http.ResponseWriter, r *http.Reques
 	}
 
 	tkn, err := s.managerSvc.Create(r.Context(), item)
-
+	if errors.Is(err, types.ErrPhoneUsed) {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusConflict, err)
+		return
+	}
 	if err != nil {
 		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusInternalServerError, err)
+		errorWriter(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
-	respondJSON(w, map[string]interface{}{"token": tkn})
+	respondJSON(w, r, tkn)
 
 }
 
 func (s *Server) handleManagerGetToken(w http.ResponseWriter, r *http.Request) {
 
-	var manager *types.Manager
-	err := json.NewDecoder(r.Body).Decode(&manager)
-
-	if err != nil {
-		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusInternalServerError, err)
+	var manager struct {
+		Phone    string `json:"phone" validate:"required"`
+		Password string `json:"password" validate:"required"`
+	}
+	if !s.decodeJSON(w, r, &manager) {
 		return
 	}
 
 	tkn, err := s.managerSvc.Token(r.Context(), manager.Phone, manager.Password)
 	if err != nil {
-		errorWriter(w, http.StatusBadRequest, err)
+		loginError(w, r, err, http.StatusBadRequest)
 		return
 	}
-	respondJSON(w, map[string]interface{}{"token": tkn})
+	respondJSON(w, r, tkn)
 
 }
 
+func (s *Server) handleManagerRefreshToken(w http.ResponseWriter, r *http.Request) {
+	item := &refreshRequest{}
+	if !s.decodeJSON(w, r, item) {
+		return
+	}
+
+	tkn, err := s.managerSvc.Refresh(r.Context(), item.RefreshToken)
+	if err != nil {
+		refreshError(w, r, err)
+		return
+	}
+	respondJSON(w, r, tkn)
+}
+
 func (s *Server) handleManagerChangeProducts(w http.ResponseWriter, r *http.Request) {
 	id, err := middleware.Authentication(r.Context())
 	if err != nil {
 		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusBadRequest, err)
+		errorWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 	if id == 0 {
 		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusForbidden, err)
+		errorWriter(w, r, http.StatusForbidden, err)
 		return
 	}
 	product := &types.Product{}
-	err = json.NewDecoder(r.Body).Decode(&product)
-	fmt.Print(product)
-	if err != nil {
-		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusInternalServerError, err)
+	if !s.decodeJSON(w, r, product) {
 		return
 	}
 
 	product, err = s.managerSvc.SaveProduct(r.Context(), product)
 	if err != nil {
 		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusInternalServerError, err)
+		errorWriter(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
-	respondJSON(w, product)
+	respondJSON(w, r, product)
 }
 
 func (s *Server) handleManagerMakeSales(w http.ResponseWriter, r *http.Request) {
 	id, err := middleware.Authentication(r.Context())
 	if err != nil {
 		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusBadRequest, err)
+		errorWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 	if id == 0 {
 		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusForbidden, err)
+		errorWriter(w, r, http.StatusForbidden, err)
 		return
 	}
 	sale := &types.Sale{}
-	sale.ManagerID = id
-	err = json.NewDecoder(r.Body).Decode(&sale)
-
-	if err != nil {
-		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusInternalServerError, err)
+	if !s.decodeJSON(w, r, sale) {
 		return
 	}
+	// продажу всегда оформляет сам продавец, manager_id из запроса не учитывается
+	sale.ManagerID = id
 
 	sale, err = s.managerSvc.MakeSale(r.Context(), sale)
 	if err != nil {
 		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusBadRequest, err)
+		errorWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	respondJSON(w, sale)
+	respondJSON(w, r, sale)
 
 }
 
@@ -162,22 +170,30 @@ func (s *Server) handleManagerGetSales(w http.ResponseWriter, r *http.Request) {
 	id, err := middleware.Authentication(r.Context())
 	if err != nil {
 		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusBadRequest, err)
+		errorWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 	if id == 0 {
 		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusForbidden, err)
+		errorWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+	// руководитель может смотреть продажи своих подчинённых
+	managerID, err := s.viewedManagerID(r, id)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusForbidden, err)
 		return
 	}
-	total, err := s.managerSvc.GetSales(r.Context(), id)
+
+	total, err := s.managerSvc.GetSales(r.Context(), managerID)
 	if err != nil {
 		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusBadRequest, err)
+		errorWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	respondJSON(w, map[string]interface{}{"manager_id": id, "total": total})
+	respondJSON(w, r, map[string]interface{}{"manager_id": managerID, "total": total})
 
 }
 
@@ -186,11 +202,11 @@ func (s *Server) handleManagerGetProducts(w http.ResponseWriter, r *http.Request
 	items, err := s.managerSvc.Products(r.Context())
 	if err != nil {
 		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusBadRequest, err)
+		errorWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	respondJSON(w, items)
+	respondJSON(w, r, items)
 
 }
 
@@ -198,31 +214,31 @@ func (s *Server) handleManagerRemoveProductByID(w http.ResponseWriter, r *http.R
 	id, err := middleware.Authentication(r.Context())
 	if err != nil {
 		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusBadRequest, err)
+		errorWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 	if id == 0 {
 		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusForbidden, err)
+		errorWriter(w, r, http.StatusForbidden, err)
 		return
 	}
 
 	idParam, ok := mux.Vars(r)["id"]
 	if !ok {
 		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusBadRequest, errors.New("Missing id"))
+		errorWriter(w, r, http.StatusBadRequest, errors.New("Missing id"))
 		return
 	}
 	productID, err := strconv.ParseInt(idParam, 10, 64)
 	if err != nil {
 		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusBadRequest, err)
+		errorWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 	err = s.managerSvc.RemoveProductByID(r.Context(), productID)
 	if err != nil {
 		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusBadRequest, err)
+		errorWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 
@@ -232,31 +248,31 @@ func (s *Server) handleManagerRemoveCustomerByID(w http.ResponseWriter, r *http.
 	id, err := middleware.Authentication(r.Context())
 	if err != nil {
 		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusBadRequest, err)
+		errorWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 	if id == 0 {
 		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusForbidden, err)
+		errorWriter(w, r, http.StatusForbidden, err)
 		return
 	}
 
 	idParam, ok := mux.Vars(r)["id"]
 	if !ok {
 		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusBadRequest, errors.New("Missing id"))
+		errorWriter(w, r, http.StatusBadRequest, errors.New("Missing id"))
 		return
 	}
 	customerID, err := strconv.ParseInt(idParam, 10, 64)
 	if err != nil {
 		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusBadRequest, err)
+		errorWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 	err = s.managerSvc.RemoveCustomerByID(r.Context(), customerID)
 	if err != nil {
 		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusBadRequest, err)
+		errorWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 
@@ -266,23 +282,23 @@ func (s *Server) handleManagerGetCustomers(w http.ResponseWriter, r *http.Reques
 	id, err := middleware.Authentication(r.Context())
 	if err != nil {
 		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusBadRequest, err)
+		errorWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 	if id == 0 {
 		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusForbidden, err)
+		errorWriter(w, r, http.StatusForbidden, err)
 		return
 	}
 
 	items, err := s.managerSvc.Customers(r.Context())
 	if err != nil {
 		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusBadRequest, err)
+		errorWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	respondJSON(w, items)
+	respondJSON(w, r, items)
 
 }
 
@@ -290,30 +306,26 @@ func (s *Server) handleManagerChangeCustomer(w http.ResponseWriter, r *http.Requ
 	id, err := middleware.Authentication(r.Context())
 	if err != nil {
 		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusBadRequest, err)
+		errorWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 	if id == 0 {
 		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusForbidden, err)
+		errorWriter(w, r, http.StatusForbidden, err)
 		return
 	}
 	customer := &types.Customer{}
-	err = json.NewDecoder(r.Body).Decode(&customer)
-	fmt.Println(customer)
-	if err != nil {
-		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusInternalServerError, err)
+	if !s.decodeJSON(w, r, customer) {
 		return
 	}
 
 	customer, err = s.managerSvc.ChangeCustomer(r.Context(), customer)
 	if err != nil {
 		//вызываем фукцию для ответа с ошибкой
-		errorWriter(w, http.StatusBadRequest, err)
+		errorWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	respondJSON(w, customer)
+	respondJSON(w, r, customer)
 
 }
\ No newline at end of file
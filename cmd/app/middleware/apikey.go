@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/KarrenAeris/crud/pkg/apikeys"
+	"github.com/KarrenAeris/crud/pkg/logger"
+	"github.com/KarrenAeris/crud/pkg/types"
+)
+
+// APIKeyHeader - заголовок с ключом API
+const APIKeyHeader = "X-API-Key"
+
+var apiKeyContextKey = &contextKey{"api key context"}
+
+// APIKeyFunc возвращает действующий ключ API, nil - ключ неизвестен, отозван или истёк
+type APIKeyFunc func(ctx context.Context, key string) (*types.APIKey, error)
+
+// ScopeFunc возвращает область доступа, нужную для маршрута запроса; пустая - маршрут ключам недоступен
+type ScopeFunc func(request *http.Request) string
+
+// APIKey аутентифицирует запросы с заголовком X-API-Key вместо Authorization: запрос выполняется
+// от имени создавшего ключ продавца, если у ключа есть нужная маршруту область доступа, иначе - 403.
+// Запросы без заголовка проходят как есть. Должен стоять после Authenticate и перед Actor
+func APIKey(keyFunc APIKeyFunc, scopeFunc ScopeFunc) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			key := request.Header.Get(APIKeyHeader)
+			if key == "" {
+				handler.ServeHTTP(writer, request)
+				return
+			}
+
+			item, err := keyFunc(request.Context(), key)
+			if err != nil {
+				logger.Error(request.Context(), err)
+				http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			if item == nil {
+				http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+
+			scope := scopeFunc(request)
+			if scope == "" || !apikeys.HasScope(item, scope) {
+				logger.Warn(request.Context(), "api key scope denied", "api_key_id", item.ID, "scope", scope)
+				http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+			setLogUserID(request.Context(), item.ManagerID)
+
+			ctx := context.WithValue(request.Context(), authenticationContextKey, item.ManagerID)
+			ctx = context.WithValue(ctx, apiKeyContextKey, item.ID)
+			handler.ServeHTTP(writer, request.WithContext(ctx))
+		})
+	}
+}
+
+// APIKeyID возвращает id ключа API, которым аутентифицирован запрос
+func APIKeyID(ctx context.Context) (int64, bool) {
+	id, ok := ctx.Value(apiKeyContextKey).(int64)
+	return id, ok
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/KarrenAeris/crud/pkg/audit"
+)
+
+// Actor кладёт в контекст запроса того, кто его выполняет, для журнала изменений.
+// Запрос с ключом API записывается на ключ. Должен стоять после Authenticate и APIKey
+func Actor(actorType string) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			actor := actorType
+			id, _ := Authentication(request.Context())
+			if keyID, ok := APIKeyID(request.Context()); ok {
+				actor, id = audit.ActorAPIKey, keyID
+			}
+
+			ctx := audit.WithActor(request.Context(), &audit.Actor{
+				Type: actor,
+				ID:   id,
+				IP:   ClientIP(request),
+			})
+			handler.ServeHTTP(writer, request.WithContext(ctx))
+		})
+	}
+}
+
+// ClientIP возвращает адрес клиента без порта
+func ClientIP(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
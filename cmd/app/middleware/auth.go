@@ -3,8 +3,10 @@ package middleware
 import (
 	"context"
 	"errors"
-	"log"
 	"net/http"
+	"strings"
+
+	"github.com/KarrenAeris/crud/pkg/logger"
 )
 
 const (
@@ -37,14 +39,17 @@ type IDFunc func(ctx context.Context, token string) (int64, error)
 func Authenticate(idFunc IDFunc) func(http.Handler) http.Handler {
 	return func(handler http.Handler) http.Handler {
 		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
-			token := request.Header.Get("Authorization")
+			// токен передаётся как есть или со схемой Bearer; что это за токен (из БД или подписанный),
+			// решает idFunc
+			token := strings.TrimPrefix(request.Header.Get("Authorization"), "Bearer ")
 
 			id, err := idFunc(request.Context(), token)
 			if err != nil {
-				log.Print(err, "Authhhththth")
+				logger.Error(request.Context(), err)
 				http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 				return
 			}
+			setLogUserID(request.Context(), id)
 
 			ctx := context.WithValue(request.Context(), authenticationContextKey, id)
 			request = request.WithContext(ctx)
@@ -1,32 +1,71 @@
 package middleware
 
 import (
+	"context"
 	"encoding/base64"
 	"errors"
-	"log"
 	"net/http"
+	"strconv"
 	"strings"
+
+	"github.com/KarrenAeris/crud/pkg/lockout"
+	"github.com/KarrenAeris/crud/pkg/logger"
+	"github.com/KarrenAeris/crud/pkg/types"
 )
 
-//Base ...
-func Base(checkAuth func(string, string) bool) func(handler http.Handler) http.Handler {
+// PasswordFunc возвращает id пользователя по логину и паролю, неверные данные - types.ErrInvalidPassword
+type PasswordFunc func(ctx context.Context, login, password string) (int64, error)
+
+//Base аутентифицирует запросы с заголовком Authorization: Basic как альтернативу токену, чтобы скрипты
+//и curl могли вызывать API без получения токена. Неверные логин или пароль, а также подключённый
+//второй фактор - 401 с WWW-Authenticate,
+//частые ошибки - 429 с Retry-After. Запросы без Basic проходят как есть. Должен стоять после Authenticate
+func Base(passwordFunc PasswordFunc) func(handler http.Handler) http.Handler {
 	return func(handler http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasPrefix(r.Header.Get("Authorization"), "Basic ") {
+				handler.ServeHTTP(w, r)
+				return
+			}
+
 			login, pass, err := getLoginPass(r)
 			if err != nil {
-				log.Println(err)
-				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				logger.Warn(r.Context(), "invalid basic auth header", "error", err.Error())
+				unauthorized(w)
 				return
 			}
-			if !checkAuth(login, pass) {
-				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+
+			id, err := passwordFunc(r.Context(), login, pass)
+			var lockErr *lockout.Error
+			switch {
+			case err == nil:
+			case errors.As(err, &lockErr):
+				w.Header().Set("Retry-After", strconv.Itoa(lockErr.RetryAfterSeconds()))
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			case errors.Is(err, types.ErrInvalidPassword), errors.Is(err, types.ErrTwoFactorRequired):
+				// со вторым фактором одного пароля мало
+				unauthorized(w)
+				return
+			default:
+				logger.Error(r.Context(), err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 				return
 			}
-			handler.ServeHTTP(w, r)
+			setLogUserID(r.Context(), id)
+
+			ctx := context.WithValue(r.Context(), authenticationContextKey, id)
+			handler.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// unauthorized отвечает 401 и предлагает клиенту Basic
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="api", charset="UTF-8"`)
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
 // getLoginPass возвращает логин и пороль
 func getLoginPass(r *http.Request) (string, string, error) {
 	auth := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
@@ -36,7 +75,6 @@ func getLoginPass(r *http.Request) (string, string, error) {
 
 	payload, err := base64.StdEncoding.DecodeString(auth[1])
 	if err != nil {
-		log.Println(err)
 		return "", "", errors.New("invalid payload")
 	}
 
@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/KarrenAeris/crud/pkg/logger"
+)
+
+// ClientCert пропускает только запросы по TLS с сертификатом клиента, проверенным по доверенным
+// центрам сервера (tls.VerifyClientCertIfGiven), остальным - 403. Сертификат запрашивается у всех
+// клиентов, а обязателен только там, где стоит ClientCert. Должен стоять перед Authenticate
+func ClientCert(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.TLS == nil || len(request.TLS.VerifiedChains) == 0 {
+			logger.Warn(request.Context(), "client certificate required")
+			http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(writer, request)
+	})
+}
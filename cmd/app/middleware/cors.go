@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig - настройки CORS для фронтенда с другого источника
+type CORSConfig struct {
+	AllowedOrigins   []string      // источники вида https://shop.example.com, "*" - любой; пусто - CORS выключен
+	AllowedMethods   []string      // методы, разрешённые в предварительных запросах
+	AllowedHeaders   []string      // заголовки, разрешённые в предварительных запросах
+	AllowCredentials bool          // разрешить браузеру отправлять cookie и Authorization
+	MaxAge           time.Duration // сколько браузер помнит ответ на предварительный запрос
+}
+
+// ErrCORSWildcardCredentials возвращается, когда любой источник ("*") разрешён вместе с AllowCredentials:
+// так любой сайт мог бы делать запросы от имени вошедшего пользователя
+var ErrCORSWildcardCredentials = errors.New(`cors: origin "*" cannot be combined with credentials`)
+
+// Validate проверяет, что настройки не открывают API с учётными данными для любого источника
+func (cfg CORSConfig) Validate() error {
+	if cfg.AllowCredentials && containsFold(cfg.AllowedOrigins, "*") {
+		return ErrCORSWildcardCredentials
+	}
+	return nil
+}
+
+// CORS отвечает на предварительные запросы (OPTIONS с Access-Control-Request-Method) и добавляет
+// заголовки CORS к ответам для разрешённых источников. Для перечисленных источников источник
+// повторяется из запроса, для "*" отдаётся буквальный "*" и учётные данные не разрешаются
+// (см. Validate). Должен стоять перед маршрутизатором: у маршрутов нет OPTIONS
+func CORS(cfg CORSConfig) func(http.Handler) http.Handler {
+	origins := make(map[string]bool, len(cfg.AllowedOrigins))
+	for _, origin := range cfg.AllowedOrigins {
+		origins[strings.TrimRight(origin, "/")] = true
+	}
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge / time.Second))
+
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			origin := request.Header.Get("Origin")
+			if origin == "" || len(origins) == 0 {
+				handler.ServeHTTP(writer, request)
+				return
+			}
+
+			// ответ зависит от источника, кеши не должны отдавать его другим источникам
+			writer.Header().Add("Vary", "Origin")
+			preflight := request.Method == http.MethodOptions && request.Header.Get("Access-Control-Request-Method") != ""
+
+			if !origins["*"] && !origins[origin] {
+				if preflight {
+					http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+					return
+				}
+				// без заголовков CORS браузер сам не отдаст ответ странице
+				handler.ServeHTTP(writer, request)
+				return
+			}
+
+			if origins[origin] {
+				writer.Header().Set("Access-Control-Allow-Origin", origin)
+				if cfg.AllowCredentials {
+					writer.Header().Set("Access-Control-Allow-Credentials", "true")
+				}
+			} else {
+				// браузер не отправит cookie и Authorization на ответ с буквальным "*"
+				writer.Header().Set("Access-Control-Allow-Origin", "*")
+			}
+			if !preflight {
+				handler.ServeHTTP(writer, request)
+				return
+			}
+
+			if !containsFold(cfg.AllowedMethods, request.Header.Get("Access-Control-Request-Method")) {
+				http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+			writer.Header().Add("Vary", "Access-Control-Request-Method")
+			writer.Header().Add("Vary", "Access-Control-Request-Headers")
+			writer.Header().Set("Access-Control-Allow-Methods", methods)
+			writer.Header().Set("Access-Control-Allow-Headers", headers)
+			writer.Header().Set("Access-Control-Max-Age", maxAge)
+			writer.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// containsFold проверяет, есть ли value в values без учёта регистра
+func containsFold(values []string, value string) bool {
+	for _, item := range values {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
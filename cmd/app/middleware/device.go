@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/KarrenAeris/crud/pkg/sessions"
+	"github.com/KarrenAeris/crud/pkg/types"
+)
+
+// Device кладёт в контекст запроса User-Agent и адрес клиента, они сохраняются в сессии при входе
+// и при её использовании. Должен стоять перед Authenticate
+func Device(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ctx := sessions.WithDevice(request.Context(), types.Device{
+			UserAgent: request.UserAgent(),
+			IP:        ClientIP(request),
+		})
+		handler.ServeHTTP(writer, request.WithContext(ctx))
+	})
+}
@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/KarrenAeris/crud/pkg/idempotency"
+	"github.com/KarrenAeris/crud/pkg/logger"
+	"github.com/KarrenAeris/crud/pkg/validation"
+)
+
+// IdempotencyKeyHeader - заголовок с ключом идемпотентности
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+const maxIdempotencyKeyLen = 255
+
+// Idempotency сохраняет первый ответ на изменяющий запрос с заголовком Idempotency-Key
+// и отдаёт его же на повторы. Должен стоять после Authenticate: ключи хранятся по пользователю,
+// запросы без аутентификации проходят без ключа. Ответы хранятся в БД, поэтому маршруты,
+// выдающие токены и секреты, под этот middleware ставить нельзя.
+func Idempotency(svc *idempotency.Service) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			// ключи хранятся по пользователю: анонимные запросы делили бы одно пространство ключей
+			userID, _ := Authentication(request.Context())
+			key := request.Header.Get(IdempotencyKeyHeader)
+			if key == "" || !isMutating(request.Method) || userID == 0 {
+				handler.ServeHTTP(writer, request)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLen {
+				http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+
+			body, err := ioutil.ReadAll(request.Body)
+			if errors.Is(err, validation.ErrBodyTooLarge) {
+				http.Error(writer, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				return
+			}
+			if err != nil {
+				logger.Error(request.Context(), err)
+				http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+			request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			sum := sha256.Sum256(body)
+			hash := hex.EncodeToString(sum[:])
+
+			endpoint := request.Method + " " + request.URL.Path
+
+			stored, err := svc.Start(request.Context(), userID, endpoint, key, hash)
+			switch err {
+			case nil:
+			case idempotency.ErrKeyReused:
+				http.Error(writer, err.Error(), http.StatusUnprocessableEntity)
+				return
+			case idempotency.ErrInProgress:
+				http.Error(writer, err.Error(), http.StatusConflict)
+				return
+			default:
+				http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			if stored != nil {
+				if stored.ContentType != "" {
+					writer.Header().Set("Content-Type", stored.ContentType)
+				}
+				writer.Header().Set("Idempotent-Replayed", "true")
+				writer.WriteHeader(stored.Status)
+				_, err = writer.Write(stored.Body)
+				if err != nil {
+					logger.Error(request.Context(), err)
+				}
+				return
+			}
+
+			recorder := &responseRecorder{ResponseWriter: writer, status: http.StatusOK}
+			func() {
+				// после паники ключ не должен остаться "в работе" до истечения
+				defer func() {
+					if p := recover(); p != nil {
+						if err := svc.Discard(request.Context(), userID, endpoint, key); err != nil {
+							logger.Error(request.Context(), err)
+						}
+						panic(p)
+					}
+				}()
+				handler.ServeHTTP(recorder, request)
+			}()
+
+			// после внутренней ошибки запрос можно повторить с тем же ключом
+			if recorder.status >= http.StatusInternalServerError {
+				if err = svc.Discard(request.Context(), userID, endpoint, key); err != nil {
+					logger.Error(request.Context(), err)
+				}
+				return
+			}
+
+			err = svc.Finish(request.Context(), userID, endpoint, key, &idempotency.Response{
+				Status:      recorder.status,
+				ContentType: recorder.Header().Get("Content-Type"),
+				Body:        recorder.body.Bytes(),
+			})
+			if err != nil {
+				logger.Error(request.Context(), err)
+			}
+		})
+	}
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// responseRecorder пропускает ответ клиенту, запоминая статус и тело
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
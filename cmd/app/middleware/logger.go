@@ -1,19 +1,89 @@
 package middleware
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/KarrenAeris/crud/pkg/logger"
 )
 
-// CheckHeader ...
-func CheckHeader(header, value string) func(handler http.Handler) http.Handler {
-	return func(handler http.Handler) http.Handler {
-		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
-			if value != request.Header.Get(header) {
-				http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-				return
-			}
-
-			handler.ServeHTTP(writer, request)
-		})
+// RequestIDHeader - заголовок с id запроса
+const RequestIDHeader = "X-Request-ID"
+
+// принимаем от клиента только короткие id из безопасных символов
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+var requestLogContextKey = &contextKey{"request log"}
+
+// requestLog заполняется по ходу обработки запроса: пользователя узнаёт только Authenticate
+type requestLog struct {
+	userID int64
+}
+
+// Logger назначает запросу id (или берёт из X-Request-ID), кладёт его в контекст и ответ
+// и пишет по каждому запросу JSON запись с методом, путём, статусом, временем и размером ответа
+func Logger(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+
+		id := request.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		writer.Header().Set(RequestIDHeader, id)
+
+		entry := &requestLog{}
+		ctx := logger.WithRequestID(request.Context(), id)
+		ctx = context.WithValue(ctx, requestLogContextKey, entry)
+
+		recorder := &statusWriter{ResponseWriter: writer, status: http.StatusOK}
+		handler.ServeHTTP(recorder, request.WithContext(ctx))
+
+		logger.Info(ctx, "request",
+			"method", request.Method,
+			"path", request.URL.Path,
+			"status", recorder.status,
+			"latency_ms", float64(time.Since(start).Microseconds())/1000,
+			"user_id", entry.userID,
+			"bytes", recorder.bytes,
+			"ip", ClientIP(request),
+		)
+	})
+}
+
+// setLogUserID запоминает пользователя для записи о запросе
+func setLogUserID(ctx context.Context, id int64) {
+	if entry, ok := ctx.Value(requestLogContextKey).(*requestLog); ok {
+		entry.userID = id
 	}
 }
+
+func newRequestID() string {
+	buffer := make([]byte, 16)
+	if _, err := rand.Read(buffer); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(buffer)
+}
+
+// statusWriter запоминает статус и число записанных байт ответа
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(data []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(data)
+	w.bytes += n
+	return n, err
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/KarrenAeris/crud/pkg/metrics"
+	"github.com/gorilla/mux"
+)
+
+// маршрут в метриках для запросов, не попавших ни в один маршрут
+const unmatchedRoute = "unmatched"
+
+// Metrics считает запросы и время их обработки по шаблону маршрута gorilla/mux
+// (а не по пути, чтобы id в пути не плодили метрики). Ставится через Router.Use
+func Metrics(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+
+		recorder := &statusWriter{ResponseWriter: writer, status: http.StatusOK}
+		handler.ServeHTTP(recorder, request)
+
+		route := unmatchedRoute
+		if current := mux.CurrentRoute(request); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		metrics.HTTPRequests.WithLabelValues(route, request.Method, strconv.Itoa(recorder.status)).Inc()
+		metrics.HTTPDuration.WithLabelValues(route, request.Method).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/KarrenAeris/crud/pkg/validation"
+)
+
+// SecurityHeaders добавляет к ответам стандартные заголовки безопасности. API отдаёт только JSON,
+// поэтому ответы нельзя встраивать в страницы, исполнять как скрипты и кешировать.
+// Strict-Transport-Security отправляется только по HTTPS
+func SecurityHeaders(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		header := writer.Header()
+		header.Set("X-Content-Type-Options", "nosniff")
+		header.Set("X-Frame-Options", "DENY")
+		header.Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+		header.Set("Referrer-Policy", "no-referrer")
+		header.Set("Cache-Control", "no-store")
+		if request.TLS != nil {
+			header.Set("Strict-Transport-Security", "max-age=63072000; includeSubDomains")
+		}
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+// BodyLimit ограничивает размер тела запроса maxBytes байтами: запрос с большим Content-Length
+// сразу получает 413, а чтение тела без длины прерывается ошибкой validation.ErrBodyTooLarge
+func BodyLimit(maxBytes int64) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if request.ContentLength > maxBytes {
+				http.Error(writer, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				return
+			}
+			if request.Body != nil && request.Body != http.NoBody {
+				request.Body = &limitedBody{ReadCloser: request.Body, remaining: maxBytes}
+			}
+			handler.ServeHTTP(writer, request)
+		})
+	}
+}
+
+// limitedBody - тело запроса, которое можно прочитать не больше чем на remaining байт
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, validation.ErrBodyTooLarge
+	}
+	// читаем на байт больше остатка, чтобы отличить тело ровно в maxBytes от большего
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) > b.remaining {
+		n = int(b.remaining)
+		b.remaining = -1
+		return n, validation.ErrBodyTooLarge
+	}
+	b.remaining -= int64(n)
+	return n, err
+}
@@ -0,0 +1,340 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/KarrenAeris/crud/cmd/app/middleware"
+	"github.com/KarrenAeris/crud/pkg/types"
+	"github.com/gorilla/mux"
+)
+
+func (s *Server) handleCustomerGetCart(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	items, err := s.orderSvc.Cart(r.Context(), id)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, r, items)
+}
+
+func (s *Server) handleCustomerChangeCart(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	position := &types.CartPosition{}
+	if !s.decodeJSON(w, r, position) {
+		return
+	}
+
+	items, err := s.orderSvc.SetCartPosition(r.Context(), id, position)
+	if errors.Is(err, types.ErrNotFound) {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, r, items)
+}
+
+func (s *Server) handleCustomerRemoveCartPosition(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	idParam, ok := mux.Vars(r)["id"]
+	if !ok {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, errors.New("Missing id"))
+		return
+	}
+	productID, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	items, err := s.orderSvc.RemoveCartPosition(r.Context(), id, productID)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, r, items)
+}
+
+func (s *Server) handleCustomerMakeOrder(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	order, err := s.orderSvc.Checkout(r.Context(), id)
+	if errors.Is(err, types.ErrCartEmpty) {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSONWithCode(w, r, http.StatusCreated, order)
+}
+
+func (s *Server) handleCustomerGetOrders(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	items, err := s.orderSvc.Orders(r.Context(), id, r.URL.Query().Get("status"))
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, r, items)
+}
+
+func (s *Server) handleCustomerGetOrderByID(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	orderID, err := orderIDParam(r)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	order, err := s.orderSvc.ByID(r.Context(), orderID)
+	if err == nil && order.CustomerID != id {
+		// чужие заказы для покупателя не существуют
+		err = types.ErrNotFound
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, orderErrorStatus(err), err)
+		return
+	}
+
+	respondJSON(w, r, order)
+}
+
+func (s *Server) handleCustomerCancelOrder(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	orderID, err := orderIDParam(r)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	order, err := s.orderSvc.ByID(r.Context(), orderID)
+	if err == nil && order.CustomerID != id {
+		err = types.ErrNotFound
+	}
+	if err == nil {
+		order, err = s.orderSvc.Cancel(r.Context(), id, orderID)
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, orderErrorStatus(err), err)
+		return
+	}
+
+	respondJSON(w, r, order)
+}
+
+func (s *Server) handleManagerGetOrders(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	items, err := s.orderSvc.Orders(r.Context(), 0, r.URL.Query().Get("status"))
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, r, items)
+}
+
+func (s *Server) handleManagerGetOrderByID(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	orderID, err := orderIDParam(r)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	order, err := s.orderSvc.ByID(r.Context(), orderID)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, orderErrorStatus(err), err)
+		return
+	}
+
+	respondJSON(w, r, order)
+}
+
+func (s *Server) handleManagerChangeOrderStatus(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	orderID, err := orderIDParam(r)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	var order *types.Order
+	switch mux.Vars(r)["action"] {
+	case "confirm":
+		order, err = s.orderSvc.Confirm(r.Context(), id, orderID)
+	case "fulfill":
+		order, err = s.orderSvc.Fulfill(r.Context(), orderID)
+	case "cancel":
+		order, err = s.orderSvc.Cancel(r.Context(), 0, orderID)
+	default:
+		err = types.ErrOrderStatus
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, orderErrorStatus(err), err)
+		return
+	}
+
+	respondJSON(w, r, order)
+}
+
+// orderIDParam извлекает id заказа из пути запроса
+func orderIDParam(r *http.Request) (int64, error) {
+	idParam, ok := mux.Vars(r)["id"]
+	if !ok {
+		return 0, errors.New("Missing id")
+	}
+	return strconv.ParseInt(idParam, 10, 64)
+}
+
+// orderErrorStatus подбирает HTTP статус для ошибок сервиса заказов
+func orderErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, types.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, types.ErrOrderStatus):
+		return http.StatusConflict
+	case errors.Is(err, types.ErrInternal):
+		return http.StatusInternalServerError
+	default:
+		return http.StatusBadRequest
+	}
+}
@@ -0,0 +1,62 @@
+package app
+
+import (
+	"net/http"
+
+	"github.com/KarrenAeris/crud/pkg/types"
+)
+
+func (s *Server) handleCustomerForgotPassword(w http.ResponseWriter, r *http.Request) {
+	s.forgotPassword(w, r, types.UserCustomer)
+}
+
+func (s *Server) handleCustomerResetPassword(w http.ResponseWriter, r *http.Request) {
+	s.resetPassword(w, r, types.UserCustomer)
+}
+
+func (s *Server) handleManagerForgotPassword(w http.ResponseWriter, r *http.Request) {
+	s.forgotPassword(w, r, types.UserManager)
+}
+
+func (s *Server) handleManagerResetPassword(w http.ResponseWriter, r *http.Request) {
+	s.resetPassword(w, r, types.UserManager)
+}
+
+// forgotPassword отправляет код сброса пароля. Ответ одинаковый для любого номера
+func (s *Server) forgotPassword(w http.ResponseWriter, r *http.Request, userType string) {
+	var item struct {
+		Phone string `json:"phone" validate:"required,phone"`
+	}
+	if !s.decodeJSON(w, r, &item) {
+		return
+	}
+
+	err := s.verificationSvc.SendResetCode(r.Context(), userType, item.Phone)
+	if err != nil {
+		// частые запросы с одного адреса - 429 с Retry-After
+		loginError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, r, map[string]interface{}{"status": "ok"})
+}
+
+// resetPassword задаёт новый пароль по коду и отзывает все токены пользователя
+func (s *Server) resetPassword(w http.ResponseWriter, r *http.Request, userType string) {
+	var item struct {
+		Phone    string `json:"phone" validate:"required,phone"`
+		Code     string `json:"code" validate:"required,max=16"`
+		Password string `json:"password" validate:"required,max=72"`
+	}
+	if !s.decodeJSON(w, r, &item) {
+		return
+	}
+
+	err := s.verificationSvc.ResetPassword(r.Context(), userType, item.Phone, item.Code, item.Password)
+	if err != nil {
+		codeError(w, r, err)
+		return
+	}
+
+	respondJSON(w, r, map[string]interface{}{"status": "ok"})
+}
@@ -0,0 +1,188 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/KarrenAeris/crud/cmd/app/middleware"
+	"github.com/KarrenAeris/crud/pkg/types"
+	"github.com/gorilla/mux"
+)
+
+// формат месяца расчёта зарплаты
+const payrollPeriodLayout = "2006-01"
+
+func (s *Server) handleManagerGetPayrolls(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	// продавец видит только свои утверждённые начисления
+	if !s.managerSvc.IsAdmin(r.Context(), id) {
+		items, err := s.payrollSvc.ManagerItems(r.Context(), id)
+		if err != nil {
+			//вызываем фукцию для ответа с ошибкой
+			errorWriter(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		respondJSON(w, r, items)
+		return
+	}
+
+	items, err := s.payrollSvc.Payrolls(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, r, items)
+}
+
+func (s *Server) handleManagerMakePayroll(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.adminID(w, r)
+	if !ok {
+		return
+	}
+
+	var item struct {
+		Period string `json:"period" validate:"required"`
+	}
+	if !s.decodeJSON(w, r, &item) {
+		return
+	}
+
+	period, err := time.Parse(payrollPeriodLayout, item.Period)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	payroll, err := s.payrollSvc.Calculate(r.Context(), id, period)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSONWithCode(w, r, http.StatusCreated, payroll)
+}
+
+func (s *Server) handleManagerGetPayrollByID(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	payrollID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	payroll, err := s.payrollSvc.ByID(r.Context(), payrollID)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, payrollErrorStatus(err), err)
+		return
+	}
+
+	respondJSON(w, r, payroll)
+}
+
+func (s *Server) handleManagerLockPayroll(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.adminID(w, r)
+	if !ok {
+		return
+	}
+
+	payrollID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	payroll, err := s.payrollSvc.Lock(r.Context(), id, payrollID)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, payrollErrorStatus(err), err)
+		return
+	}
+
+	respondJSON(w, r, payroll)
+}
+
+func (s *Server) handleManagerGetCommissionRules(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	rules, err := s.payrollSvc.Rules(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, r, rules)
+}
+
+func (s *Server) handleManagerChangeCommissionRules(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	rules := &types.CommissionRules{}
+	if !s.decodeJSON(w, r, rules) {
+		return
+	}
+
+	rules, err := s.payrollSvc.SaveRules(r.Context(), rules)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	respondJSON(w, r, rules)
+}
+
+// adminID возвращает id аутентифицированного админа, иначе отвечает ошибкой
+func (s *Server) adminID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return 0, false
+	}
+	if id == 0 || !s.managerSvc.IsAdmin(r.Context(), id) {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusForbidden, errors.New("admin role required"))
+		return 0, false
+	}
+	return id, true
+}
+
+// payrollErrorStatus подбирает HTTP статус для ошибок сервиса зарплаты
+func payrollErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, types.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, types.ErrPayrollLocked):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
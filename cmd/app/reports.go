@@ -0,0 +1,123 @@
+package app
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/KarrenAeris/crud/cmd/app/middleware"
+	"github.com/KarrenAeris/crud/pkg/logger"
+	"github.com/KarrenAeris/crud/pkg/reports"
+	"github.com/KarrenAeris/crud/pkg/types"
+)
+
+// формат дат в параметрах отчётов
+const reportDateLayout = "2006-01-02"
+
+func (s *Server) handleManagerGetPerformance(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	from, to, err := reportPeriod(r)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	group := r.URL.Query().Get("group")
+	if group == "" {
+		group = reports.GroupDay
+	}
+
+	// продавец видит показатели своей команды (себя и подчинённых), админ - всех
+	var managerIDs []int64
+	if !s.managerSvc.IsAdmin(r.Context(), id) {
+		managerIDs, err = s.managerSvc.Subtree(r.Context(), id)
+		if err != nil {
+			//вызываем фукцию для ответа с ошибкой
+			errorWriter(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	items, err := s.reportSvc.Performance(r.Context(), from, to, group, managerIDs)
+	if errors.Is(err, reports.ErrInvalidGroup) || errors.Is(err, reports.ErrPeriodTooLong) {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "csv" {
+		respondPerformanceCSV(w, r, items)
+		return
+	}
+
+	respondJSON(w, r, items)
+}
+
+// reportPeriod разбирает параметры from и to (включительно), по умолчанию - текущий месяц
+func reportPeriod(r *http.Request) (from, to time.Time, err error) {
+	now := time.Now()
+	from = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	if value := r.URL.Query().Get("from"); value != "" {
+		from, err = time.Parse(reportDateLayout, value)
+		if err != nil {
+			return from, to, err
+		}
+	}
+	if value := r.URL.Query().Get("to"); value != "" {
+		to, err = time.Parse(reportDateLayout, value)
+		if err != nil {
+			return from, to, err
+		}
+	}
+	if to.Before(from) {
+		return from, to, errors.New("to is before from")
+	}
+
+	return from, to.AddDate(0, 0, 1), nil
+}
+
+func respondPerformanceCSV(w http.ResponseWriter, r *http.Request, items []*types.Performance) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="performance.csv"`)
+
+	writer := csv.NewWriter(w)
+	records := [][]string{{"period", "manager_id", "name", "revenue", "sales", "average_ticket", "plan", "plan_percent"}}
+	for _, item := range items {
+		records = append(records, []string{
+			item.Period.Format(reportDateLayout),
+			strconv.FormatInt(item.ManagerID, 10),
+			item.Name,
+			strconv.FormatInt(item.Revenue, 10),
+			strconv.FormatInt(item.Sales, 10),
+			strconv.FormatInt(item.AverageTicket, 10),
+			strconv.FormatInt(item.Plan, 10),
+			fmt.Sprintf("%.2f", item.PlanPercent),
+		})
+	}
+
+	if err := writer.WriteAll(records); err != nil {
+		logger.Error(r.Context(), err)
+	}
+}
@@ -0,0 +1,98 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/KarrenAeris/crud/cmd/app/middleware"
+	"github.com/KarrenAeris/crud/pkg/types"
+	"github.com/gorilla/mux"
+)
+
+func (s *Server) handleManagerGetReservations(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	items, err := s.reservationSvc.ByManager(r.Context(), id)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, r, items)
+}
+
+func (s *Server) handleManagerMakeReservation(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	item := &types.Reservation{}
+	if !s.decodeJSON(w, r, item) {
+		return
+	}
+	item.ManagerID = id
+	item.OrderID = 0
+
+	item, err = s.reservationSvc.Reserve(r.Context(), item)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, orderErrorStatus(err), err)
+		return
+	}
+
+	respondJSONWithCode(w, r, http.StatusCreated, item)
+}
+
+func (s *Server) handleManagerRemoveReservation(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	idParam, ok := mux.Vars(r)["id"]
+	if !ok {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, errors.New("Missing id"))
+		return
+	}
+	reservationID, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	err = s.reservationSvc.Release(r.Context(), id, reservationID)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, orderErrorStatus(err), err)
+		return
+	}
+}
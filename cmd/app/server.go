@@ -2,17 +2,28 @@ package app
 
 import (
 	"encoding/json"
-
-	"log"
+	"errors"
 	"net/http"
 
-
 	"github.com/gorilla/mux"
 
 	"github.com/KarrenAeris/crud/cmd/app/middleware"
+	"github.com/KarrenAeris/crud/pkg/analytics"
+	"github.com/KarrenAeris/crud/pkg/apikeys"
+	"github.com/KarrenAeris/crud/pkg/audit"
 	"github.com/KarrenAeris/crud/pkg/customers"
+	"github.com/KarrenAeris/crud/pkg/idempotency"
+	"github.com/KarrenAeris/crud/pkg/lockout"
+	"github.com/KarrenAeris/crud/pkg/logger"
 	"github.com/KarrenAeris/crud/pkg/managers"
-
+	"github.com/KarrenAeris/crud/pkg/metrics"
+	"github.com/KarrenAeris/crud/pkg/orders"
+	"github.com/KarrenAeris/crud/pkg/payroll"
+	"github.com/KarrenAeris/crud/pkg/reports"
+	"github.com/KarrenAeris/crud/pkg/reservations"
+	"github.com/KarrenAeris/crud/pkg/sessions"
+	"github.com/KarrenAeris/crud/pkg/validation"
+	"github.com/KarrenAeris/crud/pkg/verification"
 )
 
 // Методы запросов
@@ -22,76 +33,243 @@ const (
 	DELETE = "DELETE" // Метод удаления DELETE
 )
 
+//Options - настройки HTTP сервера
+type Options struct {
+	CORS        middleware.CORSConfig
+	MaxBodySize int64 // наибольший размер тела запроса в байтах, 0 - validation.MaxBodySize
+
+	// API продавцов доступен только с сертификатом клиента (mTLS), проверку сертификата настраивает http.Server
+	ManagerClientCert bool
+}
+
 //Server ...
 type Server struct {
-	mux         *mux.Router
-	customerSvc *customers.Service
-	managerSvc  *managers.Service
+	options         Options
+	mux             *mux.Router
+	handler         http.Handler
+	customerSvc     *customers.Service
+	managerSvc      *managers.Service
+	orderSvc        *orders.Service
+	reservationSvc  *reservations.Service
+	idempotencySvc  *idempotency.Service
+	reportSvc       *reports.Service
+	payrollSvc      *payroll.Service
+	analyticsSvc    *analytics.Service
+	auditSvc        *audit.Service
+	verificationSvc *verification.Service
+	lockoutSvc      *lockout.Service
+	apiKeySvc       *apikeys.Service
+	sessionSvc      *sessions.Service
 }
 
 //NewServer ...
-func NewServer(m *mux.Router, cSvc *customers.Service, mSvc *managers.Service) *Server {
+func NewServer(
+	opts Options,
+	m *mux.Router,
+	cSvc *customers.Service,
+	mSvc *managers.Service,
+	oSvc *orders.Service,
+	rSvc *reservations.Service,
+	iSvc *idempotency.Service,
+	repSvc *reports.Service,
+	pSvc *payroll.Service,
+	aSvc *analytics.Service,
+	auSvc *audit.Service,
+	vSvc *verification.Service,
+	lSvc *lockout.Service,
+	akSvc *apikeys.Service,
+	sSvc *sessions.Service,
+) *Server {
 	return &Server{
-		mux:         m,
-		customerSvc: cSvc,
-		managerSvc:  mSvc,
+		options:         opts,
+		mux:             m,
+		customerSvc:     cSvc,
+		managerSvc:      mSvc,
+		orderSvc:        oSvc,
+		reservationSvc:  rSvc,
+		idempotencySvc:  iSvc,
+		reportSvc:       repSvc,
+		payrollSvc:      pSvc,
+		analyticsSvc:    aSvc,
+		auditSvc:        auSvc,
+		verificationSvc: vSvc,
+		lockoutSvc:      lSvc,
+		apiKeySvc:       akSvc,
+		sessionSvc:      sSvc,
 	}
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	s.mux.ServeHTTP(w, r)
+	s.handler.ServeHTTP(w, r)
 }
 
 //Init инициализирует сервер (регистрирует все Handler'ы)
 func (s *Server) Init() {
+	if s.options.MaxBodySize == 0 {
+		s.options.MaxBodySize = validation.MaxBodySize
+	}
+
+	// логируем все запросы, в том числе не попавшие ни в один маршрут. CORS и ограничение тела
+	// стоят перед маршрутизатором: у маршрутов нет OPTIONS, а тело читают и до обработчиков
+	s.handler = middleware.Logger(middleware.SecurityHeaders(
+		middleware.CORS(s.options.CORS)(middleware.BodyLimit(s.options.MaxBodySize)(s.mux)),
+	))
+
+	// метрики считаются по шаблону маршрута, поэтому снимаются уже после сопоставления
+	s.mux.Use(middleware.Metrics)
+	s.mux.Use(middleware.Tracing)
+	s.mux.Use(middleware.Device)
+	s.mux.NotFoundHandler = middleware.Metrics(http.NotFoundHandler())
+	s.mux.MethodNotAllowedHandler = middleware.Metrics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}))
+	s.mux.Handle("/metrics", metrics.Handler()).Methods("GET")
+
+	// идемпотентность ставится после аутентификации: ключи хранятся по пользователю
+	idempotencyMd := middleware.Idempotency(s.idempotencySvc)
+
 	customersAuthenticateMd := middleware.Authenticate(s.customerSvc.IDByToken)
 	customersSubrouter := s.mux.PathPrefix("/api/customers").Subrouter()
 	customersSubrouter.Use(customersAuthenticateMd)
+	customersSubrouter.Use(middleware.Actor(audit.ActorCustomer))
 
+	// регистрация, вход и сброс пароля - без ключей идемпотентности: в их ответах токены,
+	// которые нельзя хранить в БД, а анонимные клиенты делили бы одно пространство ключей
 	customersSubrouter.HandleFunc("", s.handleCustomerRegistration).Methods("POST")
 	customersSubrouter.HandleFunc("/token", s.handleCustomerGetToken).Methods("POST")
-	customersSubrouter.HandleFunc("/products", s.handleCustomerGetProducts).Methods("GET")
+	customersSubrouter.HandleFunc("/token/refresh", s.handleCustomerRefreshToken).Methods("POST")
+	customersSubrouter.HandleFunc("/password/forgot", s.handleCustomerForgotPassword).Methods("POST")
+	customersSubrouter.HandleFunc("/password/reset", s.handleCustomerResetPassword).Methods("POST")
+
+	customersIdempotentRouter := customersSubrouter.NewRoute().Subrouter()
+	customersIdempotentRouter.Use(idempotencyMd)
+	customersIdempotentRouter.HandleFunc("/phone/code", s.handleCustomerSendPhoneCode).Methods("POST")
+	customersIdempotentRouter.HandleFunc("/phone/verify", s.handleCustomerVerifyPhone).Methods("POST")
+	customersIdempotentRouter.HandleFunc("/sessions", s.handleCustomerGetSessions).Methods("GET")
+	customersIdempotentRouter.HandleFunc("/sessions/{session:[0-9]+}", s.handleCustomerRevokeSession).Methods("DELETE")
+	customersIdempotentRouter.HandleFunc("/products", s.handleCustomerGetProducts).Methods("GET")
+	customersIdempotentRouter.HandleFunc("/cart", s.handleCustomerGetCart).Methods("GET")
+	customersIdempotentRouter.HandleFunc("/cart", s.handleCustomerChangeCart).Methods("POST")
+	customersIdempotentRouter.HandleFunc("/cart/{id:[0-9]+}", s.handleCustomerRemoveCartPosition).Methods("DELETE")
+	customersIdempotentRouter.HandleFunc("/orders", s.handleCustomerGetOrders).Methods("GET")
+	customersIdempotentRouter.HandleFunc("/orders", s.handleCustomerMakeOrder).Methods("POST")
+	customersIdempotentRouter.HandleFunc("/orders/{id:[0-9]+}", s.handleCustomerGetOrderByID).Methods("GET")
+	customersIdempotentRouter.HandleFunc("/orders/{id:[0-9]+}/cancel", s.handleCustomerCancelOrder).Methods("POST")
 
 	managersAuthenticateMd := middleware.Authenticate(s.managerSvc.IDByToken)
 	managersSubRouter := s.mux.PathPrefix("/api/managers").Subrouter()
+	if s.options.ManagerClientCert {
+		managersSubRouter.Use(middleware.ClientCert)
+	}
 	managersSubRouter.Use(managersAuthenticateMd)
+	managersSubRouter.Use(middleware.Base(s.managerSvc.IDByPassword))
+	managersSubRouter.Use(middleware.APIKey(s.apiKeySvc.Authenticate, apiKeyScope))
+	managersSubRouter.Use(middleware.Actor(audit.ActorManager))
+
+	// вход, регистрация, сброс пароля и выдача секретов (второй фактор, API-ключи) - без ключей
+	// идемпотентности: их ответы с токенами и секретами не должны храниться в БД
 	managersSubRouter.HandleFunc("", s.handleManagerRegistration).Methods("POST")
 	managersSubRouter.HandleFunc("/token", s.handleManagerGetToken).Methods("POST")
-	managersSubRouter.HandleFunc("/sales", s.handleManagerGetSales).Methods("GET")
-	managersSubRouter.HandleFunc("/sales", s.handleManagerMakeSales).Methods("POST")
-	managersSubRouter.HandleFunc("/products", s.handleManagerGetProducts).Methods("GET")
-	managersSubRouter.HandleFunc("/products", s.handleManagerChangeProducts).Methods("POST")
-	managersSubRouter.HandleFunc("/products/{id:[0-9]+}", s.handleManagerRemoveProductByID).Methods("DELETE")
-	managersSubRouter.HandleFunc("/customers", s.handleManagerGetCustomers).Methods("GET")
-	managersSubRouter.HandleFunc("/customers", s.handleManagerChangeCustomer).Methods("POST")
-	managersSubRouter.HandleFunc("/customers/{id:[0-9]+}", s.handleManagerRemoveCustomerByID).Methods("DELETE")
+	managersSubRouter.HandleFunc("/token/refresh", s.handleManagerRefreshToken).Methods("POST")
+	managersSubRouter.HandleFunc("/token/2fa", s.handleManagerVerifyChallenge).Methods("POST")
+	managersSubRouter.HandleFunc("/2fa/enroll", s.handleManagerEnrollTOTP).Methods("POST")
+	managersSubRouter.HandleFunc("/2fa/confirm", s.handleManagerConfirmTOTP).Methods("POST")
+	managersSubRouter.HandleFunc("/password/forgot", s.handleManagerForgotPassword).Methods("POST")
+	managersSubRouter.HandleFunc("/password/reset", s.handleManagerResetPassword).Methods("POST")
+	managersSubRouter.HandleFunc("/api-keys", s.handleManagerGetAPIKeys).Methods("GET")
+	managersSubRouter.HandleFunc("/api-keys", s.handleManagerCreateAPIKey).Methods("POST")
+
+	managersIdempotentRouter := managersSubRouter.NewRoute().Subrouter()
+	managersIdempotentRouter.Use(idempotencyMd)
+	managersIdempotentRouter.HandleFunc("/2fa/disable", s.handleManagerDisableTOTP).Methods("POST")
+	managersIdempotentRouter.HandleFunc("/2fa/policy", s.handleManagerSetTwoFactorPolicy).Methods("POST")
+	managersIdempotentRouter.HandleFunc("/sessions", s.handleManagerGetSessions).Methods("GET")
+	managersIdempotentRouter.HandleFunc("/sessions/{session:[0-9]+}", s.handleManagerRevokeSession).Methods("DELETE")
+	managersIdempotentRouter.HandleFunc("/{id:[0-9]+}/sessions", s.handleManagerGetManagerSessions).Methods("GET")
+	managersIdempotentRouter.HandleFunc("/{id:[0-9]+}/sessions/{session:[0-9]+}", s.handleManagerRevokeManagerSession).Methods("DELETE")
+	managersIdempotentRouter.HandleFunc("/phone/code", s.handleManagerSendPhoneCode).Methods("POST")
+	managersIdempotentRouter.HandleFunc("/phone/verify", s.handleManagerVerifyPhone).Methods("POST")
+	managersIdempotentRouter.HandleFunc("/sales", s.handleManagerGetSales).Methods("GET")
+	managersIdempotentRouter.HandleFunc("/sales", s.handleManagerMakeSales).Methods("POST")
+	managersIdempotentRouter.HandleFunc("/products", s.handleManagerGetProducts).Methods("GET")
+	managersIdempotentRouter.HandleFunc("/products", s.handleManagerChangeProducts).Methods("POST")
+	managersIdempotentRouter.HandleFunc("/products/{id:[0-9]+}", s.handleManagerRemoveProductByID).Methods("DELETE")
+	managersIdempotentRouter.HandleFunc("/customers", s.handleManagerGetCustomers).Methods("GET")
+	managersIdempotentRouter.HandleFunc("/customers", s.handleManagerChangeCustomer).Methods("POST")
+	managersIdempotentRouter.HandleFunc("/customers/{id:[0-9]+}", s.handleManagerRemoveCustomerByID).Methods("DELETE")
+	managersIdempotentRouter.HandleFunc("/team", s.handleManagerGetTeam).Methods("GET")
+	managersIdempotentRouter.HandleFunc("/team/sales", s.handleManagerGetTeamSales).Methods("GET")
+	managersIdempotentRouter.HandleFunc("/{id:[0-9]+}/boss", s.handleManagerSetBoss).Methods("POST")
+	managersIdempotentRouter.HandleFunc("/reports/performance", s.handleManagerGetPerformance).Methods("GET")
+	managersIdempotentRouter.HandleFunc("/audit", s.handleManagerGetAudit).Methods("GET")
+	managersIdempotentRouter.HandleFunc("/lockout/unlock", s.handleManagerUnlockLogin).Methods("POST")
+	managersIdempotentRouter.HandleFunc("/api-keys/{id:[0-9]+}", s.handleManagerRevokeAPIKey).Methods("DELETE")
+	managersIdempotentRouter.HandleFunc("/analytics/revenue", s.handleManagerGetRevenue).Methods("GET")
+	managersIdempotentRouter.HandleFunc("/analytics/products/top", s.handleManagerGetTopProducts).Methods("GET")
+	managersIdempotentRouter.HandleFunc("/analytics/basket", s.handleManagerGetBasket).Methods("GET")
+	managersIdempotentRouter.HandleFunc("/analytics/customers", s.handleManagerGetCustomerStats).Methods("GET")
+	managersIdempotentRouter.HandleFunc("/analytics/refresh", s.handleManagerRefreshAnalytics).Methods("POST")
+	managersIdempotentRouter.HandleFunc("/payroll", s.handleManagerGetPayrolls).Methods("GET")
+	managersIdempotentRouter.HandleFunc("/payroll", s.handleManagerMakePayroll).Methods("POST")
+	managersIdempotentRouter.HandleFunc("/payroll/rules", s.handleManagerGetCommissionRules).Methods("GET")
+	managersIdempotentRouter.HandleFunc("/payroll/rules", s.handleManagerChangeCommissionRules).Methods("POST")
+	managersIdempotentRouter.HandleFunc("/payroll/{id:[0-9]+}", s.handleManagerGetPayrollByID).Methods("GET")
+	managersIdempotentRouter.HandleFunc("/payroll/{id:[0-9]+}/lock", s.handleManagerLockPayroll).Methods("POST")
+	managersIdempotentRouter.HandleFunc("/reservations", s.handleManagerGetReservations).Methods("GET")
+	managersIdempotentRouter.HandleFunc("/reservations", s.handleManagerMakeReservation).Methods("POST")
+	managersIdempotentRouter.HandleFunc("/reservations/{id:[0-9]+}", s.handleManagerRemoveReservation).Methods("DELETE")
+	managersIdempotentRouter.HandleFunc("/orders", s.handleManagerGetOrders).Methods("GET")
+	managersIdempotentRouter.HandleFunc("/orders/{id:[0-9]+}", s.handleManagerGetOrderByID).Methods("GET")
+	managersIdempotentRouter.HandleFunc("/orders/{id:[0-9]+}/{action:confirm|fulfill|cancel}", s.handleManagerChangeOrderStatus).Methods("POST")
+}
+
+// decodeJSON строго разбирает и проверяет тело запроса в dst. При ошибке сам отвечает клиенту:
+// 422 с ошибками по полям, 413 для слишком большого тела, 400 для некорректного JSON
+func (s *Server) decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	err := validation.DecodeLimit(r.Body, dst, s.options.MaxBodySize)
+	if err == nil {
+		return true
+	}
+
+	var errs validation.Errors
+	switch {
+	case errors.As(err, &errs):
+		respondJSONWithCode(w, r, http.StatusUnprocessableEntity, map[string]interface{}{"errors": errs})
+	case errors.Is(err, validation.ErrBodyTooLarge):
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusRequestEntityTooLarge, err)
+	default:
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+	}
+	return false
 }
 
-func errorWriter(w http.ResponseWriter, httpSts int, err error) {
-	log.Print(err)
+func errorWriter(w http.ResponseWriter, r *http.Request, httpSts int, err error) {
+	logger.Error(r.Context(), err, "status", httpSts)
 	http.Error(w, http.StatusText(httpSts), httpSts)
 }
 
-func respondJSON(w http.ResponseWriter, iData interface{}) {
+func respondJSON(w http.ResponseWriter, r *http.Request, iData interface{}) {
 	data, err := json.Marshal(iData)
 
 	if err != nil {
-		errorWriter(w, http.StatusInternalServerError, err)
+		errorWriter(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	_, err = w.Write(data)
 	if err != nil {
-		log.Print(err)
+		logger.Error(r.Context(), err)
 	}
 }
 
-func respondJSONWithCode(w http.ResponseWriter, sts int, iData interface{}) {
+func respondJSONWithCode(w http.ResponseWriter, r *http.Request, sts int, iData interface{}) {
 	data, err := json.Marshal(iData)
 
 	if err != nil {
-		errorWriter(w, http.StatusInternalServerError, err)
+		errorWriter(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -101,6 +279,6 @@ func respondJSONWithCode(w http.ResponseWriter, sts int, iData interface{}) {
 
 	_, err = w.Write(data)
 	if err != nil {
-		log.Print(err)
+		logger.Error(r.Context(), err)
 	}
 }
@@ -0,0 +1,1592 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KarrenAeris/crud/cmd/app/middleware"
+	"github.com/KarrenAeris/crud/pkg/analytics"
+	"github.com/KarrenAeris/crud/pkg/apikeys"
+	"github.com/KarrenAeris/crud/pkg/audit"
+	"github.com/KarrenAeris/crud/pkg/customers"
+	"github.com/KarrenAeris/crud/pkg/idempotency"
+	"github.com/KarrenAeris/crud/pkg/jwt"
+	"github.com/KarrenAeris/crud/pkg/lockout"
+	"github.com/KarrenAeris/crud/pkg/logger"
+	"github.com/KarrenAeris/crud/pkg/managers"
+	"github.com/KarrenAeris/crud/pkg/orders"
+	"github.com/KarrenAeris/crud/pkg/payroll"
+	"github.com/KarrenAeris/crud/pkg/reports"
+	"github.com/KarrenAeris/crud/pkg/reservations"
+	"github.com/KarrenAeris/crud/pkg/sessions"
+	"github.com/KarrenAeris/crud/pkg/store/memory"
+	"github.com/KarrenAeris/crud/pkg/totp"
+	"github.com/KarrenAeris/crud/pkg/types"
+	"github.com/KarrenAeris/crud/pkg/utils"
+	"github.com/KarrenAeris/crud/pkg/validation"
+	"github.com/KarrenAeris/crud/pkg/verification"
+	gojwt "github.com/golang-jwt/jwt/v4"
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestMain(m *testing.M) {
+	logger.SetOutput(ioutil.Discard)
+	log.SetOutput(ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+// testServer - сервер поверх хранилища в памяти. Сервисы заказов, резервов, отчётов, ведомостей,
+// аналитики и журнала работают только с Postgres, поэтому для их маршрутов проверяются лишь
+// аутентификация и права - до обращения к БД эти обработчики не доходят
+type testServer struct {
+	t     *testing.T
+	srv   *Server
+	store *memory.Store
+	sms   *testSender
+
+	adminID    int64
+	adminToken string
+
+	managerID    int64
+	managerToken string
+}
+
+// testOptions - настройки сервера в тестах: фронтенд работает с другого источника
+var testOptions = Options{
+	CORS: middleware.CORSConfig{
+		AllowedOrigins:   []string{"https://shop.example.com"},
+		AllowedMethods:   []string{"GET", "POST", "DELETE"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	},
+}
+
+func newTestServer(t *testing.T) *testServer {
+	return newTestServerWithSigner(t, nil)
+}
+
+// newTestServerWithSigner создаёт сервер с подписанными токенами доступа (signer nil - токены в БД)
+func newTestServerWithSigner(t *testing.T, signer *jwt.Signer) *testServer {
+	// без пауз после ошибки входа, иначе неверный пароль в тесте мешал бы следующему входу
+	phonePolicy := lockout.PhonePolicy
+	phonePolicy.BaseDelay = 0
+	return newTestServerWith(t, testOptions, phonePolicy, lockout.IPPolicy, signer)
+}
+
+// newTestServerWithPolicy создаёт сервер с заданными ограничениями входа по телефону и по IP
+func newTestServerWithPolicy(t *testing.T, phonePolicy, ipPolicy lockout.Policy) *testServer {
+	return newTestServerWith(t, testOptions, phonePolicy, ipPolicy, nil)
+}
+
+func newTestServerWith(t *testing.T, opts Options, phonePolicy, ipPolicy lockout.Policy, signer *jwt.Signer) *testServer {
+	st := memory.NewStore()
+
+	lockoutSvc := lockout.NewService(lockout.NewMemoryStore(), phonePolicy, ipPolicy)
+	customerSvc := customers.NewService(st, nil, lockoutSvc, signer)
+	managerSvc := managers.NewService(st, nil, lockoutSvc, signer)
+	reservationSvc := reservations.NewService(nil, time.Minute)
+	sender := &testSender{messages: make(map[string]string)}
+
+	srv := NewServer(
+		opts,
+		mux.NewRouter(),
+		customerSvc,
+		managerSvc,
+		orders.NewService(nil, managerSvc, reservationSvc),
+		reservationSvc,
+		idempotency.NewService(nil, time.Hour),
+		reports.NewService(nil),
+		payroll.NewService(nil),
+		analytics.NewService(nil),
+		audit.NewService(nil),
+		verification.NewService(st, sender, lockoutSvc, time.Minute),
+		lockoutSvc,
+		apikeys.NewService(st, nil),
+		sessions.NewService(st, nil),
+	)
+	srv.Init()
+
+	ts := &testServer{t: t, srv: srv, store: st, sms: sender}
+	ts.adminID, ts.adminToken = ts.seedManager("admin", "+70000000001", "secret", true)
+	ts.managerID, ts.managerToken = ts.seedManager("manager", "+70000000002", "secret", false)
+	return ts
+}
+
+// seedManager заводит продавца с паролем и токеном напрямую в хранилище
+func (ts *testServer) seedManager(name, phone, password string, isAdmin bool) (int64, string) {
+	ctx := context.Background()
+
+	id, err := ts.store.CreateManager(ctx, &types.Manager{Name: name, Phone: phone, IsAdmin: isAdmin})
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	if err = ts.store.SetManagerPassword(id, string(hash)); err != nil {
+		ts.t.Fatal(err)
+	}
+	token := name + "-token"
+	if err = ts.store.SaveManagerToken(ctx, utils.HashToken(token), id, types.Device{}); err != nil {
+		ts.t.Fatal(err)
+	}
+	return id, token
+}
+
+// testSender запоминает последнее SMS на каждый номер
+type testSender struct {
+	mu       sync.Mutex
+	messages map[string]string
+}
+
+func (s *testSender) Send(ctx context.Context, phone, text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages[phone] = text
+	return nil
+}
+
+// code возвращает код из последнего SMS на номер
+func (s *testSender) code(phone string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	text := s.messages[phone]
+	return text[strings.LastIndex(text, " ")+1:]
+}
+
+func (ts *testServer) do(method, path, token, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		request.Header.Set("Authorization", token)
+	}
+	recorder := httptest.NewRecorder()
+	ts.srv.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// doAPIKey выполняет запрос с ключом API
+func (ts *testServer) doAPIKey(method, path, key, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set(middleware.APIKeyHeader, key)
+	recorder := httptest.NewRecorder()
+	ts.srv.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// expect выполняет запрос, проверяет статус и разбирает JSON ответа в result (если не nil)
+func (ts *testServer) expect(method, path, token, body string, status int, result interface{}) {
+	ts.t.Helper()
+
+	recorder := ts.do(method, path, token, body)
+	if recorder.Code != status {
+		ts.t.Fatalf("%s %s: status = %d, want %d, body: %s", method, path, recorder.Code, status, recorder.Body.String())
+	}
+	if result != nil {
+		if err := json.Unmarshal(recorder.Body.Bytes(), result); err != nil {
+			ts.t.Fatalf("%s %s: invalid JSON %q: %v", method, path, recorder.Body.String(), err)
+		}
+	}
+}
+
+type route struct {
+	method string
+	path   string
+}
+
+// маршруты, доступные без токена
+var publicRoutes = []route{
+	{"POST", "/api/customers"},
+	{"POST", "/api/customers/token"},
+	{"POST", "/api/customers/token/refresh"},
+	{"POST", "/api/customers/password/forgot"},
+	{"POST", "/api/customers/password/reset"},
+	{"GET", "/api/customers/products"},
+	{"POST", "/api/managers/token"},
+	{"POST", "/api/managers/token/refresh"},
+	{"POST", "/api/managers/token/2fa"},
+	{"POST", "/api/managers/password/forgot"},
+	{"POST", "/api/managers/password/reset"},
+	{"GET", "/api/managers/products"},
+	{"GET", "/metrics"},
+}
+
+// маршруты, требующие токен
+var protectedRoutes = []route{
+	{"GET", "/api/customers/cart"},
+	{"POST", "/api/customers/cart"},
+	{"DELETE", "/api/customers/cart/1"},
+	{"GET", "/api/customers/orders"},
+	{"POST", "/api/customers/orders"},
+	{"GET", "/api/customers/orders/1"},
+	{"POST", "/api/customers/orders/1/cancel"},
+	{"POST", "/api/customers/phone/code"},
+	{"POST", "/api/customers/phone/verify"},
+	{"GET", "/api/customers/sessions"},
+	{"DELETE", "/api/customers/sessions/1"},
+
+	{"POST", "/api/managers"},
+	{"POST", "/api/managers/phone/code"},
+	{"POST", "/api/managers/phone/verify"},
+	{"POST", "/api/managers/2fa/enroll"},
+	{"POST", "/api/managers/2fa/confirm"},
+	{"POST", "/api/managers/2fa/disable"},
+	{"POST", "/api/managers/2fa/policy"},
+	{"GET", "/api/managers/sessions"},
+	{"DELETE", "/api/managers/sessions/1"},
+	{"GET", "/api/managers/1/sessions"},
+	{"DELETE", "/api/managers/1/sessions/1"},
+	{"GET", "/api/managers/sales"},
+	{"POST", "/api/managers/sales"},
+	{"POST", "/api/managers/products"},
+	{"DELETE", "/api/managers/products/1"},
+	{"GET", "/api/managers/customers"},
+	{"POST", "/api/managers/customers"},
+	{"DELETE", "/api/managers/customers/1"},
+	{"GET", "/api/managers/team"},
+	{"GET", "/api/managers/team/sales"},
+	{"POST", "/api/managers/1/boss"},
+	{"GET", "/api/managers/reports/performance"},
+	{"GET", "/api/managers/audit"},
+	{"POST", "/api/managers/lockout/unlock"},
+	{"GET", "/api/managers/api-keys"},
+	{"POST", "/api/managers/api-keys"},
+	{"DELETE", "/api/managers/api-keys/1"},
+	{"GET", "/api/managers/analytics/revenue"},
+	{"GET", "/api/managers/analytics/products/top"},
+	{"GET", "/api/managers/analytics/basket"},
+	{"GET", "/api/managers/analytics/customers"},
+	{"POST", "/api/managers/analytics/refresh"},
+	{"GET", "/api/managers/payroll"},
+	{"POST", "/api/managers/payroll"},
+	{"GET", "/api/managers/payroll/rules"},
+	{"POST", "/api/managers/payroll/rules"},
+	{"GET", "/api/managers/payroll/1"},
+	{"POST", "/api/managers/payroll/1/lock"},
+	{"GET", "/api/managers/reservations"},
+	{"POST", "/api/managers/reservations"},
+	{"DELETE", "/api/managers/reservations/1"},
+	{"GET", "/api/managers/orders"},
+	{"GET", "/api/managers/orders/1"},
+	{"POST", "/api/managers/orders/1/confirm"},
+	{"POST", "/api/managers/orders/1/fulfill"},
+	{"POST", "/api/managers/orders/1/cancel"},
+}
+
+// маршруты только для админа
+var adminRoutes = []route{
+	{"POST", "/api/managers"},
+	{"POST", "/api/managers/1/boss"},
+	{"GET", "/api/managers/audit"},
+	{"POST", "/api/managers/lockout/unlock"},
+	{"GET", "/api/managers/api-keys"},
+	{"POST", "/api/managers/api-keys"},
+	{"DELETE", "/api/managers/api-keys/1"},
+	{"POST", "/api/managers/2fa/policy"},
+	{"GET", "/api/managers/1/sessions"},
+	{"DELETE", "/api/managers/1/sessions/1"},
+	{"GET", "/api/managers/analytics/revenue"},
+	{"GET", "/api/managers/analytics/products/top"},
+	{"GET", "/api/managers/analytics/basket"},
+	{"GET", "/api/managers/analytics/customers"},
+	{"POST", "/api/managers/analytics/refresh"},
+	{"POST", "/api/managers/payroll"},
+	{"GET", "/api/managers/payroll/rules"},
+	{"POST", "/api/managers/payroll/rules"},
+	{"GET", "/api/managers/payroll/1"},
+	{"POST", "/api/managers/payroll/1/lock"},
+}
+
+// TestRoutesCovered не даёт добавить маршрут в Init, не добавив его в таблицы выше
+func TestRoutesCovered(t *testing.T) {
+	ts := newTestServer(t)
+
+	known := make(map[string]bool)
+	for _, r := range append(publicRoutes, protectedRoutes...) {
+		known[r.method+" "+r.path] = true
+	}
+
+	err := ts.srv.mux.Walk(func(r *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		methods, err := r.GetMethods()
+		if err != nil {
+			// префиксы подроутеров без методов
+			return nil
+		}
+		for _, method := range methods {
+			for _, path := range samplePaths(t, r) {
+				request := httptest.NewRequest(method, path, nil)
+				var match mux.RouteMatch
+				if !r.Match(request, &match) {
+					t.Errorf("route %s %s: sample path %s does not match", method, path, path)
+				}
+				if !known[method+" "+path] {
+					t.Errorf("route %s %s is not covered by the test tables", method, path)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// samplePaths подставляет в шаблон маршрута значения переменных
+func samplePaths(t *testing.T, r *mux.Route) []string {
+	template, err := r.GetPathTemplate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(template, "{action:") {
+		paths := make([]string, 0)
+		for _, action := range []string{"confirm", "fulfill", "cancel"} {
+			paths = append(paths, strings.Replace(strings.Replace(template, "{id:[0-9]+}", "1", 1),
+				"{action:confirm|fulfill|cancel}", action, 1))
+		}
+		return paths
+	}
+	return []string{strings.Replace(strings.Replace(template, "{id:[0-9]+}", "1", 1), "{session:[0-9]+}", "1", 1)}
+}
+
+func TestProtectedRoutesRequireToken(t *testing.T) {
+	ts := newTestServer(t)
+
+	for _, r := range protectedRoutes {
+		for _, token := range []string{"", "unknown-token"} {
+			recorder := ts.do(r.method, r.path, token, `{}`)
+			if recorder.Code != http.StatusForbidden {
+				t.Errorf("%s %s with token %q: status = %d, want %d", r.method, r.path, token, recorder.Code, http.StatusForbidden)
+			}
+		}
+	}
+}
+
+func TestAdminRoutesForbidManagers(t *testing.T) {
+	ts := newTestServer(t)
+
+	for _, r := range adminRoutes {
+		recorder := ts.do(r.method, r.path, ts.managerToken, `{}`)
+		if recorder.Code != http.StatusForbidden {
+			t.Errorf("%s %s: status = %d, want %d", r.method, r.path, recorder.Code, http.StatusForbidden)
+		}
+	}
+}
+
+func TestUnknownRoute(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.expect("GET", "/api/unknown", "", "", http.StatusNotFound, nil)
+	ts.expect("PUT", "/api/managers/products", ts.adminToken, "", http.StatusMethodNotAllowed, nil)
+}
+
+func TestCORSAndSecurityHeaders(t *testing.T) {
+	ts := newTestServer(t)
+	const origin = "https://shop.example.com"
+
+	send := func(method, path string, headers map[string]string, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		for key, value := range headers {
+			request.Header.Set(key, value)
+		}
+		recorder := httptest.NewRecorder()
+		ts.srv.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	// предварительный запрос не доходит до маршрутов, у которых нет OPTIONS
+	recorder := send("OPTIONS", "/api/managers/products", map[string]string{
+		"Origin":                         origin,
+		"Access-Control-Request-Method":  "POST",
+		"Access-Control-Request-Headers": "authorization,content-type",
+	}, "")
+	if recorder.Code != http.StatusNoContent ||
+		recorder.Header().Get("Access-Control-Allow-Origin") != origin ||
+		recorder.Header().Get("Access-Control-Allow-Credentials") != "true" ||
+		recorder.Header().Get("Access-Control-Allow-Methods") != "GET, POST, DELETE" ||
+		recorder.Header().Get("Access-Control-Allow-Headers") != "Authorization, Content-Type" ||
+		recorder.Header().Get("Access-Control-Max-Age") != "600" {
+		t.Fatalf("preflight: status = %d, headers = %v", recorder.Code, recorder.Header())
+	}
+	for _, headers := range []map[string]string{
+		{"Origin": "https://evil.example.com", "Access-Control-Request-Method": "POST"},
+		{"Origin": origin, "Access-Control-Request-Method": "PUT"},
+	} {
+		if recorder = send("OPTIONS", "/api/managers/products", headers, ""); recorder.Code != http.StatusForbidden {
+			t.Errorf("preflight %v: status = %d, want %d", headers, recorder.Code, http.StatusForbidden)
+		}
+	}
+
+	recorder = send("GET", "/api/managers/products", map[string]string{"Origin": origin}, "")
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Access-Control-Allow-Origin") != origin {
+		t.Fatalf("allowed origin: status = %d, headers = %v", recorder.Code, recorder.Header())
+	}
+	recorder = send("GET", "/api/managers/products", map[string]string{"Origin": "https://evil.example.com"}, "")
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("other origin: status = %d, headers = %v", recorder.Code, recorder.Header())
+	}
+
+	// заголовки безопасности - на всех ответах, HSTS - только по HTTPS
+	recorder = send("GET", "/api/unknown", nil, "")
+	if recorder.Header().Get("X-Content-Type-Options") != "nosniff" || recorder.Header().Get("X-Frame-Options") != "DENY" ||
+		recorder.Header().Get("Cache-Control") != "no-store" || recorder.Header().Get("Strict-Transport-Security") != "" {
+		t.Fatalf("security headers = %v", recorder.Header())
+	}
+
+	// тело больше лимита отклоняется по Content-Length, а без длины - при чтении, в том числе идемпотентностью
+	large := `{"name":"` + strings.Repeat("a", validation.MaxBodySize) + `"}`
+	recorder = send("POST", "/api/customers", nil, large)
+	if recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("large body: status = %d", recorder.Code)
+	}
+	request := httptest.NewRequest("POST", "/api/customers", ioutil.NopCloser(strings.NewReader(large)))
+	request.Header.Set(middleware.IdempotencyKeyHeader, "large")
+	request.ContentLength = -1
+	recorder = httptest.NewRecorder()
+	ts.srv.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("large body without length: status = %d", recorder.Code)
+	}
+
+	// разбор тела следует настроенному лимиту, а не validation.MaxBodySize
+	opts := testOptions
+	opts.MaxBodySize = 2 * validation.MaxBodySize
+	large = `{"name":"` + strings.Repeat("a", validation.MaxBodySize) + `","phone":"+992000000077","password":"secret"}`
+	recorder = httptest.NewRecorder()
+	newTestServerWith(t, opts, lockout.PhonePolicy, lockout.IPPolicy, nil).srv.ServeHTTP(recorder, httptest.NewRequest("POST", "/api/customers", strings.NewReader(large)))
+	if recorder.Code == http.StatusRequestEntityTooLarge {
+		t.Fatalf("body under configured limit: status = %d", recorder.Code)
+	}
+
+	// любой источник нельзя сочетать с учётными данными, без них отдаётся буквальный "*"
+	cors := testOptions.CORS
+	cors.AllowedOrigins = []string{"*"}
+	if err := cors.Validate(); err != middleware.ErrCORSWildcardCredentials {
+		t.Fatalf("wildcard with credentials: err = %v", err)
+	}
+	cors.AllowCredentials = false
+	request = httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("Origin", "https://evil.example.com")
+	recorder = httptest.NewRecorder()
+	middleware.CORS(cors)(http.NotFoundHandler()).ServeHTTP(recorder, request)
+	if recorder.Header().Get("Access-Control-Allow-Origin") != "*" || recorder.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Fatalf("wildcard: headers = %v", recorder.Header())
+	}
+}
+
+func TestManagerClientCert(t *testing.T) {
+	opts := testOptions
+	opts.ManagerClientCert = true
+	phonePolicy := lockout.PhonePolicy
+	phonePolicy.BaseDelay = 0
+	ts := newTestServerWith(t, opts, phonePolicy, lockout.IPPolicy, nil)
+
+	send := func(path, token string, state *tls.ConnectionState) int {
+		request := httptest.NewRequest("GET", path, nil)
+		request.Header.Set("Authorization", token)
+		request.TLS = state
+		recorder := httptest.NewRecorder()
+		ts.srv.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	verified := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}
+	// без сертификата клиента API продавцов закрыт даже с верным токеном, API покупателей - нет
+	for _, state := range []*tls.ConnectionState{nil, {}} {
+		if code := send("/api/managers/sales", ts.managerToken, state); code != http.StatusForbidden {
+			t.Errorf("manager without client certificate: status = %d", code)
+		}
+	}
+	if code := send("/api/managers/sales", ts.managerToken, verified); code != http.StatusOK {
+		t.Errorf("manager with client certificate: status = %d", code)
+	}
+	if code := send("/api/customers/products", "", nil); code != http.StatusOK {
+		t.Errorf("customer without client certificate: status = %d", code)
+	}
+}
+
+// TestIdempotencySkipsCredentials проверяет, что вход и выдача секретов идут мимо ключей идемпотентности:
+// их ответы не сохраняются (хранилище ключей в тестах - Postgres без пула, обращение к нему упало бы)
+func TestIdempotencySkipsCredentials(t *testing.T) {
+	ts := newTestServer(t)
+
+	send := func(method, path, token, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set("Authorization", token)
+		request.Header.Set(middleware.IdempotencyKeyHeader, "retry-1")
+		recorder := httptest.NewRecorder()
+		ts.srv.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	expire := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	for _, r := range []struct {
+		method, path, token, body string
+		status                    int
+	}{
+		{"POST", "/api/customers", "", `{"name":"Vasya","phone":"+79000000001","password":"pass"}`, http.StatusOK},
+		{"POST", "/api/customers/token", "", `{"login":"+79000000001","password":"pass"}`, http.StatusOK},
+		{"POST", "/api/managers/token", "", `{"phone":"+70000000002","password":"secret"}`, http.StatusOK},
+		{"POST", "/api/managers/2fa/enroll", ts.managerToken, "", http.StatusOK},
+		{"POST", "/api/managers/api-keys", ts.adminToken, `{"name":"warehouse","scopes":["products:read"],"expire":"` + expire + `"}`, http.StatusOK},
+		// без аутентификации ключ не используется: анонимные клиенты не делят одно пространство ключей
+		{"POST", "/api/customers/cart", "", `{}`, http.StatusForbidden},
+	} {
+		if recorder := send(r.method, r.path, r.token, r.body); recorder.Code != r.status {
+			t.Errorf("%s %s: status = %d, want %d, body: %s", r.method, r.path, recorder.Code, r.status, recorder.Body.String())
+		}
+	}
+}
+
+func TestCustomerRegistrationAndToken(t *testing.T) {
+	ts := newTestServer(t)
+
+	var customer customers.Customer
+	ts.expect("POST", "/api/customers", "", `{"name":"Vasya","phone":"+79000000001","password":"pass"}`, http.StatusOK, &customer)
+	if customer.ID == 0 || customer.Name != "Vasya" || !customer.Active {
+		t.Fatalf("unexpected customer %+v", customer)
+	}
+	if customer.Password == "pass" {
+		t.Fatal("password must be stored hashed")
+	}
+
+	ts.expect("POST", "/api/customers", "", `{"name":`, http.StatusBadRequest, nil)
+	// телефон уникален
+	ts.expect("POST", "/api/customers", "", `{"name":"Petya","phone":"+79000000001","password":"pass"}`, http.StatusInternalServerError, nil)
+
+	var result struct {
+		Status string `json:"status"`
+		Token  string `json:"token"`
+	}
+	ts.expect("POST", "/api/customers/token", "", `{"login":"+79000000001","password":"pass"}`, http.StatusOK, &result)
+	if result.Status != "ok" || result.Token == "" {
+		t.Fatalf("unexpected token response %+v", result)
+	}
+	id, err := ts.store.CustomerIDByToken(context.Background(), utils.HashToken(result.Token))
+	if err != nil || id != customer.ID {
+		t.Fatalf("token belongs to %d (%v), want %d", id, err, customer.ID)
+	}
+	// в хранилище только хеш токена
+	if _, err = ts.store.CustomerIDByToken(context.Background(), result.Token); err != types.ErrNotFound {
+		t.Fatalf("plaintext token is stored: %v", err)
+	}
+	ts.expect("GET", "/api/customers/cart", utils.HashToken(result.Token), "", http.StatusForbidden, nil)
+
+	ts.expect("POST", "/api/customers/token", "", `{"login":"+79000000001","password":"wrong"}`, http.StatusBadRequest, nil)
+	ts.expect("POST", "/api/customers/token", "", `{"login":"+79999999999","password":"pass"}`, http.StatusBadRequest, nil)
+	ts.expect("POST", "/api/customers/token", "", `not json`, http.StatusBadRequest, nil)
+}
+
+func TestSessions(t *testing.T) {
+	ts := newTestServer(t)
+
+	login := func(path, body, userAgent string) string {
+		t.Helper()
+		request := httptest.NewRequest("POST", path, strings.NewReader(body))
+		request.Header.Set("User-Agent", userAgent)
+		recorder := httptest.NewRecorder()
+		ts.srv.ServeHTTP(recorder, request)
+		var result types.AuthTokens
+		if err := json.Unmarshal(recorder.Body.Bytes(), &result); recorder.Code != http.StatusOK || err != nil {
+			t.Fatalf("login: status = %d, body: %s", recorder.Code, recorder.Body.String())
+		}
+		return result.Token
+	}
+
+	ts.expect("POST", "/api/customers", "", `{"name":"Vasya","phone":"+79000000001","password":"pass"}`, http.StatusOK, nil)
+	phone := login("/api/customers/token", `{"login":"+79000000001","password":"pass"}`, "phone-app/1.0")
+	laptop := login("/api/customers/token", `{"login":"+79000000001","password":"pass"}`, "laptop-browser")
+
+	var items []*types.Session
+	ts.expect("GET", "/api/customers/sessions", "Bearer "+laptop, "", http.StatusOK, &items)
+	if len(items) != 2 {
+		t.Fatalf("sessions = %d, want 2", len(items))
+	}
+	var current, other *types.Session
+	for _, item := range items {
+		if item.Current {
+			current = item
+		} else {
+			other = item
+		}
+	}
+	if current == nil || other == nil || current.UserAgent != "laptop-browser" || other.UserAgent != "phone-app/1.0" || current.IP != "192.0.2.1" {
+		t.Fatalf("unexpected sessions %+v %+v", current, other)
+	}
+
+	// продавец не видит и не завершает сессии покупателя
+	ts.expect("DELETE", "/api/managers/sessions/"+strconv.FormatInt(other.ID, 10), ts.managerToken, "", http.StatusNotFound, nil)
+
+	ts.expect("DELETE", "/api/customers/sessions/"+strconv.FormatInt(other.ID, 10), laptop, "", http.StatusOK, nil)
+	ts.expect("GET", "/api/customers/cart", phone, "", http.StatusForbidden, nil)
+	ts.expect("POST", "/api/customers/phone/code", laptop, "", http.StatusOK, nil)
+	ts.expect("DELETE", "/api/customers/sessions/"+strconv.FormatInt(other.ID, 10), laptop, "", http.StatusNotFound, nil)
+
+	// админ видит и завершает сессии любого продавца
+	managerPath := "/api/managers/" + strconv.FormatInt(ts.managerID, 10) + "/sessions"
+	ts.expect("GET", managerPath, ts.adminToken, "", http.StatusOK, &items)
+	if len(items) != 1 || items[0].UserID != ts.managerID || items[0].Current {
+		t.Fatalf("unexpected manager sessions %+v", items)
+	}
+	ts.expect("GET", "/api/managers/999/sessions", ts.adminToken, "", http.StatusNotFound, nil)
+	ts.expect("DELETE", "/api/managers/"+strconv.FormatInt(ts.adminID, 10)+"/sessions/"+strconv.FormatInt(items[0].ID, 10), ts.adminToken, "", http.StatusNotFound, nil)
+	ts.expect("DELETE", managerPath+"/"+strconv.FormatInt(items[0].ID, 10), ts.adminToken, "", http.StatusOK, nil)
+	ts.expect("GET", "/api/managers/sessions", ts.managerToken, "", http.StatusForbidden, nil)
+	ts.expect("GET", "/api/managers/sessions", ts.adminToken, "", http.StatusOK, &items)
+	if len(items) != 1 || !items[0].Current {
+		t.Fatalf("unexpected admin sessions %+v", items)
+	}
+}
+
+func TestPhoneNormalization(t *testing.T) {
+	ts := newTestServer(t)
+
+	var customer customers.Customer
+	ts.expect("POST", "/api/customers", "", `{"name":"Vasya","phone":"992 900 000 123","password":"pass"}`, http.StatusOK, &customer)
+	if customer.Phone != "+992900000123" {
+		t.Fatalf("phone = %q, want +992900000123", customer.Phone)
+	}
+	// тот же номер в другой записи - тот же покупатель
+	ts.expect("POST", "/api/customers", "", `{"name":"Petya","phone":"00992-900-000-123","password":"pass"}`, http.StatusInternalServerError, nil)
+	for _, login := range []string{"+992900000123", "992 900 000 123", "+992 (900) 00-01-23"} {
+		ts.expect("POST", "/api/customers/token", "", `{"login":"`+login+`","password":"pass"}`, http.StatusOK, nil)
+	}
+	ts.expect("POST", "/api/customers/token", "", `{"login":"not a phone","password":"pass"}`, http.StatusBadRequest, nil)
+
+	ts.expect("POST", "/api/managers", ts.adminToken, `{"name":"Ivan","phone":"992 900 000 124"}`, http.StatusOK, nil)
+	id, _, err := ts.store.ManagerCredentials(context.Background(), "+992900000124")
+	if err != nil {
+		t.Fatalf("manager is not stored in E.164: %v", err)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ts.store.SetManagerPassword(id, string(hash)); err != nil {
+		t.Fatal(err)
+	}
+	ts.expect("POST", "/api/managers/token", "", `{"phone":"00 992 900 000 124","password":"secret"}`, http.StatusOK, nil)
+	ts.expect("POST", "/api/managers", ts.adminToken, `{"name":"Oleg","phone":"+992900000124"}`, http.StatusConflict, nil)
+}
+
+func TestPhoneVerification(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+
+	var customer customers.Customer
+	ts.expect("POST", "/api/customers", "", `{"name":"Vasya","phone":"+79000000001","password":"pass"}`, http.StatusOK, &customer)
+	if customer.Verified {
+		t.Fatal("new phone must not be verified")
+	}
+	var result struct {
+		Token string `json:"token"`
+	}
+	ts.expect("POST", "/api/customers/token", "", `{"login":"+79000000001","password":"pass"}`, http.StatusOK, &result)
+
+	// кода ещё нет
+	ts.expect("POST", "/api/customers/phone/verify", result.Token, `{"code":"123456"}`, http.StatusBadRequest, nil)
+
+	ts.expect("POST", "/api/customers/phone/code", result.Token, "", http.StatusOK, nil)
+	code := ts.sms.code("+79000000001")
+	if len(code) != 6 {
+		t.Fatalf("unexpected code %q", code)
+	}
+	// повторно не раньше чем через verification.ResendInterval
+	ts.expect("POST", "/api/customers/phone/code", result.Token, "", http.StatusTooManyRequests, nil)
+
+	ts.expect("POST", "/api/customers/phone/verify", result.Token, `{"code":"`+wrongCode(code)+`"}`, http.StatusBadRequest, nil)
+	ts.expect("POST", "/api/customers/phone/verify", result.Token, `{}`, http.StatusUnprocessableEntity, nil)
+	ts.expect("POST", "/api/customers/phone/verify", result.Token, `{"code":"`+code+`"}`, http.StatusOK, nil)
+
+	stored, err := ts.store.CustomerByID(ctx, customer.ID)
+	if err != nil || !stored.Verified {
+		t.Fatalf("phone is not verified: %+v, %v", stored, err)
+	}
+	// код одноразовый
+	ts.expect("POST", "/api/customers/phone/verify", result.Token, `{"code":"`+code+`"}`, http.StatusBadRequest, nil)
+	ts.expect("POST", "/api/customers/phone/code", result.Token, "", http.StatusConflict, nil)
+
+	// смена телефона снимает подтверждение
+	body := `{"id":` + strconv.FormatInt(customer.ID, 10) + `,"name":"Vasya","phone":"+79000000002","active":true}`
+	ts.expect("POST", "/api/managers/customers", ts.managerToken, body, http.StatusOK, nil)
+	stored, err = ts.store.CustomerByID(ctx, customer.ID)
+	if err != nil || stored.Verified {
+		t.Fatalf("changed phone must not be verified: %+v, %v", stored, err)
+	}
+
+	// продавец подтверждает телефон так же; после verification.MaxAttempts ошибок код не принимается
+	ts.expect("POST", "/api/managers/phone/code", ts.managerToken, "", http.StatusOK, nil)
+	code = ts.sms.code("+70000000002")
+	for i := 0; i < verification.MaxAttempts; i++ {
+		ts.expect("POST", "/api/managers/phone/verify", ts.managerToken, `{"code":"`+wrongCode(code)+`"}`, http.StatusBadRequest, nil)
+	}
+	ts.expect("POST", "/api/managers/phone/verify", ts.managerToken, `{"code":"`+code+`"}`, http.StatusTooManyRequests, nil)
+
+	manager, err := ts.store.ManagerByID(ctx, ts.managerID)
+	if err != nil || manager.Verified {
+		t.Fatalf("manager phone must not be verified: %+v, %v", manager, err)
+	}
+
+	// параллельные запросы не получают лишних попыток
+	ts.expect("POST", "/api/managers/phone/code", ts.adminToken, "", http.StatusOK, nil)
+	code = ts.sms.code("+70000000001")
+	codes := make(chan int, 20)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(codes); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- ts.do("POST", "/api/managers/phone/verify", ts.adminToken, `{"code":"`+wrongCode(code)+`"}`).Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	checked := 0
+	for status := range codes {
+		if status == http.StatusBadRequest {
+			checked++
+		}
+	}
+	if checked != verification.MaxAttempts {
+		t.Fatalf("%d codes checked, want %d", checked, verification.MaxAttempts)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+
+	ts.expect("POST", "/api/customers", "", `{"name":"Vasya","phone":"+79000000001","password":"old"}`, http.StatusOK, nil)
+	var result struct {
+		Token string `json:"token"`
+	}
+	ts.expect("POST", "/api/customers/token", "", `{"login":"+79000000001","password":"old"}`, http.StatusOK, &result)
+
+	// по ответу не видно, зарегистрирован ли номер
+	ts.expect("POST", "/api/customers/password/forgot", "", `{"phone":"+79999999999"}`, http.StatusOK, nil)
+	if _, ok := ts.sms.messages["+79999999999"]; ok {
+		t.Fatal("code sent to unknown phone")
+	}
+	ts.expect("POST", "/api/customers/password/forgot", "", `{"phone":"7 900 000 00 01"}`, http.StatusOK, nil)
+	code := ts.sms.code("+79000000001")
+
+	ts.expect("POST", "/api/customers/password/reset", "", `{"phone":"+79000000001","code":"`+wrongCode(code)+`","password":"new"}`, http.StatusBadRequest, nil)
+	ts.expect("POST", "/api/customers/password/reset", "", `{"phone":"+79999999999","code":"`+code+`","password":"new"}`, http.StatusBadRequest, nil)
+	ts.expect("POST", "/api/customers/password/reset", "", `{"phone":"+79000000001","code":"`+code+`"}`, http.StatusUnprocessableEntity, nil)
+	ts.expect("POST", "/api/customers/password/reset", "", `{"phone":"+79000000001","code":"`+code+`","password":"new"}`, http.StatusOK, nil)
+
+	// старые токены отозваны, работает только новый пароль
+	if _, err := ts.store.CustomerIDByToken(ctx, utils.HashToken(result.Token)); err != types.ErrNotFound {
+		t.Fatalf("token is not revoked: %v", err)
+	}
+	ts.expect("GET", "/api/customers/cart", result.Token, "", http.StatusForbidden, nil)
+	ts.expect("POST", "/api/customers/token", "", `{"login":"+79000000001","password":"old"}`, http.StatusBadRequest, nil)
+	ts.expect("POST", "/api/customers/token", "", `{"login":"+79000000001","password":"new"}`, http.StatusOK, nil)
+
+	// код действует один раз
+	ts.expect("POST", "/api/customers/password/reset", "", `{"phone":"+79000000001","code":"`+code+`","password":"again"}`, http.StatusBadRequest, nil)
+
+	ts.expect("POST", "/api/managers/password/forgot", "", `{"phone":"+70000000002"}`, http.StatusOK, nil)
+	code = ts.sms.code("+70000000002")
+	ts.expect("POST", "/api/managers/password/reset", "", `{"phone":"+70000000002","code":"`+code+`","password":"new"}`, http.StatusOK, nil)
+	ts.expect("GET", "/api/managers/sales", ts.managerToken, "", http.StatusForbidden, nil)
+	ts.expect("POST", "/api/managers/token", "", `{"phone":"+70000000002","password":"secret"}`, http.StatusBadRequest, nil)
+	ts.expect("POST", "/api/managers/token", "", `{"phone":"+70000000002","password":"new"}`, http.StatusOK, nil)
+	// коды покупателя и продавца не пересекаются
+	ts.expect("POST", "/api/customers/password/reset", "", `{"phone":"+70000000002","code":"`+code+`","password":"new"}`, http.StatusBadRequest, nil)
+}
+
+// TestPasswordResetConcurrent проверяет, что параллельные запросы не получают лишних попыток
+// и что верный код срабатывает только один раз
+func TestPasswordResetConcurrent(t *testing.T) {
+	ts := newTestServer(t)
+	ts.expect("POST", "/api/customers", "", `{"name":"Vasya","phone":"+79000000001","password":"old"}`, http.StatusOK, nil)
+
+	parallel := func(n int, body string) map[int]int {
+		codes := make(chan int, n)
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				codes <- ts.do("POST", "/api/customers/password/reset", "", body).Code
+			}()
+		}
+		wg.Wait()
+		close(codes)
+
+		counts := make(map[int]int)
+		for code := range codes {
+			counts[code]++
+		}
+		return counts
+	}
+
+	ts.expect("POST", "/api/customers/password/forgot", "", `{"phone":"+79000000001"}`, http.StatusOK, nil)
+	code := ts.sms.code("+79000000001")
+	counts := parallel(5, `{"phone":"+79000000001","code":"`+code+`","password":"new"}`)
+	if counts[http.StatusOK] != 1 || counts[http.StatusBadRequest] != 4 {
+		t.Fatalf("statuses %v, want one success", counts)
+	}
+
+	ts.expect("POST", "/api/customers/password/forgot", "", `{"phone":"+79000000001"}`, http.StatusOK, nil)
+	code = ts.sms.code("+79000000001")
+	counts = parallel(20, `{"phone":"+79000000001","code":"`+wrongCode(code)+`","password":"new"}`)
+	if counts[http.StatusBadRequest] > verification.MaxAttempts || counts[http.StatusBadRequest]+counts[http.StatusTooManyRequests] != 20 {
+		t.Fatalf("statuses %v, want at most %d checked codes", counts, verification.MaxAttempts)
+	}
+	// после исчерпания попыток не подходит и верный код
+	ts.expect("POST", "/api/customers/password/reset", "", `{"phone":"+79000000001","code":"`+code+`","password":"new"}`, http.StatusTooManyRequests, nil)
+}
+
+func TestLoginDelay(t *testing.T) {
+	phonePolicy := lockout.PhonePolicy
+	phonePolicy.BaseDelay = time.Minute
+	phonePolicy.MaxDelay = time.Hour
+	ts := newTestServerWithPolicy(t, phonePolicy, lockout.IPPolicy)
+
+	ts.expect("POST", "/api/customers", "", `{"name":"Vasya","phone":"+79000000001","password":"pass"}`, http.StatusOK, nil)
+	ts.expect("POST", "/api/customers", "", `{"name":"Petya","phone":"+79000000002","password":"pass"}`, http.StatusOK, nil)
+
+	ts.expect("POST", "/api/customers/token", "", `{"login":"+79000000001","password":"wrong"}`, http.StatusBadRequest, nil)
+	// до конца паузы отказ даже с верным паролем
+	recorder := ts.do("POST", "/api/customers/token", "", `{"login":"+79000000001","password":"pass"}`)
+	// пауза отсчитывается от начала неудачной попытки, проверка пароля её немного съедает
+	retry, _ := strconv.Atoi(recorder.Header().Get("Retry-After"))
+	if recorder.Code != http.StatusTooManyRequests || retry < 50 || retry > 60 {
+		t.Fatalf("status = %d, Retry-After = %q, want 429 and about 60", recorder.Code, recorder.Header().Get("Retry-After"))
+	}
+	// другой телефон и вход продавца с тем же номером не затронуты
+	ts.expect("POST", "/api/customers/token", "", `{"login":"+79000000002","password":"pass"}`, http.StatusOK, nil)
+	ts.expect("POST", "/api/managers/token", "", `{"phone":"+70000000002","password":"secret"}`, http.StatusOK, nil)
+}
+
+func TestLoginLockout(t *testing.T) {
+	phonePolicy := lockout.PhonePolicy
+	phonePolicy.BaseDelay = 0
+	phonePolicy.MaxFailures = 3
+	ts := newTestServerWithPolicy(t, phonePolicy, lockout.IPPolicy)
+
+	for i := 0; i < phonePolicy.MaxFailures; i++ {
+		ts.expect("POST", "/api/managers/token", "", `{"phone":"+70000000002","password":"wrong"}`, http.StatusBadRequest, nil)
+	}
+	recorder := ts.do("POST", "/api/managers/token", "", `{"phone":"+70000000002","password":"secret"}`)
+	if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") != "900" {
+		t.Fatalf("status = %d, Retry-After = %q, want 429 and 900", recorder.Code, recorder.Header().Get("Retry-After"))
+	}
+
+	ts.expect("POST", "/api/managers/lockout/unlock", ts.adminToken, `{}`, http.StatusUnprocessableEntity, nil)
+	ts.expect("POST", "/api/managers/lockout/unlock", ts.adminToken, `{"user_type":"admin","phone":"+70000000002"}`, http.StatusUnprocessableEntity, nil)
+	// разблокировка покупателя с тем же номером не снимает блокировку продавца
+	ts.expect("POST", "/api/managers/lockout/unlock", ts.adminToken, `{"user_type":"customer","phone":"+70000000002"}`, http.StatusOK, nil)
+	ts.expect("POST", "/api/managers/token", "", `{"phone":"+70000000002","password":"secret"}`, http.StatusTooManyRequests, nil)
+
+	ts.expect("POST", "/api/managers/lockout/unlock", ts.adminToken, `{"user_type":"manager","phone":"7 000 000 00 02"}`, http.StatusOK, nil)
+	ts.expect("POST", "/api/managers/token", "", `{"phone":"+70000000002","password":"secret"}`, http.StatusOK, nil)
+
+	// успешный вход сбрасывает счётчик телефона
+	for i := 0; i < phonePolicy.MaxFailures-1; i++ {
+		ts.expect("POST", "/api/managers/token", "", `{"phone":"+70000000002","password":"wrong"}`, http.StatusBadRequest, nil)
+	}
+	ts.expect("POST", "/api/managers/token", "", `{"phone":"+70000000002","password":"secret"}`, http.StatusOK, nil)
+	ts.expect("POST", "/api/managers/token", "", `{"phone":"+70000000002","password":"wrong"}`, http.StatusBadRequest, nil)
+	ts.expect("POST", "/api/managers/token", "", `{"phone":"+70000000002","password":"secret"}`, http.StatusOK, nil)
+}
+
+// TestLoginLockoutConcurrent проверяет, что параллельные попытки не проходят проверку до того,
+// как засчитаны ошибки предыдущих
+func TestLoginLockoutConcurrent(t *testing.T) {
+	phonePolicy := lockout.PhonePolicy
+	phonePolicy.BaseDelay = 0
+	phonePolicy.MaxFailures = 3
+	ts := newTestServerWithPolicy(t, phonePolicy, lockout.IPPolicy)
+
+	codes := make(chan int, 20)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(codes); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- ts.do("POST", "/api/managers/token", "", `{"phone":"+70000000002","password":"wrong"}`).Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	checked := 0
+	for code := range codes {
+		switch code {
+		case http.StatusBadRequest:
+			checked++
+		case http.StatusTooManyRequests:
+		default:
+			t.Fatalf("unexpected status %d", code)
+		}
+	}
+	if checked != phonePolicy.MaxFailures {
+		t.Fatalf("%d passwords checked, want %d", checked, phonePolicy.MaxFailures)
+	}
+}
+
+func TestLoginIPLockout(t *testing.T) {
+	ipPolicy := lockout.IPPolicy
+	ipPolicy.MaxFailures = 3
+	ts := newTestServerWithPolicy(t, lockout.PhonePolicy, ipPolicy)
+
+	ts.expect("POST", "/api/customers", "", `{"name":"Vasya","phone":"+79000000001","password":"pass"}`, http.StatusOK, nil)
+
+	// перебор разных номеров с одного адреса
+	for i := 0; i < ipPolicy.MaxFailures; i++ {
+		login := "+7900000010" + strconv.Itoa(i)
+		ts.expect("POST", "/api/customers/token", "", `{"login":"`+login+`","password":"pass"}`, http.StatusBadRequest, nil)
+	}
+	ts.expect("POST", "/api/customers/token", "", `{"login":"+79000000001","password":"pass"}`, http.StatusTooManyRequests, nil)
+	ts.expect("POST", "/api/managers/token", "", `{"phone":"+70000000002","password":"secret"}`, http.StatusTooManyRequests, nil)
+
+	// httptest.NewRequest выставляет адрес клиента 192.0.2.1
+	ts.expect("POST", "/api/managers/lockout/unlock", ts.adminToken, `{"ip":"192.0.2.1"}`, http.StatusOK, nil)
+	ts.expect("POST", "/api/customers/token", "", `{"login":"+79000000001","password":"pass"}`, http.StatusOK, nil)
+
+	// перебор через Basic тоже считается по адресу
+	for i := 0; i < ipPolicy.MaxFailures; i++ {
+		basic := "Basic " + base64.StdEncoding.EncodeToString([]byte("+7000000010"+strconv.Itoa(i)+":secret"))
+		ts.expect("GET", "/api/managers/sales", basic, "", http.StatusUnauthorized, nil)
+	}
+	basic := "Basic " + base64.StdEncoding.EncodeToString([]byte("+70000000002:secret"))
+	ts.expect("GET", "/api/managers/sales", basic, "", http.StatusTooManyRequests, nil)
+	ts.expect("POST", "/api/managers/token", "", `{"phone":"+70000000002","password":"secret"}`, http.StatusTooManyRequests, nil)
+}
+
+// wrongCode возвращает код, отличный от code
+func wrongCode(code string) string {
+	if code == "000000" {
+		return "111111"
+	}
+	return "000000"
+}
+
+func TestCustomerProducts(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.expect("POST", "/api/managers/products", ts.managerToken, `{"name":"Tea","price":100,"qty":5}`, http.StatusOK, nil)
+
+	var items []*customers.Product
+	ts.expect("GET", "/api/customers/products", "", "", http.StatusOK, &items)
+	if len(items) != 1 || items[0].Name != "Tea" || items[0].Available != 5 {
+		t.Fatalf("unexpected products %+v", items)
+	}
+}
+
+func TestManagerRegistration(t *testing.T) {
+	ts := newTestServer(t)
+
+	var result struct {
+		Token string `json:"token"`
+	}
+	body := `{"name":"Ivan","phone":"+70000000003","salary":1000,"plan":5000,"roles":["MANAGER"]}`
+	ts.expect("POST", "/api/managers", ts.adminToken, body, http.StatusOK, &result)
+	if result.Token == "" {
+		t.Fatal("empty token")
+	}
+
+	// новый продавец сразу может работать со своим токеном
+	var sales struct {
+		ManagerID int64 `json:"manager_id"`
+		Total     int   `json:"total"`
+	}
+	ts.expect("GET", "/api/managers/sales", result.Token, "", http.StatusOK, &sales)
+	if sales.ManagerID == 0 || sales.Total != 0 {
+		t.Fatalf("unexpected sales %+v", sales)
+	}
+	manager, err := ts.store.ManagerByID(context.Background(), sales.ManagerID)
+	if err != nil || manager.IsAdmin || manager.Plan != 5000 {
+		t.Fatalf("unexpected manager %+v (%v)", manager, err)
+	}
+
+	// роль ADMIN даёт права админа
+	ts.expect("POST", "/api/managers", ts.adminToken, `{"name":"Root","phone":"+70000000004","roles":["ADMIN"]}`, http.StatusOK, &result)
+	ts.expect("GET", "/api/managers/sales", result.Token, "", http.StatusOK, &sales)
+	if !ts.srv.managerSvc.IsAdmin(context.Background(), sales.ManagerID) {
+		t.Fatal("manager with ADMIN role is not admin")
+	}
+
+	ts.expect("POST", "/api/managers", ts.adminToken, `{"name":`, http.StatusBadRequest, nil)
+	// телефон уникален
+	ts.expect("POST", "/api/managers", ts.adminToken, body, http.StatusConflict, nil)
+}
+
+func TestManagerToken(t *testing.T) {
+	ts := newTestServer(t)
+
+	var result struct {
+		Token string `json:"token"`
+	}
+	ts.expect("POST", "/api/managers/token", "", `{"phone":"+70000000002","password":"secret"}`, http.StatusOK, &result)
+	id, err := ts.store.ManagerIDByToken(context.Background(), utils.HashToken(result.Token))
+	if err != nil || id != ts.managerID {
+		t.Fatalf("token belongs to %d (%v), want %d", id, err, ts.managerID)
+	}
+	if _, err = ts.store.ManagerIDByToken(context.Background(), result.Token); err != types.ErrNotFound {
+		t.Fatalf("plaintext token is stored: %v", err)
+	}
+	// хеш из дампа БД не работает как токен
+	ts.expect("GET", "/api/managers/sales", utils.HashToken(result.Token), "", http.StatusForbidden, nil)
+	ts.expect("GET", "/api/managers/sales", result.Token, "", http.StatusOK, nil)
+
+	ts.expect("POST", "/api/managers/token", "", `{"phone":"+70000000002","password":"wrong"}`, http.StatusBadRequest, nil)
+	ts.expect("POST", "/api/managers/token", "", `{"phone":"+79999999999","password":"secret"}`, http.StatusBadRequest, nil)
+	ts.expect("POST", "/api/managers/token", "", `{"phone":`, http.StatusBadRequest, nil)
+
+	// без подписанных токенов обновление заменяет токен из БД новым, старый больше не действует
+	var refreshed types.AuthTokens
+	ts.expect("POST", "/api/managers/token/refresh", "", `{"refresh_token":"`+result.Token+`"}`, http.StatusOK, &refreshed)
+	if refreshed.Token == "" || refreshed.Token == result.Token || refreshed.RefreshToken != "" {
+		t.Fatalf("unexpected refresh response %+v", refreshed)
+	}
+	ts.expect("GET", "/api/managers/sales", result.Token, "", http.StatusForbidden, nil)
+	ts.expect("GET", "/api/managers/sales", refreshed.Token, "", http.StatusOK, nil)
+	ts.expect("POST", "/api/managers/token/refresh", "", `{"refresh_token":"`+result.Token+`"}`, http.StatusForbidden, nil)
+	ts.expect("POST", "/api/managers/token/refresh", "", `{"refresh_token":"unknown-token"}`, http.StatusForbidden, nil)
+}
+
+func TestManagerBasicAuth(t *testing.T) {
+	ts := newTestServer(t)
+
+	basic := func(login, password string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(login+":"+password))
+	}
+
+	ts.expect("GET", "/api/managers/sales", basic("+70000000002", "secret"), "", http.StatusOK, nil)
+	// телефон в любой записи
+	ts.expect("GET", "/api/managers/sales", basic("7 000 000 00 02", "secret"), "", http.StatusOK, nil)
+	ts.expect("GET", "/api/managers/api-keys", basic("+70000000002", "secret"), "", http.StatusForbidden, nil)
+	ts.expect("GET", "/api/managers/api-keys", basic("+70000000001", "secret"), "", http.StatusOK, nil)
+	// только для продавцов
+	ts.expect("GET", "/api/customers/cart", basic("+70000000002", "secret"), "", http.StatusForbidden, nil)
+
+	recorder := ts.do("GET", "/api/managers/sales", basic("+70000000002", "wrong"), "")
+	if recorder.Code != http.StatusUnauthorized || recorder.Header().Get("WWW-Authenticate") == "" {
+		t.Fatalf("wrong password: status = %d, WWW-Authenticate = %q", recorder.Code, recorder.Header().Get("WWW-Authenticate"))
+	}
+	ts.expect("GET", "/api/managers/sales", "Basic not-base64", "", http.StatusUnauthorized, nil)
+	ts.expect("GET", "/api/managers/sales", basic("+79999999999", "secret"), "", http.StatusUnauthorized, nil)
+
+	// ошибки Basic считаются вместе с ошибками входа по паролю
+	for i := 1; i < lockout.PhonePolicy.MaxFailures; i++ {
+		ts.expect("GET", "/api/managers/sales", basic("+70000000002", "wrong"), "", http.StatusUnauthorized, nil)
+	}
+	recorder = ts.do("GET", "/api/managers/sales", basic("+70000000002", "secret"), "")
+	if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") == "" {
+		t.Fatalf("locked phone: status = %d, Retry-After = %q", recorder.Code, recorder.Header().Get("Retry-After"))
+	}
+	ts.expect("POST", "/api/managers/token", "", `{"phone":"+70000000002","password":"secret"}`, http.StatusTooManyRequests, nil)
+}
+
+func TestTwoFactor(t *testing.T) {
+	ts := newTestServer(t)
+	login := `{"phone":"+70000000002","password":"secret"}`
+
+	code := func(secret string, step int64) string {
+		t.Helper()
+		result, err := totp.Code(secret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	enable := func(token string) (string, []string) {
+		t.Helper()
+		var enrollment types.TOTPEnrollment
+		ts.expect("POST", "/api/managers/2fa/enroll", token, "", http.StatusOK, &enrollment)
+		var confirmed struct {
+			RecoveryCodes []string `json:"recovery_codes"`
+		}
+		ts.expect("POST", "/api/managers/2fa/confirm", token, `{"code":"`+code(enrollment.Secret, totp.Step(time.Now()))+`"}`, http.StatusOK, &confirmed)
+		return enrollment.Secret, confirmed.RecoveryCodes
+	}
+
+	// без подтверждения секрет не действует, его можно перевыпустить
+	var enrollment types.TOTPEnrollment
+	ts.expect("POST", "/api/managers/2fa/enroll", ts.managerToken, "", http.StatusOK, &enrollment)
+	if !strings.HasPrefix(enrollment.URI, "otpauth://totp/") || !strings.Contains(enrollment.URI, "secret="+enrollment.Secret) {
+		t.Fatalf("unexpected enrollment %+v", enrollment)
+	}
+	ts.expect("POST", "/api/managers/token", "", login, http.StatusOK, nil)
+	ts.expect("POST", "/api/managers/2fa/disable", ts.managerToken, `{"code":"123456"}`, http.StatusConflict, nil)
+
+	secret, recovery := enable(ts.managerToken)
+	if len(recovery) != managers.RecoveryCodes {
+		t.Fatalf("recovery codes = %v", recovery)
+	}
+	ts.expect("POST", "/api/managers/2fa/enroll", ts.managerToken, "", http.StatusConflict, nil)
+	ts.expect("POST", "/api/managers/2fa/confirm", ts.managerToken, `{"code":"123456"}`, http.StatusConflict, nil)
+
+	// после пароля - только токен второго шага, Basic больше не пускает
+	var first types.AuthTokens
+	ts.expect("POST", "/api/managers/token", "", login, http.StatusOK, &first)
+	if first.Token != "" || first.Challenge == "" {
+		t.Fatalf("unexpected login response %+v", first)
+	}
+	basic := "Basic " + base64.StdEncoding.EncodeToString([]byte("+70000000002:secret"))
+	ts.expect("GET", "/api/managers/sales", basic, "", http.StatusUnauthorized, nil)
+	ts.expect("GET", "/api/managers/sales", first.Challenge, "", http.StatusForbidden, nil)
+
+	// код, которым подтверждено подключение, повторно не принимается
+	step := totp.Step(time.Now())
+	ts.expect("POST", "/api/managers/token/2fa", "", `{"challenge":"`+first.Challenge+`","code":"`+code(secret, step)+`"}`, http.StatusBadRequest, nil)
+	var tokens types.AuthTokens
+	ts.expect("POST", "/api/managers/token/2fa", "", `{"challenge":"`+first.Challenge+`","code":"`+code(secret, step+1)+`"}`, http.StatusOK, &tokens)
+	if tokens.Token == "" || tokens.Challenge != "" {
+		t.Fatalf("unexpected tokens %+v", tokens)
+	}
+	ts.expect("GET", "/api/managers/sales", tokens.Token, "", http.StatusOK, nil)
+	ts.expect("POST", "/api/managers/token/2fa", "", `{"challenge":"`+first.Challenge+`","code":"`+code(secret, step+1)+`"}`, http.StatusForbidden, nil)
+
+	// код восстановления одноразовый, регистр не важен
+	var second types.AuthTokens
+	ts.expect("POST", "/api/managers/token", "", login, http.StatusOK, &second)
+	ts.expect("POST", "/api/managers/token/2fa", "", `{"challenge":"`+second.Challenge+`","code":"`+strings.ToUpper(recovery[0])+`"}`, http.StatusOK, nil)
+	ts.expect("POST", "/api/managers/token", "", login, http.StatusOK, &second)
+	ts.expect("POST", "/api/managers/token/2fa", "", `{"challenge":"`+second.Challenge+`","code":"`+recovery[0]+`"}`, http.StatusBadRequest, nil)
+
+	// обязательный второй фактор для админов включает только админ со вторым фактором
+	policy := `{"require_admin":true}`
+	ts.expect("POST", "/api/managers/2fa/policy", ts.adminToken, `{}`, http.StatusUnprocessableEntity, nil)
+	ts.expect("POST", "/api/managers/2fa/policy", ts.adminToken, policy, http.StatusConflict, nil)
+	adminSecret, _ := enable(ts.adminToken)
+	ts.expect("POST", "/api/managers/2fa/policy", ts.adminToken, policy, http.StatusOK, nil)
+	_, otherAdmin := ts.seedManager("other", "+70000000003", "secret", true)
+	ts.expect("GET", "/api/managers/api-keys", otherAdmin, "", http.StatusForbidden, nil)
+	ts.expect("GET", "/api/managers/api-keys", ts.adminToken, "", http.StatusOK, nil)
+	enable(otherAdmin)
+	ts.expect("GET", "/api/managers/api-keys", otherAdmin, "", http.StatusOK, nil)
+	ts.expect("POST", "/api/managers/2fa/policy", ts.adminToken, `{"require_admin":false}`, http.StatusOK, nil)
+
+	// отключение - по коду восстановления, дальше вход снова только по паролю
+	ts.expect("POST", "/api/managers/2fa/disable", ts.managerToken, `{"code":"`+recovery[0]+`"}`, http.StatusBadRequest, nil)
+	ts.expect("POST", "/api/managers/2fa/disable", ts.managerToken, `{"code":"`+recovery[1]+`"}`, http.StatusOK, nil)
+	tokens = types.AuthTokens{}
+	ts.expect("POST", "/api/managers/token", "", login, http.StatusOK, &tokens)
+	if tokens.Token == "" || tokens.Challenge != "" {
+		t.Fatalf("unexpected login response %+v", tokens)
+	}
+
+	// после MaxChallengeAttempts ошибок вход удаляется
+	var challenge types.AuthTokens
+	ts.expect("POST", "/api/managers/token", "", `{"phone":"+70000000001","password":"secret"}`, http.StatusOK, &challenge)
+	wrong := `{"challenge":"` + challenge.Challenge + `","code":"` + wrongCode(code(adminSecret, totp.Step(time.Now()))) + `"}`
+	for i := 1; i < managers.MaxChallengeAttempts; i++ {
+		ts.expect("POST", "/api/managers/token/2fa", "", wrong, http.StatusBadRequest, nil)
+	}
+	ts.expect("POST", "/api/managers/token/2fa", "", wrong, http.StatusTooManyRequests, nil)
+	ts.expect("POST", "/api/managers/token/2fa", "", wrong, http.StatusForbidden, nil)
+}
+
+func TestSignedTokens(t *testing.T) {
+	keys := map[string][]byte{
+		"old": []byte(strings.Repeat("o", jwt.MinKeySize)),
+		"new": []byte(strings.Repeat("n", jwt.MinKeySize)),
+	}
+	signer, err := jwt.NewSigner(keys, "new", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := newTestServerWithSigner(t, signer)
+	ctx := context.Background()
+
+	ts.expect("POST", "/api/customers", "", `{"name":"Vasya","phone":"+79000000001","password":"pass"}`, http.StatusOK, nil)
+	var result struct {
+		Status       string `json:"status"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+	}
+	ts.expect("POST", "/api/customers/token", "", `{"login":"+79000000001","password":"pass"}`, http.StatusOK, &result)
+	if result.Status != "ok" || strings.Count(result.Token, ".") != 2 || result.RefreshToken == "" || result.ExpiresIn != 60 {
+		t.Fatalf("unexpected token response %+v", result)
+	}
+	// токен доступа проверяется без БД, в БД только хеш токена обновления
+	if _, err = ts.store.CustomerIDByToken(ctx, utils.HashToken(result.Token)); err != types.ErrNotFound {
+		t.Fatalf("access token is stored: %v", err)
+	}
+	ts.expect("POST", "/api/customers/phone/code", "Bearer "+result.Token, "", http.StatusOK, nil)
+	// токен обновления не заменяет токен доступа, токен покупателя не подходит продавцу
+	ts.expect("POST", "/api/customers/phone/verify", result.RefreshToken, `{"code":"123456"}`, http.StatusForbidden, nil)
+	ts.expect("GET", "/api/managers/sales", result.Token, "", http.StatusForbidden, nil)
+
+	var refreshed types.AuthTokens
+	ts.expect("POST", "/api/customers/token/refresh", "", `{"refresh_token":"`+result.RefreshToken+`"}`, http.StatusOK, &refreshed)
+	if refreshed.Token == "" || refreshed.RefreshToken == "" || refreshed.RefreshToken == result.RefreshToken {
+		t.Fatalf("unexpected refresh response %+v", refreshed)
+	}
+	// токен обновления одноразовый: повтор старого отклоняется, новый действует
+	ts.expect("POST", "/api/customers/token/refresh", "", `{"refresh_token":"`+result.RefreshToken+`"}`, http.StatusForbidden, nil)
+	ts.expect("POST", "/api/customers/token/refresh", "", `{"refresh_token":"`+refreshed.RefreshToken+`"}`, http.StatusOK, nil)
+	ts.expect("POST", "/api/customers/token/refresh", "", `{"refresh_token":"`+result.Token+`"}`, http.StatusForbidden, nil)
+	ts.expect("POST", "/api/managers/token/refresh", "", `{"refresh_token":"`+result.RefreshToken+`"}`, http.StatusForbidden, nil)
+	ts.expect("POST", "/api/customers/token/refresh", "", `{}`, http.StatusUnprocessableEntity, nil)
+
+	var manager types.AuthTokens
+	ts.expect("POST", "/api/managers/token", "", `{"phone":"+70000000001","password":"secret"}`, http.StatusOK, &manager)
+	claims, err := signer.Parse(manager.Token, types.UserManager)
+	if err != nil || claims.UserID != ts.adminID || strings.Join(claims.Roles, ",") != "MANAGER,ADMIN" {
+		t.Fatalf("unexpected claims %+v (%v)", claims, err)
+	}
+	ts.expect("GET", "/api/managers/sales", manager.Token, "", http.StatusOK, nil)
+	ts.expect("GET", "/api/managers/sales", ts.adminToken, "", http.StatusForbidden, nil)
+	ts.expect("POST", "/api/managers/token/refresh", "", `{"refresh_token":"`+ts.adminToken+`"}`, http.StatusOK, nil)
+
+	sign := func(kid string, key []byte, expire time.Time) string {
+		claims := &jwt.Claims{UserType: types.UserManager}
+		claims.Subject = strconv.FormatInt(ts.adminID, 10)
+		if !expire.IsZero() {
+			claims.ExpiresAt = gojwt.NewNumericDate(expire)
+		}
+		token := gojwt.NewWithClaims(gojwt.SigningMethodHS256, claims)
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	later := time.Now().Add(time.Hour)
+	// токены старого ключа действуют, пока ключ в списке
+	ts.expect("GET", "/api/managers/sales", sign("old", keys["old"], later), "", http.StatusOK, nil)
+	ts.expect("GET", "/api/managers/sales", sign("gone", keys["old"], later), "", http.StatusForbidden, nil)
+	ts.expect("GET", "/api/managers/sales", sign("new", keys["old"], later), "", http.StatusForbidden, nil)
+	ts.expect("GET", "/api/managers/sales", sign("new", keys["new"], time.Now().Add(-time.Minute)), "", http.StatusForbidden, nil)
+	ts.expect("GET", "/api/managers/sales", sign("new", keys["new"], time.Time{}), "", http.StatusForbidden, nil)
+	parts := strings.Split(manager.Token, ".")
+	ts.expect("GET", "/api/managers/sales", parts[0]+"."+parts[1]+".", "", http.StatusForbidden, nil)
+
+	// сброс пароля отзывает токены обновления
+	ts.expect("POST", "/api/managers/password/forgot", "", `{"phone":"+70000000001"}`, http.StatusOK, nil)
+	code := ts.sms.code("+70000000001")
+	ts.expect("POST", "/api/managers/password/reset", "", `{"phone":"+70000000001","code":"`+code+`","password":"new"}`, http.StatusOK, nil)
+	ts.expect("POST", "/api/managers/token/refresh", "", `{"refresh_token":"`+manager.RefreshToken+`"}`, http.StatusForbidden, nil)
+}
+
+func TestManagerProducts(t *testing.T) {
+	ts := newTestServer(t)
+
+	var product types.Product
+	ts.expect("POST", "/api/managers/products", ts.managerToken,
+		`{"name":"Coffee","price":250,"qty":10,"category":"drinks"}`, http.StatusOK, &product)
+	if product.ID == 0 || product.Category != "drinks" || !product.Active {
+		t.Fatalf("unexpected product %+v", product)
+	}
+
+	body := `{"id":` + strconv.FormatInt(product.ID, 10) + `,"name":"Coffee","price":300,"qty":8,"category":"drinks"}`
+	ts.expect("POST", "/api/managers/products", ts.managerToken, body, http.StatusOK, &product)
+	if product.Price != 300 || product.Qty != 8 {
+		t.Fatalf("product not updated %+v", product)
+	}
+
+	var items []*types.Product
+	ts.expect("GET", "/api/managers/products", "", "", http.StatusOK, &items)
+	if len(items) != 1 || items[0].Price != 300 {
+		t.Fatalf("unexpected products %+v", items)
+	}
+
+	ts.expect("POST", "/api/managers/products", ts.managerToken, `{"id":999,"name":"X","price":1,"qty":1}`, http.StatusInternalServerError, nil)
+	ts.expect("POST", "/api/managers/products", ts.managerToken, `{"name":"Bad","price":0,"qty":1}`, http.StatusUnprocessableEntity, nil)
+	ts.expect("POST", "/api/managers/products", ts.managerToken, `[`, http.StatusBadRequest, nil)
+
+	path := "/api/managers/products/" + strconv.FormatInt(product.ID, 10)
+	ts.expect("DELETE", path, ts.managerToken, "", http.StatusOK, nil)
+	ts.expect("DELETE", path, ts.managerToken, "", http.StatusBadRequest, nil)
+
+	ts.expect("GET", "/api/managers/products", "", "", http.StatusOK, &items)
+	if len(items) != 0 {
+		t.Fatalf("product not removed %+v", items)
+	}
+}
+
+func TestManagerSales(t *testing.T) {
+	ts := newTestServer(t)
+
+	var product types.Product
+	ts.expect("POST", "/api/managers/products", ts.managerToken, `{"name":"Tea","price":100,"qty":10}`, http.StatusOK, &product)
+	productID := strconv.FormatInt(product.ID, 10)
+
+	var sale types.Sale
+	body := `{"customer_id":1,"positions":[{"product_id":` + productID + `,"price":100,"qty":3}]}`
+	ts.expect("POST", "/api/managers/sales", ts.managerToken, body, http.StatusOK, &sale)
+	if sale.ID == 0 || sale.ManagerID != ts.managerID || len(sale.Positions) != 1 {
+		t.Fatalf("unexpected sale %+v", sale)
+	}
+
+	var items []*types.Product
+	ts.expect("GET", "/api/managers/products", "", "", http.StatusOK, &items)
+	if len(items) != 1 || items[0].Qty != 7 {
+		t.Fatalf("stock not decreased %+v", items)
+	}
+
+	// товара не хватает - продажа не сохраняется целиком
+	body = `{"customer_id":1,"positions":[{"product_id":` + productID + `,"price":100,"qty":1},{"product_id":` + productID + `,"price":100,"qty":7}]}`
+	ts.expect("POST", "/api/managers/sales", ts.managerToken, body, http.StatusBadRequest, nil)
+	ts.expect("POST", "/api/managers/sales", ts.managerToken, `{"customer_id":1,"positions":[{"product_id":999,"price":1,"qty":1}]}`, http.StatusBadRequest, nil)
+	ts.expect("POST", "/api/managers/sales", ts.managerToken, `{"positions":`, http.StatusBadRequest, nil)
+
+	ts.expect("GET", "/api/managers/products", "", "", http.StatusOK, &items)
+	if items[0].Qty != 7 {
+		t.Fatalf("failed sale changed stock %+v", items)
+	}
+
+	var sales struct {
+		ManagerID int64 `json:"manager_id"`
+		Total     int   `json:"total"`
+	}
+	ts.expect("GET", "/api/managers/sales", ts.managerToken, "", http.StatusOK, &sales)
+	if sales.ManagerID != ts.managerID || sales.Total != 300 {
+		t.Fatalf("unexpected sales %+v", sales)
+	}
+
+	// админ видит продажи любого продавца, продавец - только своей команды
+	ts.expect("GET", "/api/managers/sales?manager_id="+strconv.FormatInt(ts.managerID, 10), ts.adminToken, "", http.StatusOK, &sales)
+	if sales.Total != 300 {
+		t.Fatalf("unexpected sales %+v", sales)
+	}
+	ts.expect("GET", "/api/managers/sales?manager_id="+strconv.FormatInt(ts.adminID, 10), ts.managerToken, "", http.StatusForbidden, nil)
+	ts.expect("GET", "/api/managers/sales?manager_id=abc", ts.managerToken, "", http.StatusForbidden, nil)
+}
+
+func TestManagerCustomers(t *testing.T) {
+	ts := newTestServer(t)
+
+	var customer customers.Customer
+	ts.expect("POST", "/api/customers", "", `{"name":"Vasya","phone":"+79000000001","password":"pass"}`, http.StatusOK, &customer)
+	id := strconv.FormatInt(customer.ID, 10)
+
+	var items []*types.Customer
+	ts.expect("GET", "/api/managers/customers", ts.managerToken, "", http.StatusOK, &items)
+	if len(items) != 1 || items[0].Name != "Vasya" {
+		t.Fatalf("unexpected customers %+v", items)
+	}
+
+	var changed types.Customer
+	ts.expect("POST", "/api/managers/customers", ts.managerToken,
+		`{"id":`+id+`,"name":"Vasiliy","phone":"+79000000001","active":false}`, http.StatusOK, &changed)
+	if changed.Name != "Vasiliy" || changed.Active {
+		t.Fatalf("customer not changed %+v", changed)
+	}
+
+	// неактивные покупатели в список не попадают
+	ts.expect("GET", "/api/managers/customers", ts.managerToken, "", http.StatusOK, &items)
+	if len(items) != 0 {
+		t.Fatalf("inactive customer listed %+v", items)
+	}
+
+	ts.expect("POST", "/api/managers/customers", ts.managerToken, `{"id":999,"name":"X","phone":"+79000000009"}`, http.StatusBadRequest, nil)
+	ts.expect("POST", "/api/managers/customers", ts.managerToken, `{"id":`, http.StatusBadRequest, nil)
+
+	ts.expect("DELETE", "/api/managers/customers/"+id, ts.managerToken, "", http.StatusOK, nil)
+	ts.expect("DELETE", "/api/managers/customers/"+id, ts.managerToken, "", http.StatusBadRequest, nil)
+}
+
+func TestManagerTeam(t *testing.T) {
+	ts := newTestServer(t)
+
+	managerID := strconv.FormatInt(ts.managerID, 10)
+	adminID := strconv.FormatInt(ts.adminID, 10)
+
+	var manager types.Manager
+	ts.expect("POST", "/api/managers/"+managerID+"/boss", ts.adminToken, `{"boss_id":`+adminID+`,"departament":"sales"}`, http.StatusOK, &manager)
+	if manager.BossID != ts.adminID || manager.Departament != "sales" {
+		t.Fatalf("boss not set %+v", manager)
+	}
+
+	// руководитель не может быть подчинённым
+	ts.expect("POST", "/api/managers/"+adminID+"/boss", ts.adminToken, `{"boss_id":`+managerID+`}`, http.StatusBadRequest, nil)
+	ts.expect("POST", "/api/managers/"+adminID+"/boss", ts.adminToken, `{"boss_id":`+adminID+`}`, http.StatusBadRequest, nil)
+	ts.expect("POST", "/api/managers/999/boss", ts.adminToken, `{"boss_id":0}`, http.StatusNotFound, nil)
+	ts.expect("POST", "/api/managers/"+managerID+"/boss", ts.adminToken, `{"boss_id":`, http.StatusBadRequest, nil)
+
+	var team []*types.TeamNode
+	ts.expect("GET", "/api/managers/team", ts.adminToken, "", http.StatusOK, &team)
+	if len(team) != 1 || team[0].ID != ts.adminID || len(team[0].Children) != 1 || team[0].Children[0].ID != ts.managerID {
+		t.Fatalf("unexpected team %+v", team)
+	}
+
+	ts.expect("GET", "/api/managers/team", ts.managerToken, "", http.StatusOK, &team)
+	if len(team) != 1 || team[0].ID != ts.managerID {
+		t.Fatalf("unexpected team %+v", team)
+	}
+
+	// руководитель видит продажи подчинённого
+	ts.expect("GET", "/api/managers/sales?manager_id="+managerID, ts.adminToken, "", http.StatusOK, nil)
+
+	var sales struct {
+		BossID   int64              `json:"boss_id"`
+		Managers []*types.TeamSales `json:"managers"`
+	}
+	ts.expect("GET", "/api/managers/team/sales", ts.adminToken, "", http.StatusOK, &sales)
+	if sales.BossID != ts.adminID || len(sales.Managers) != 2 {
+		t.Fatalf("unexpected team sales %+v", sales)
+	}
+	ts.expect("GET", "/api/managers/team/sales?manager_id="+adminID, ts.managerToken, "", http.StatusForbidden, nil)
+}
+
+// TestPerformanceReportLimits проверяет, что отчёт не строится за слишком длинный период:
+// каждый период - строка на каждого продавца
+func TestPerformanceReportLimits(t *testing.T) {
+	ts := newTestServer(t)
+
+	for _, query := range []string{
+		"from=0001-01-01&to=2020-01-01",
+		"from=2020-01-01&to=2021-01-01&group=day",
+		"from=2020-01-01&to=2023-01-01&group=week",
+		"from=2020-01-01&to=2030-01-01&group=month",
+		"from=2020-01-01&to=2020-01-31&group=year",
+		"from=2020-01-31&to=2020-01-01",
+	} {
+		ts.expect("GET", "/api/managers/reports/performance?"+query, ts.adminToken, "", http.StatusBadRequest, nil)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+
+	expire := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	var created struct {
+		Key    string       `json:"key"`
+		APIKey types.APIKey `json:"api_key"`
+	}
+	ts.expect("POST", "/api/managers/api-keys", ts.adminToken, `{"name":"warehouse","scopes":["products:write"],"expire":"`+expire+`"}`, http.StatusOK, &created)
+	if !strings.HasPrefix(created.Key, created.APIKey.Prefix) || created.APIKey.ManagerID != ts.adminID || created.APIKey.LastUsed != nil {
+		t.Fatalf("unexpected api key %q %+v", created.Key, created.APIKey)
+	}
+	// в хранилище только хеш ключа
+	if _, err := ts.store.APIKeyByHash(ctx, created.Key); err != types.ErrNotFound {
+		t.Fatalf("plaintext key is stored: %v", err)
+	}
+
+	ts.expect("POST", "/api/managers/api-keys", ts.adminToken, `{"name":"warehouse","scopes":["sales:read"],"expire":"`+expire+`"}`, http.StatusUnprocessableEntity, nil)
+	ts.expect("POST", "/api/managers/api-keys", ts.adminToken, `{"name":"warehouse","scopes":["products:read"],"expire":"`+past+`"}`, http.StatusUnprocessableEntity, nil)
+	ts.expect("POST", "/api/managers/api-keys", ts.adminToken, `{"name":"warehouse","scopes":[]}`, http.StatusUnprocessableEntity, nil)
+
+	// ключ работает только на маршрутах своих областей доступа
+	recorder := ts.doAPIKey("POST", "/api/managers/products", created.Key, `{"name":"Tea","price":100,"qty":5}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("product with api key: status = %d, body: %s", recorder.Code, recorder.Body.String())
+	}
+	for _, r := range []route{{"GET", "/api/managers/sales"}, {"GET", "/api/managers/api-keys"}, {"POST", "/api/managers/payroll"}} {
+		if recorder = ts.doAPIKey(r.method, r.path, created.Key, `{}`); recorder.Code != http.StatusForbidden {
+			t.Errorf("%s %s with api key: status = %d, want %d", r.method, r.path, recorder.Code, http.StatusForbidden)
+		}
+	}
+	if recorder = ts.doAPIKey("POST", "/api/managers/products", apikeys.KeyPrefix+"unknown", `{"name":"Tea","price":100,"qty":5}`); recorder.Code != http.StatusForbidden {
+		t.Fatalf("unknown api key: status = %d", recorder.Code)
+	}
+
+	var items []*types.APIKey
+	ts.expect("GET", "/api/managers/api-keys", ts.adminToken, "", http.StatusOK, &items)
+	if len(items) != 1 || items[0].ID != created.APIKey.ID || items[0].LastUsed == nil {
+		t.Fatalf("unexpected api keys %+v", items)
+	}
+	ts.expect("GET", "/api/managers/api-keys", ts.managerToken, "", http.StatusForbidden, nil)
+
+	// истёкший ключ не работает
+	_, err := ts.store.CreateAPIKey(ctx, &types.APIKey{ManagerID: ts.adminID, Name: "old", Prefix: apikeys.KeyPrefix,
+		Scopes: []string{apikeys.ScopeProductsWrite}, Expire: time.Now().Add(-time.Minute)}, utils.HashToken(apikeys.KeyPrefix+"expired"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorder = ts.doAPIKey("POST", "/api/managers/products", apikeys.KeyPrefix+"expired", `{"name":"Tea","price":100,"qty":5}`); recorder.Code != http.StatusForbidden {
+		t.Fatalf("expired api key: status = %d", recorder.Code)
+	}
+
+	var revoked types.APIKey
+	ts.expect("DELETE", "/api/managers/api-keys/"+strconv.FormatInt(created.APIKey.ID, 10), ts.adminToken, "", http.StatusOK, &revoked)
+	if revoked.Revoked == nil {
+		t.Fatalf("key is not revoked: %+v", revoked)
+	}
+	if recorder = ts.doAPIKey("POST", "/api/managers/products", created.Key, `{"name":"Tea","price":100,"qty":5}`); recorder.Code != http.StatusForbidden {
+		t.Fatalf("revoked api key: status = %d", recorder.Code)
+	}
+	ts.expect("DELETE", "/api/managers/api-keys/999", ts.adminToken, "", http.StatusNotFound, nil)
+}
+
+func TestValidation(t *testing.T) {
+	ts := newTestServer(t)
+
+	tests := []struct {
+		name   string
+		path   string
+		token  string
+		body   string
+		status int
+		fields []string
+	}{
+		{"empty name", "/api/customers", "", `{"name":" ","phone":"+79000000001","password":"pass"}`, http.StatusUnprocessableEntity, []string{"name"}},
+		{"bad phone", "/api/customers", "", `{"name":"Vasya","phone":"12-34","password":"pass"}`, http.StatusUnprocessableEntity, []string{"phone"}},
+		{"no password", "/api/customers", "", `{"name":"Vasya","phone":"+79000000001"}`, http.StatusUnprocessableEntity, []string{"password"}},
+		{"unknown field", "/api/customers", "", `{"name":"Vasya","phone":"+79000000001","password":"pass","admin":true}`, http.StatusBadRequest, nil},
+		{"trailing data", "/api/customers", "", `{"name":"Vasya","phone":"+79000000001","password":"pass"}{}`, http.StatusBadRequest, nil},
+		{"empty body", "/api/customers/token", "", ``, http.StatusBadRequest, nil},
+		{"oversized body", "/api/customers", "", `{"name":"` + strings.Repeat("a", 2<<20) + `"}`, http.StatusRequestEntityTooLarge, nil},
+		{"product fields", "/api/managers/products", ts.managerToken, `{"name":"","price":-1,"qty":-1}`, http.StatusUnprocessableEntity, []string{"name", "price", "qty"}},
+		{"empty positions", "/api/managers/sales", ts.managerToken, `{"customer_id":1,"positions":[]}`, http.StatusUnprocessableEntity, []string{"positions"}},
+		{"position fields", "/api/managers/sales", ts.managerToken, `{"customer_id":1,"positions":[{"product_id":0,"price":1,"qty":-2}]}`, http.StatusUnprocessableEntity, []string{"positions[0].product_id", "positions[0].qty"}},
+		{"null position", "/api/managers/sales", ts.managerToken, `{"customer_id":1,"positions":[null]}`, http.StatusUnprocessableEntity, []string{"positions[0]"}},
+		{"manager phone", "/api/managers", ts.adminToken, `{"name":"Ivan","phone":"phone"}`, http.StatusUnprocessableEntity, []string{"phone"}},
+		{"boss", "/api/managers/1/boss", ts.adminToken, `{"boss_id":-1}`, http.StatusUnprocessableEntity, []string{"boss_id"}},
+	}
+
+	for _, test := range tests {
+		var result struct {
+			Errors map[string]string `json:"errors"`
+		}
+		recorder := ts.do("POST", test.path, test.token, test.body)
+		if recorder.Code != test.status {
+			t.Errorf("%s: status = %d, want %d, body: %s", test.name, recorder.Code, test.status, recorder.Body.String())
+			continue
+		}
+		if test.fields == nil {
+			continue
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &result); err != nil {
+			t.Errorf("%s: invalid JSON: %v", test.name, err)
+			continue
+		}
+		if len(result.Errors) != len(test.fields) {
+			t.Errorf("%s: errors = %v, want fields %v", test.name, result.Errors, test.fields)
+		}
+		for _, field := range test.fields {
+			if result.Errors[field] == "" {
+				t.Errorf("%s: no error for field %s in %v", test.name, field, result.Errors)
+			}
+		}
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.expect("GET", "/api/managers/products", "", "", http.StatusOK, nil)
+
+	recorder := ts.do("GET", "/metrics", "", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d", recorder.Code)
+	}
+	if !strings.Contains(recorder.Body.String(), `route="/api/managers/products"`) {
+		t.Fatal("request metrics are not labelled by route template")
+	}
+}
@@ -0,0 +1,130 @@
+package app
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/KarrenAeris/crud/cmd/app/middleware"
+	"github.com/KarrenAeris/crud/pkg/types"
+)
+
+func (s *Server) handleCustomerGetSessions(w http.ResponseWriter, r *http.Request) {
+	if id, ok := s.customerID(w, r); ok {
+		s.getSessions(w, r, types.UserCustomer, id)
+	}
+}
+
+func (s *Server) handleCustomerRevokeSession(w http.ResponseWriter, r *http.Request) {
+	if id, ok := s.customerID(w, r); ok {
+		s.revokeSession(w, r, types.UserCustomer, id)
+	}
+}
+
+func (s *Server) handleManagerGetSessions(w http.ResponseWriter, r *http.Request) {
+	if id, ok := s.managerID(w, r); ok {
+		s.getSessions(w, r, types.UserManager, id)
+	}
+}
+
+func (s *Server) handleManagerRevokeSession(w http.ResponseWriter, r *http.Request) {
+	if id, ok := s.managerID(w, r); ok {
+		s.revokeSession(w, r, types.UserManager, id)
+	}
+}
+
+func (s *Server) handleManagerGetManagerSessions(w http.ResponseWriter, r *http.Request) {
+	if id, ok := s.sessionsManagerID(w, r); ok {
+		s.getSessions(w, r, types.UserManager, id)
+	}
+}
+
+func (s *Server) handleManagerRevokeManagerSession(w http.ResponseWriter, r *http.Request) {
+	if id, ok := s.sessionsManagerID(w, r); ok {
+		s.revokeSession(w, r, types.UserManager, id)
+	}
+}
+
+// getSessions отвечает списком сессий пользователя
+func (s *Server) getSessions(w http.ResponseWriter, r *http.Request, userType string, userID int64) {
+	// текущая сессия узнаётся по токену запроса, с подписанными токенами она не отмечается
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	items, err := s.sessionSvc.All(r.Context(), userType, userID, token)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, r, items)
+}
+
+// revokeSession завершает сессию пользователя с id из пути
+func (s *Server) revokeSession(w http.ResponseWriter, r *http.Request, userType string, userID int64) {
+	id, err := strconv.ParseInt(mux.Vars(r)["session"], 10, 64)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	item, err := s.sessionSvc.Revoke(r.Context(), userType, userID, id)
+	if err == types.ErrNotFound {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, r, item)
+}
+
+// customerID возвращает id аутентифицированного покупателя, иначе отвечает ошибкой
+func (s *Server) customerID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return 0, false
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusForbidden, middleware.ErrNoAuthentication)
+		return 0, false
+	}
+	return id, true
+}
+
+// sessionsManagerID проверяет права админа и возвращает id продавца из пути
+func (s *Server) sessionsManagerID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	if _, ok := s.adminID(w, r); !ok {
+		return 0, false
+	}
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return 0, false
+	}
+
+	_, err = s.managerSvc.ByID(r.Context(), id)
+	if err == types.ErrNotFound {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusNotFound, err)
+		return 0, false
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusInternalServerError, err)
+		return 0, false
+	}
+	return id, true
+}
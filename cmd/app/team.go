@@ -0,0 +1,155 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/KarrenAeris/crud/cmd/app/middleware"
+	"github.com/KarrenAeris/crud/pkg/types"
+	"github.com/gorilla/mux"
+)
+
+func (s *Server) handleManagerGetTeam(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	// админ видит всю оргструктуру, остальные - свою команду
+	rootID := id
+	if s.managerSvc.IsAdmin(r.Context(), id) {
+		rootID = 0
+	}
+
+	items, err := s.managerSvc.Team(r.Context(), rootID)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, r, items)
+}
+
+func (s *Server) handleManagerSetBoss(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	if !s.managerSvc.IsAdmin(r.Context(), id) {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	managerID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	var item struct {
+		BossID      int64  `json:"boss_id" validate:"min=0"`
+		Departament string `json:"departament" validate:"max=255"`
+	}
+	if !s.decodeJSON(w, r, &item) {
+		return
+	}
+
+	manager, err := s.managerSvc.SetBoss(r.Context(), managerID, item.BossID, item.Departament)
+	if errors.Is(err, types.ErrNotFound) {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusNotFound, err)
+		return
+	}
+	if errors.Is(err, types.ErrInvalidBoss) {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, r, manager)
+}
+
+func (s *Server) handleManagerGetTeamSales(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	bossID, err := s.viewedManagerID(r, id)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	ids, err := s.managerSvc.Subtree(r.Context(), bossID)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	items, err := s.managerSvc.TeamSales(r.Context(), ids)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	var sales, total int64
+	for _, item := range items {
+		sales += item.Sales
+		total += item.Total
+	}
+
+	respondJSON(w, r, map[string]interface{}{"boss_id": bossID, "sales": sales, "total": total, "managers": items})
+}
+
+// viewedManagerID возвращает продавца из параметра manager_id (по умолчанию - сам пользователь),
+// если пользователю можно смотреть его данные
+func (s *Server) viewedManagerID(r *http.Request, id int64) (int64, error) {
+	value := r.URL.Query().Get("manager_id")
+	if value == "" {
+		return id, nil
+	}
+
+	managerID, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if !s.managerSvc.CanView(r.Context(), id, managerID) {
+		return 0, errors.New("manager is not in your team")
+	}
+	return managerID, nil
+}
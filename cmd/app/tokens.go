@@ -0,0 +1,33 @@
+package app
+
+import (
+	"net/http"
+
+	"github.com/KarrenAeris/crud/pkg/types"
+)
+
+// refreshRequest - запрос нового токена доступа по токену из БД
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// tokenResponse - ответ покупателю на вход: status и токены
+func tokenResponse(tokens *types.AuthTokens) map[string]interface{} {
+	response := map[string]interface{}{"status": "ok", "token": tokens.Token}
+	if tokens.RefreshToken != "" {
+		response["refresh_token"] = tokens.RefreshToken
+		response["expires_in"] = tokens.ExpiresIn
+	}
+	return response
+}
+
+// refreshError отвечает на ошибку обновления токена: отозванный или неизвестный токен - 403
+func refreshError(w http.ResponseWriter, r *http.Request, err error) {
+	if err == types.ErrTokenNotFound {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+	//вызываем фукцию для ответа с ошибкой
+	errorWriter(w, r, http.StatusInternalServerError, err)
+}
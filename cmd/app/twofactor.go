@@ -0,0 +1,145 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/KarrenAeris/crud/cmd/app/middleware"
+	"github.com/KarrenAeris/crud/pkg/types"
+)
+
+// twoFactorCode - код из приложения-аутентификатора или код восстановления
+type twoFactorCode struct {
+	Code string `json:"code" validate:"required,max=32"`
+}
+
+func (s *Server) handleManagerVerifyChallenge(w http.ResponseWriter, r *http.Request) {
+	var item struct {
+		Challenge string `json:"challenge" validate:"required"`
+		Code      string `json:"code" validate:"required,max=32"`
+	}
+	if !s.decodeJSON(w, r, &item) {
+		return
+	}
+
+	tkn, err := s.managerSvc.VerifyChallenge(r.Context(), item.Challenge, item.Code)
+	if err != nil {
+		twoFactorError(w, r, err)
+		return
+	}
+	respondJSON(w, r, tkn)
+}
+
+func (s *Server) handleManagerEnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.managerID(w, r)
+	if !ok {
+		return
+	}
+
+	item, err := s.managerSvc.EnrollTOTP(r.Context(), id)
+	if err != nil {
+		twoFactorError(w, r, err)
+		return
+	}
+
+	// секрет отдаётся только здесь, до подтверждения кодом он не действует
+	respondJSON(w, r, item)
+}
+
+func (s *Server) handleManagerConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.managerID(w, r)
+	if !ok {
+		return
+	}
+
+	item := &twoFactorCode{}
+	if !s.decodeJSON(w, r, item) {
+		return
+	}
+
+	codes, err := s.managerSvc.ConfirmTOTP(r.Context(), id, item.Code)
+	if err != nil {
+		twoFactorError(w, r, err)
+		return
+	}
+
+	// коды восстановления показываются один раз, в БД хранятся только их хеши
+	respondJSON(w, r, map[string]interface{}{"status": "ok", "recovery_codes": codes})
+}
+
+func (s *Server) handleManagerDisableTOTP(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.managerID(w, r)
+	if !ok {
+		return
+	}
+
+	item := &twoFactorCode{}
+	if !s.decodeJSON(w, r, item) {
+		return
+	}
+
+	if err := s.managerSvc.DisableTOTP(r.Context(), id, item.Code); err != nil {
+		twoFactorError(w, r, err)
+		return
+	}
+
+	respondJSON(w, r, map[string]interface{}{"status": "ok"})
+}
+
+func (s *Server) handleManagerSetTwoFactorPolicy(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.adminID(w, r)
+	if !ok {
+		return
+	}
+
+	var item struct {
+		RequireAdmin *bool `json:"require_admin" validate:"required"`
+	}
+	if !s.decodeJSON(w, r, &item) {
+		return
+	}
+
+	if err := s.managerSvc.SetRequireAdminTOTP(r.Context(), id, *item.RequireAdmin); err != nil {
+		twoFactorError(w, r, err)
+		return
+	}
+
+	respondJSON(w, r, map[string]interface{}{"status": "ok", "require_admin": *item.RequireAdmin})
+}
+
+// managerID возвращает id аутентифицированного продавца, иначе отвечает ошибкой
+func (s *Server) managerID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return 0, false
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusForbidden, middleware.ErrNoAuthentication)
+		return 0, false
+	}
+	return id, true
+}
+
+// twoFactorError отвечает на ошибку второго фактора
+func twoFactorError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, types.ErrInvalidCode):
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+	case errors.Is(err, types.ErrTwoFactorEnabled), errors.Is(err, types.ErrTwoFactorDisabled):
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusConflict, err)
+	case errors.Is(err, types.ErrTokenNotFound):
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusForbidden, err)
+	case errors.Is(err, types.ErrTooManyAttempts):
+		// *lockout.Error тоже сводится к types.ErrTooManyAttempts, loginError добавит Retry-After
+		loginError(w, r, err, http.StatusTooManyRequests)
+	default:
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusInternalServerError, err)
+	}
+}
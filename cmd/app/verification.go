@@ -0,0 +1,99 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/KarrenAeris/crud/cmd/app/middleware"
+	"github.com/KarrenAeris/crud/pkg/types"
+)
+
+func (s *Server) handleCustomerSendPhoneCode(w http.ResponseWriter, r *http.Request) {
+	s.sendPhoneCode(w, r, types.UserCustomer)
+}
+
+func (s *Server) handleCustomerVerifyPhone(w http.ResponseWriter, r *http.Request) {
+	s.verifyPhone(w, r, types.UserCustomer)
+}
+
+func (s *Server) handleManagerSendPhoneCode(w http.ResponseWriter, r *http.Request) {
+	s.sendPhoneCode(w, r, types.UserManager)
+}
+
+func (s *Server) handleManagerVerifyPhone(w http.ResponseWriter, r *http.Request) {
+	s.verifyPhone(w, r, types.UserManager)
+}
+
+// sendPhoneCode отправляет код подтверждения на телефон текущего пользователя
+func (s *Server) sendPhoneCode(w http.ResponseWriter, r *http.Request, userType string) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	err = s.verificationSvc.SendCode(r.Context(), userType, id)
+	if err != nil {
+		codeError(w, r, err)
+		return
+	}
+
+	respondJSON(w, r, map[string]interface{}{"status": "ok"})
+}
+
+// verifyPhone проверяет код и подтверждает телефон текущего пользователя
+func (s *Server) verifyPhone(w http.ResponseWriter, r *http.Request, userType string) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	var item struct {
+		Code string `json:"code" validate:"required,max=16"`
+	}
+	if !s.decodeJSON(w, r, &item) {
+		return
+	}
+
+	err = s.verificationSvc.Verify(r.Context(), userType, id, item.Code)
+	if err != nil {
+		codeError(w, r, err)
+		return
+	}
+
+	respondJSON(w, r, map[string]interface{}{"status": "ok", "phone_verified": true})
+}
+
+// codeError отвечает на ошибку одноразового кода: подтверждения телефона или сброса пароля
+func codeError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, types.ErrInvalidCode):
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusBadRequest, err)
+	case errors.Is(err, types.ErrPhoneVerified):
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusConflict, err)
+	case errors.Is(err, types.ErrTooManyAttempts):
+		// *lockout.Error тоже сводится к types.ErrTooManyAttempts, loginError добавит Retry-After
+		loginError(w, r, err, http.StatusTooManyRequests)
+	case errors.Is(err, types.ErrNotFound):
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusNotFound, err)
+	default:
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, r, http.StatusInternalServerError, err)
+	}
+}
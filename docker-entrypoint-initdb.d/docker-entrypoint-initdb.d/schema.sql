@@ -5,6 +5,7 @@ CREATE TABLE products
     name    TEXT      NOT NULL,
     price   INTEGER   NOT NULL CHECK (price > 0),
     qty     INTEGER   NOT NULL DEFAULT 0 CHECK (qty >= 0),
+    category TEXT     NOT NULL DEFAULT '',
     active  BOOLEAN   NOT NULL DEFAULT TRUE,
     created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
@@ -71,4 +72,330 @@ CREATE TABLE managers_tokens
     manager_id BIGINT    NOT NULL references managers,
     expire     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP + INTERVAL '1 hour',
     created    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
-);
\ No newline at end of file
+);
+
+-- корзина покупателя (позиции до оформления заказа)
+CREATE TABLE carts_positions
+(
+    customer_id BIGINT    NOT NULL REFERENCES customers,
+    product_id  BIGINT    NOT NULL REFERENCES products,
+    qty         INTEGER   NOT NULL CHECK (qty > 0),
+    created     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (customer_id, product_id)
+);
+
+-- таблица заказов покупателей
+CREATE TABLE orders
+(
+    id          BIGSERIAL PRIMARY KEY,
+    customer_id BIGINT    NOT NULL REFERENCES customers,
+    manager_id  BIGINT    REFERENCES managers,
+    sale_id     BIGINT    REFERENCES sales,
+    status      TEXT      NOT NULL DEFAULT 'pending',
+    created     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- позиции заказа
+CREATE TABLE orders_positions
+(
+    id         BIGSERIAL PRIMARY KEY,
+    order_id   BIGINT    NOT NULL REFERENCES orders,
+    product_id BIGINT    NOT NULL REFERENCES products,
+    price      INTEGER   NOT NULL CHECK (price >= 0),
+    qty        INTEGER   NOT NULL CHECK (qty > 0),
+    created    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- резервы товара под заказы покупателей и черновики продаж
+CREATE TABLE reservations
+(
+    id         BIGSERIAL PRIMARY KEY,
+    product_id BIGINT    NOT NULL REFERENCES products,
+    qty        INTEGER   NOT NULL CHECK (qty > 0),
+    order_id   BIGINT    REFERENCES orders,
+    manager_id BIGINT    REFERENCES managers,
+    expire     TIMESTAMP NOT NULL,
+    created    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX reservations_product_id_idx ON reservations (product_id);
+
+-- ключи идемпотентности: первый ответ на запрос, повторяемый при ретраях
+CREATE TABLE idempotency_keys
+(
+    key          TEXT      NOT NULL,
+    user_id      BIGINT    NOT NULL,
+    endpoint     TEXT      NOT NULL,
+    request_hash TEXT      NOT NULL,
+    status       INTEGER   NOT NULL DEFAULT 0,
+    content_type TEXT      NOT NULL DEFAULT '',
+    body         BYTEA,
+    expire       TIMESTAMP NOT NULL,
+    created      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, endpoint, key)
+);
+
+-- ставки комиссии по уровням выполнения плана (rate - в сотых долях процента)
+CREATE TABLE commission_tiers
+(
+    min_percent INTEGER   NOT NULL PRIMARY KEY CHECK (min_percent >= 0),
+    rate        INTEGER   NOT NULL CHECK (rate >= 0)
+);
+
+-- ставки комиссии для отдельных категорий товара, заменяют ставку уровня
+CREATE TABLE commission_categories
+(
+    category    TEXT      NOT NULL PRIMARY KEY,
+    rate        INTEGER   NOT NULL CHECK (rate >= 0)
+);
+
+-- расчёты зарплаты за месяц, после блокировки не меняются
+CREATE TABLE payrolls
+(
+    id         BIGSERIAL PRIMARY KEY,
+    period     DATE      NOT NULL,
+    status     TEXT      NOT NULL DEFAULT 'draft',
+    created_by BIGINT    NOT NULL REFERENCES managers,
+    locked_by  BIGINT    REFERENCES managers,
+    locked     TIMESTAMP,
+    created    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX payrolls_locked_period_idx ON payrolls (period) WHERE status = 'locked';
+
+-- начисления продавцам в расчёте зарплаты
+CREATE TABLE payrolls_items
+(
+    payroll_id BIGINT    NOT NULL REFERENCES payrolls,
+    manager_id BIGINT    NOT NULL REFERENCES managers,
+    salary     BIGINT    NOT NULL,
+    plan       BIGINT    NOT NULL,
+    revenue    BIGINT    NOT NULL,
+    commission BIGINT    NOT NULL,
+    total      BIGINT    NOT NULL,
+    PRIMARY KEY (payroll_id, manager_id)
+);
+
+-- сводные таблицы аналитики, обновляются инкрементально по позициям продаж.
+-- Позиции отбираются по номеру вставившей их транзакции, а не по id: id выдаются до коммита,
+-- и продажа с меньшим id может стать видимой позже продажи с большим
+ALTER TABLE sales_positions ADD COLUMN txid BIGINT NOT NULL DEFAULT txid_current();
+CREATE INDEX sales_positions_txid_idx ON sales_positions (txid);
+
+CREATE TABLE analytics_watermarks
+(
+    name      TEXT   NOT NULL PRIMARY KEY,
+    last_txid BIGINT NOT NULL DEFAULT 0
+);
+
+INSERT INTO analytics_watermarks(name) VALUES ('sales');
+
+-- продажи по дням
+CREATE TABLE analytics_sales_daily
+(
+    day     DATE   NOT NULL PRIMARY KEY,
+    sales   BIGINT NOT NULL DEFAULT 0,
+    units   BIGINT NOT NULL DEFAULT 0,
+    revenue BIGINT NOT NULL DEFAULT 0
+);
+
+-- продажи товаров по дням
+CREATE TABLE analytics_products_daily
+(
+    day        DATE   NOT NULL,
+    product_id BIGINT NOT NULL REFERENCES products,
+    qty        BIGINT NOT NULL DEFAULT 0,
+    revenue    BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (day, product_id)
+);
+
+-- покупки каждого покупателя: дата первой покупки и число продаж
+CREATE TABLE analytics_customers
+(
+    customer_id BIGINT NOT NULL PRIMARY KEY,
+    first_day   DATE   NOT NULL,
+    sales       BIGINT NOT NULL DEFAULT 0
+);
+
+-- журнал изменений: кто, что и как поменял
+CREATE TABLE audit_log
+(
+    id         BIGSERIAL PRIMARY KEY,
+    actor_type TEXT      NOT NULL,
+    actor_id   BIGINT    NOT NULL,
+    action     TEXT      NOT NULL,
+    entity     TEXT      NOT NULL,
+    entity_id  BIGINT    NOT NULL,
+    before     JSONB,
+    after      JSONB,
+    diff       JSONB     NOT NULL DEFAULT '{}',
+    ip         TEXT      NOT NULL DEFAULT '',
+    created    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX audit_log_entity_idx ON audit_log (entity, entity_id);
+CREATE INDEX audit_log_actor_idx ON audit_log (actor_type, actor_id);
+
+-- телефоны хранятся в формате E.164 (+992900000123) и подтверждаются одноразовым кодом из SMS.
+-- Существующие базы обновляет sql/migrations/001_phones_e164.sql
+ALTER TABLE customers ADD COLUMN phone_verified BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE managers ADD COLUMN phone_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- номера, которые нельзя привести к E.164 автоматически, не меняются и попадают сюда для ручного разбора:
+-- invalid - после нормализации не номер (меньше 8 или больше 15 цифр, код страны с 0), по нему не войти;
+-- duplicate - совпадает с номером другого пользователя. Номер остаётся у того, чей номер уже в E.164,
+-- иначе у пользователя с меньшим id
+CREATE TABLE phone_conflicts
+(
+    user_type  TEXT      NOT NULL,
+    user_id    BIGINT    NOT NULL,
+    phone      TEXT      NOT NULL,
+    normalized TEXT      NOT NULL,
+    reason     TEXT      NOT NULL,
+    created    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_type, user_id)
+);
+
+INSERT INTO phone_conflicts(user_type, user_id, phone, normalized, reason)
+SELECT 'customer', id, phone, normalized,
+       CASE WHEN normalized !~ '^\+[1-9][0-9]{7,14}$' THEN 'invalid' ELSE 'duplicate' END
+FROM (
+    SELECT id, phone, normalized,
+           row_number() OVER (PARTITION BY normalized ORDER BY phone = normalized DESC, id) AS n
+    FROM (
+        SELECT id, phone, '+' || regexp_replace(regexp_replace(phone, '[^0-9]', '', 'g'), '^00', '') AS normalized
+        FROM customers
+    ) c
+) c
+WHERE normalized !~ '^\+[1-9][0-9]{7,14}$' OR n > 1;
+
+INSERT INTO phone_conflicts(user_type, user_id, phone, normalized, reason)
+SELECT 'manager', id, phone, normalized,
+       CASE WHEN normalized !~ '^\+[1-9][0-9]{7,14}$' THEN 'invalid' ELSE 'duplicate' END
+FROM (
+    SELECT id, phone, normalized,
+           row_number() OVER (PARTITION BY normalized ORDER BY phone = normalized DESC, id) AS n
+    FROM (
+        SELECT id, phone, '+' || regexp_replace(regexp_replace(phone, '[^0-9]', '', 'g'), '^00', '') AS normalized
+        FROM managers
+    ) m
+) m
+WHERE normalized !~ '^\+[1-9][0-9]{7,14}$' OR n > 1;
+
+UPDATE customers SET phone = '+' || regexp_replace(regexp_replace(phone, '[^0-9]', '', 'g'), '^00', '')
+WHERE phone !~ '^\+[1-9][0-9]+$'
+  AND id NOT IN (SELECT user_id FROM phone_conflicts WHERE user_type = 'customer');
+UPDATE managers SET phone = '+' || regexp_replace(regexp_replace(phone, '[^0-9]', '', 'g'), '^00', '')
+WHERE phone !~ '^\+[1-9][0-9]+$'
+  AND id NOT IN (SELECT user_id FROM phone_conflicts WHERE user_type = 'manager');
+
+-- код подтверждения телефона, у пользователя не больше одного
+CREATE TABLE phone_codes
+(
+    user_type TEXT      NOT NULL,
+    user_id   BIGINT    NOT NULL,
+    phone     TEXT      NOT NULL,
+    code_hash TEXT      NOT NULL,
+    attempts  INTEGER   NOT NULL DEFAULT 0,
+    expire    TIMESTAMP NOT NULL,
+    created   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_type, user_id)
+);
+
+-- код сброса пароля, у пользователя не больше одного
+CREATE TABLE password_resets
+(
+    user_type TEXT      NOT NULL,
+    user_id   BIGINT    NOT NULL,
+    phone     TEXT      NOT NULL,
+    code_hash TEXT      NOT NULL,
+    attempts  INTEGER   NOT NULL DEFAULT 0,
+    expire    TIMESTAMP NOT NULL,
+    created   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_type, user_id)
+);
+
+-- неудачные попытки входа по телефону (customer:+7..., manager:+7...) и по адресу (ip:...)
+CREATE TABLE login_failures
+(
+    key          TEXT      NOT NULL PRIMARY KEY,
+    failures     INTEGER   NOT NULL,
+    last_failure TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP
+);
+
+-- в таблицах токенов хранится только SHA-256 токена (64 hex символа), а не сам токен.
+-- Выданные раньше токены хранились открыто, поэтому удаляются: пользователям нужно войти заново.
+-- Сохранённые ответы на запросы с ключом идемпотентности тоже могли содержать токены.
+-- Существующие базы обновляет sql/migrations/002_token_hashes.sql
+DELETE FROM customers_tokens;
+DELETE FROM managers_tokens;
+DELETE FROM idempotency_keys;
+ALTER TABLE customers_tokens RENAME COLUMN token TO token_hash;
+ALTER TABLE managers_tokens RENAME COLUMN token TO token_hash;
+ALTER TABLE customers_tokens ADD CONSTRAINT customers_tokens_hash_check CHECK (token_hash ~ '^[0-9a-f]{64}$');
+ALTER TABLE managers_tokens ADD CONSTRAINT managers_tokens_hash_check CHECK (token_hash ~ '^[0-9a-f]{64}$');
+
+-- ключи API для интеграций (склад и т.п.). Ключ хранится только как SHA-256, prefix - начало ключа для списка.
+-- Ключ действует от имени создавшего его админа и только на маршрутах из scopes
+CREATE TABLE api_keys
+(
+    id         BIGSERIAL PRIMARY KEY,
+    manager_id BIGINT    NOT NULL REFERENCES managers,
+    name       TEXT      NOT NULL,
+    prefix     TEXT      NOT NULL,
+    key_hash   TEXT      NOT NULL UNIQUE CHECK (key_hash ~ '^[0-9a-f]{64}$'),
+    scopes     TEXT[]    NOT NULL,
+    expire     TIMESTAMP NOT NULL,
+    last_used  TIMESTAMP,
+    revoked    TIMESTAMP,
+    created    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- второй фактор продавцов (TOTP, RFC 6238). enabled = false - секрет создан, но ещё не подтверждён кодом.
+-- last_step - период последнего принятого кода, коды не новее него повторно не принимаются
+CREATE TABLE manager_totp
+(
+    manager_id BIGINT    NOT NULL PRIMARY KEY REFERENCES managers,
+    secret     TEXT      NOT NULL,
+    enabled    BOOLEAN   NOT NULL DEFAULT FALSE,
+    last_step  BIGINT    NOT NULL DEFAULT 0,
+    created    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- одноразовые коды восстановления второго фактора, хранится только SHA-256
+CREATE TABLE manager_recovery_codes
+(
+    manager_id BIGINT NOT NULL REFERENCES managers,
+    code_hash  TEXT   NOT NULL CHECK (code_hash ~ '^[0-9a-f]{64}$'),
+    PRIMARY KEY (manager_id, code_hash)
+);
+
+-- входы, прошедшие проверку пароля и ждущие код второго фактора
+CREATE TABLE login_challenges
+(
+    token_hash TEXT      NOT NULL PRIMARY KEY CHECK (token_hash ~ '^[0-9a-f]{64}$'),
+    manager_id BIGINT    NOT NULL REFERENCES managers,
+    attempts   INTEGER   NOT NULL DEFAULT 0,
+    expire     TIMESTAMP NOT NULL
+);
+
+-- настройки входа, всегда одна строка
+CREATE TABLE auth_policy
+(
+    id                 BOOLEAN NOT NULL PRIMARY KEY DEFAULT TRUE CHECK (id),
+    require_admin_totp BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+-- сессии: у каждого токена id для списка и отзыва, устройство входа и время последнего использования.
+-- user_agent и ip обновляются вместе с last_seen, не чаще раза в минуту
+ALTER TABLE customers_tokens ADD COLUMN id BIGSERIAL PRIMARY KEY;
+ALTER TABLE customers_tokens ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE customers_tokens ADD COLUMN ip TEXT NOT NULL DEFAULT '';
+ALTER TABLE customers_tokens ADD COLUMN last_seen TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE managers_tokens ADD COLUMN id BIGSERIAL PRIMARY KEY;
+ALTER TABLE managers_tokens ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE managers_tokens ADD COLUMN ip TEXT NOT NULL DEFAULT '';
+ALTER TABLE managers_tokens ADD COLUMN last_seen TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+CREATE INDEX customers_tokens_customer_idx ON customers_tokens (customer_id);
+CREATE INDEX managers_tokens_manager_idx ON managers_tokens (manager_id);
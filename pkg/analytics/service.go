@@ -0,0 +1,318 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/KarrenAeris/crud/pkg/logger"
+	"github.com/KarrenAeris/crud/pkg/types"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Размер корзины временного ряда и сортировка топа товаров
+const (
+	BucketDay   = "day"
+	BucketWeek  = "week"
+	BucketMonth = "month"
+
+	ByRevenue = "revenue"
+	ByQty     = "qty"
+)
+
+var (
+	//ErrInvalidBucket возвращается, когда указан неизвестный размер корзины
+	ErrInvalidBucket = errors.New("invalid bucket")
+
+	//ErrInvalidOrder возвращается, когда указана неизвестная сортировка
+	ErrInvalidOrder = errors.New("invalid order")
+)
+
+//Service описывает сервис аналитики продаж.
+//Отчёты читают только сводные таблицы analytics_*, которые обновляет Refresh.
+type Service struct {
+	pool *pgxpool.Pool
+}
+
+//NewService создаёт сервис.
+func NewService(pool *pgxpool.Pool) *Service {
+	return &Service{pool: pool}
+}
+
+//Refresh добавляет в сводные таблицы позиции продаж, появившиеся после прошлого обновления
+func (s *Service) Refresh(ctx context.Context) error {
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	if err = refresh(ctx, tx); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	return nil
+}
+
+//Rebuild пересчитывает сводные таблицы с нуля одной транзакцией: отчёты не видят пустых таблиц
+func (s *Service) Rebuild(ctx context.Context) error {
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	// строку водяного знака блокируем первой, как и Refresh, чтобы не получить взаимную блокировку
+	sqlstmt := `
+	select last_txid from analytics_watermarks where name = 'sales' for update;
+	truncate analytics_sales_daily, analytics_products_daily, analytics_customers;
+	update analytics_watermarks set last_txid = 0 where name = 'sales';`
+
+	if _, err = tx.Exec(ctx, sqlstmt); err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+
+	if err = refresh(ctx, tx); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	return nil
+}
+
+//refresh переносит в сводные таблицы позиции транзакций из [last_txid, upper), где upper -
+//наименьшая транзакция, которая ещё может быть не завершена. Все транзакции ниже upper
+//закончились, поэтому их позиции уже видны и ни одна не будет пропущена или посчитана дважды
+func refresh(ctx context.Context, tx pgx.Tx) error {
+
+	// блокировка строки не даёт двум обновлениям посчитать одни позиции дважды
+	var last, upper int64
+	err := tx.QueryRow(ctx, `select last_txid from analytics_watermarks where name = 'sales' for update`).Scan(&last)
+	if err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	if err = tx.QueryRow(ctx, `select txid_snapshot_xmin(txid_current_snapshot())`).Scan(&upper); err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	if upper <= last {
+		return nil
+	}
+
+	// позиции одной продажи вставляются в одной транзакции, поэтому продажа целиком попадает в одно обновление
+	statements := []string{`
+	insert into analytics_sales_daily(day, sales, units, revenue)
+	select s.created::date, count(distinct s.id), sum(sp.qty), sum(sp.qty * sp.price)
+	from sales_positions sp join sales s on s.id = sp.sale_id
+	where sp.txid >= $1 and sp.txid < $2
+	group by 1
+	on conflict (day) do update set
+		sales = analytics_sales_daily.sales + excluded.sales,
+		units = analytics_sales_daily.units + excluded.units,
+		revenue = analytics_sales_daily.revenue + excluded.revenue`, `
+	insert into analytics_products_daily(day, product_id, qty, revenue)
+	select s.created::date, sp.product_id, sum(sp.qty), sum(sp.qty * sp.price)
+	from sales_positions sp join sales s on s.id = sp.sale_id
+	where sp.txid >= $1 and sp.txid < $2
+	group by 1, 2
+	on conflict (day, product_id) do update set
+		qty = analytics_products_daily.qty + excluded.qty,
+		revenue = analytics_products_daily.revenue + excluded.revenue`, `
+	insert into analytics_customers(customer_id, first_day, sales)
+	select s.customer_id, min(s.created::date), count(distinct s.id)
+	from sales_positions sp join sales s on s.id = sp.sale_id
+	where sp.txid >= $1 and sp.txid < $2 and s.customer_id <> 0
+	group by 1
+	on conflict (customer_id) do update set
+		first_day = least(analytics_customers.first_day, excluded.first_day),
+		sales = analytics_customers.sales + excluded.sales`,
+	}
+	for _, sqlstmt := range statements {
+		if _, err = tx.Exec(ctx, sqlstmt, last, upper); err != nil {
+			logger.Error(ctx, err)
+			return types.ErrInternal
+		}
+	}
+
+	_, err = tx.Exec(ctx, `update analytics_watermarks set last_txid = $1 where name = 'sales'`, upper)
+	if err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	return nil
+}
+
+//RunRefresher периодически обновляет сводные таблицы, пока не отменён ctx
+func (s *Service) RunRefresher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Refresh(ctx); err != nil {
+				logger.Error(ctx, err)
+			}
+		}
+	}
+}
+
+//Revenue возвращает выручку за [from, to) по корзинам bucket
+func (s *Service) Revenue(ctx context.Context, from, to time.Time, bucket string) ([]*types.RevenuePoint, error) {
+
+	if bucket != BucketDay && bucket != BucketWeek && bucket != BucketMonth {
+		return nil, ErrInvalidBucket
+	}
+
+	items := make([]*types.RevenuePoint, 0)
+
+	sqlstmt := `
+	select date_trunc($3::text, day) period, sum(sales), sum(units), sum(revenue)
+	from analytics_sales_daily
+	where day >= $1 and day < $2
+	group by period
+	order by period`
+
+	rows, err := s.pool.Query(ctx, sqlstmt, from, to, bucket)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &types.RevenuePoint{}
+		if err = rows.Scan(&item.Period, &item.Sales, &item.Units, &item.Revenue); err != nil {
+			logger.Error(ctx, err)
+			return nil, types.ErrInternal
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+//TopProducts возвращает limit самых продаваемых товаров за [from, to) по выручке или количеству
+func (s *Service) TopProducts(ctx context.Context, from, to time.Time, by string, limit int) ([]*types.ProductStat, error) {
+
+	// имя колонки не передать параметром, поэтому выбираем из двух готовых запросов
+	orderBy := ""
+	switch by {
+	case ByRevenue:
+		orderBy = "revenue desc, qty desc"
+	case ByQty:
+		orderBy = "qty desc, revenue desc"
+	default:
+		return nil, ErrInvalidOrder
+	}
+
+	items := make([]*types.ProductStat, 0)
+
+	sqlstmt := `
+	select a.product_id, p.name, sum(a.qty) qty, sum(a.revenue) revenue
+	from analytics_products_daily a
+	join products p on p.id = a.product_id
+	where a.day >= $1 and a.day < $2
+	group by a.product_id, p.name
+	order by ` + orderBy + `
+	limit $3`
+
+	rows, err := s.pool.Query(ctx, sqlstmt, from, to, limit)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &types.ProductStat{}
+		if err = rows.Scan(&item.ProductID, &item.Name, &item.Qty, &item.Revenue); err != nil {
+			logger.Error(ctx, err)
+			return nil, types.ErrInternal
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+//Basket возвращает средний чек в деньгах и в штуках за [from, to)
+func (s *Service) Basket(ctx context.Context, from, to time.Time) (*types.BasketStat, error) {
+
+	item := &types.BasketStat{}
+
+	sqlstmt := `
+	select coalesce(sum(sales), 0), coalesce(sum(units), 0), coalesce(sum(revenue), 0)
+	from analytics_sales_daily
+	where day >= $1 and day < $2`
+
+	err := s.pool.QueryRow(ctx, sqlstmt, from, to).Scan(&item.Sales, &item.Units, &item.Revenue)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+
+	if item.Sales > 0 {
+		item.AverageRevenue = float64(item.Revenue) / float64(item.Sales)
+		item.AverageUnits = float64(item.Units) / float64(item.Sales)
+	}
+	return item, nil
+}
+
+//Customers возвращает долю покупателей с повторными покупками, в целом и по месяцу первой покупки
+func (s *Service) Customers(ctx context.Context) (*types.CustomerStat, error) {
+
+	stat := &types.CustomerStat{Cohorts: make([]*types.Cohort, 0)}
+
+	sqlstmt := `
+	select date_trunc('month', first_day) period, count(*), count(*) filter (where sales > 1)
+	from analytics_customers
+	group by period
+	order by period`
+
+	rows, err := s.pool.Query(ctx, sqlstmt)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		cohort := &types.Cohort{}
+		if err = rows.Scan(&cohort.Period, &cohort.Customers, &cohort.Repeat); err != nil {
+			logger.Error(ctx, err)
+			return nil, types.ErrInternal
+		}
+		cohort.RepeatRate = rate(cohort.Repeat, cohort.Customers)
+		stat.Customers += cohort.Customers
+		stat.Repeat += cohort.Repeat
+		stat.Cohorts = append(stat.Cohorts, cohort)
+	}
+	stat.RepeatRate = rate(stat.Repeat, stat.Customers)
+
+	return stat, nil
+}
+
+func rate(part, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total)
+}
@@ -0,0 +1,159 @@
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/KarrenAeris/crud/pkg/audit"
+	"github.com/KarrenAeris/crud/pkg/logger"
+	"github.com/KarrenAeris/crud/pkg/store"
+	"github.com/KarrenAeris/crud/pkg/types"
+	"github.com/KarrenAeris/crud/pkg/utils"
+)
+
+// Области доступа ключей
+const (
+	ScopeProductsRead  = "products:read"  // список товаров и остатков
+	ScopeProductsWrite = "products:write" // создание, изменение (в том числе остатка) и удаление товаров
+)
+
+//Scopes - все области доступа ключей
+var Scopes = []string{ScopeProductsRead, ScopeProductsWrite}
+
+// KeyPrefix - начало каждого ключа, по нему ключ легко узнать в конфигурации и логах
+const KeyPrefix = "ak_"
+
+// LastUsedInterval - как часто обновляется время последнего использования ключа
+const LastUsedInterval = time.Minute
+
+var (
+	//ErrUnknownScope возвращается, когда запрошена неизвестная область доступа
+	ErrUnknownScope = errors.New("unknown scope")
+
+	//ErrInvalidExpire возвращается, когда срок действия ключа уже прошёл
+	ErrInvalidExpire = errors.New("expire must be in the future")
+)
+
+//Service описывает сервис ключей API для интеграций (например, склада).
+//Ключ действует от имени создавшего его админа, но только на маршрутах своих областей доступа
+type Service struct {
+	store    store.Store
+	auditSvc *audit.Service
+}
+
+//NewService создаёт сервис.
+func NewService(st store.Store, auditSvc *audit.Service) *Service {
+	return &Service{store: st, auditSvc: auditSvc}
+}
+
+//Create создаёт ключ админа managerID и возвращает сам ключ (он показывается только один раз) и его запись.
+func (s *Service) Create(ctx context.Context, managerID int64, name string, scopes []string, expire time.Time) (string, *types.APIKey, error) {
+	for _, scope := range scopes {
+		if !hasScope(Scopes, scope) {
+			return "", nil, ErrUnknownScope
+		}
+	}
+	if !expire.After(time.Now()) {
+		return "", nil, ErrInvalidExpire
+	}
+
+	buffer := make([]byte, 32)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", nil, types.ErrInternal
+	}
+	key := KeyPrefix + hex.EncodeToString(buffer)
+
+	item := &types.APIKey{
+		ManagerID: managerID,
+		Name:      strings.TrimSpace(name),
+		Prefix:    key[:len(KeyPrefix)+8],
+		Scopes:    uniqueScopes(scopes),
+		Expire:    expire.UTC(),
+	}
+	item, err := s.store.CreateAPIKey(ctx, item, utils.HashToken(key))
+	if err != nil {
+		return "", nil, err
+	}
+
+	s.auditSvc.Record(ctx, "create", "api_key", item.ID, nil, item)
+	return key, item, nil
+}
+
+//All возвращает все ключи, в том числе отозванные и истёкшие.
+func (s *Service) All(ctx context.Context) ([]*types.APIKey, error) {
+	return s.store.APIKeys(ctx)
+}
+
+//Revoke отзывает ключ, types.ErrNotFound - ключа нет.
+func (s *Service) Revoke(ctx context.Context, id int64) (*types.APIKey, error) {
+	before, err := s.store.APIKeyByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := s.store.RevokeAPIKey(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if before.Revoked == nil {
+		s.auditSvc.Record(ctx, "update", "api_key", id, before, item)
+	}
+	return item, nil
+}
+
+//Authenticate проверяет ключ и отмечает его использование. Неизвестный, отозванный или истёкший ключ - nil без ошибки.
+func (s *Service) Authenticate(ctx context.Context, key string) (*types.APIKey, error) {
+	if !strings.HasPrefix(key, KeyPrefix) {
+		return nil, nil
+	}
+
+	item, err := s.store.APIKeyByHash(ctx, utils.HashToken(key))
+	if err == types.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if item.Revoked != nil || !now.Before(item.Expire) {
+		logger.Warn(ctx, "inactive api key", "api_key_id", item.ID)
+		return nil, nil
+	}
+
+	// без отметки ключ всё равно работает, поэтому ошибка только логируется
+	if err = s.store.TouchAPIKey(ctx, item.ID, now, now.Add(-LastUsedInterval)); err != nil {
+		logger.Error(ctx, err)
+	}
+	return item, nil
+}
+
+//HasScope проверяет, есть ли у ключа область доступа scope.
+func HasScope(key *types.APIKey, scope string) bool {
+	return hasScope(key.Scopes, scope)
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, item := range scopes {
+		if item == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueScopes убирает повторы, сохраняя порядок
+func uniqueScopes(scopes []string) []string {
+	result := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if !hasScope(result, scope) {
+			result = append(result, scope)
+		}
+	}
+	return result
+}
@@ -0,0 +1,181 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/KarrenAeris/crud/pkg/logger"
+	"github.com/KarrenAeris/crud/pkg/types"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Кто выполняет действие
+const (
+	ActorCustomer = "customer"
+	ActorManager  = "manager"
+	ActorSystem   = "system"
+	ActorAPIKey   = "api_key"
+)
+
+// поля, которые не попадают в журнал
+var redactedFields = map[string]bool{"password": true}
+
+var actorContextKey = &contextKey{"audit actor"}
+
+type contextKey struct {
+	name string
+}
+
+func (c *contextKey) String() string {
+	return c.name
+}
+
+//Actor представляет того, кто выполняет действие.
+type Actor struct {
+	Type string
+	ID   int64
+	IP   string
+}
+
+//WithActor кладёт в контекст того, кто выполняет действие
+func WithActor(ctx context.Context, actor *Actor) context.Context {
+	return context.WithValue(ctx, actorContextKey, actor)
+}
+
+//ActorFrom возвращает того, кто выполняет действие; без него действие считается системным
+func ActorFrom(ctx context.Context) *Actor {
+	if actor, ok := ctx.Value(actorContextKey).(*Actor); ok {
+		return actor
+	}
+	return &Actor{Type: ActorSystem}
+}
+
+//Service описывает сервис журнала изменений.
+type Service struct {
+	pool *pgxpool.Pool
+}
+
+//NewService создаёт сервис.
+func NewService(pool *pgxpool.Pool) *Service {
+	return &Service{pool: pool}
+}
+
+//Record записывает изменение сущности entity: состояние до (nil при создании) и после (nil при удалении).
+//Ошибка записи только логируется, чтобы журнал не ломал основное действие. Без сервиса (nil) ничего не пишет
+func (s *Service) Record(ctx context.Context, action, entity string, entityID int64, before, after interface{}) {
+	if s == nil {
+		return
+	}
+	actor := ActorFrom(ctx)
+
+	beforeMap, err := toMap(before)
+	if err != nil {
+		logger.Error(ctx, err)
+		return
+	}
+	afterMap, err := toMap(after)
+	if err != nil {
+		logger.Error(ctx, err)
+		return
+	}
+
+	sqlstmt := `
+	insert into audit_log(actor_type, actor_id, action, entity, entity_id, before, after, diff, ip)
+	values ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+	_, err = s.pool.Exec(ctx, sqlstmt, actor.Type, actor.ID, action, entity, entityID,
+		beforeMap, afterMap, Diff(beforeMap, afterMap), actor.IP)
+	if err != nil {
+		logger.Error(ctx, err)
+	}
+}
+
+//Diff возвращает изменившиеся поля в виде {"поле": {"before": ..., "after": ...}}
+func Diff(before, after map[string]interface{}) map[string]interface{} {
+	diff := make(map[string]interface{})
+
+	for key, value := range before {
+		if !reflect.DeepEqual(value, after[key]) {
+			diff[key] = map[string]interface{}{"before": value, "after": after[key]}
+		}
+	}
+	for key, value := range after {
+		if _, ok := before[key]; !ok {
+			diff[key] = map[string]interface{}{"before": nil, "after": value}
+		}
+	}
+	return diff
+}
+
+// toMap приводит сущность к JSON объекту без скрытых полей
+func toMap(item interface{}) (map[string]interface{}, error) {
+	if item == nil || reflect.ValueOf(item).Kind() == reflect.Ptr && reflect.ValueOf(item).IsNil() {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]interface{})
+	if err = json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	for key := range redactedFields {
+		delete(result, key)
+	}
+	return result, nil
+}
+
+//Entries возвращает записи журнала по фильтру, новые первыми
+func (s *Service) Entries(ctx context.Context, filter *types.AuditFilter) ([]*types.AuditEntry, error) {
+
+	items := make([]*types.AuditEntry, 0)
+
+	if filter.Limit <= 0 || filter.Limit > 500 {
+		filter.Limit = 500
+	}
+	if filter.To.IsZero() {
+		filter.To = time.Now().AddDate(100, 0, 0)
+	}
+
+	sqlstmt := `
+	select id, actor_type, actor_id, action, entity, entity_id,
+		coalesce(before, 'null'), coalesce(after, 'null'), diff, ip, created
+	from audit_log
+	where ($1 = '' or actor_type = $1)
+		and ($2 = 0 or actor_id = $2)
+		and ($3 = '' or action = $3)
+		and ($4 = '' or entity = $4)
+		and ($5 = 0 or entity_id = $5)
+		and created >= $6 and created < $7
+	order by id desc
+	limit $8 offset $9`
+
+	rows, err := s.pool.Query(ctx, sqlstmt, filter.ActorType, filter.ActorID, filter.Action, filter.Entity,
+		filter.EntityID, filter.From, filter.To, filter.Limit, filter.Offset)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &types.AuditEntry{}
+		var before, after, diff []byte
+		err = rows.Scan(&item.ID, &item.ActorType, &item.ActorID, &item.Action, &item.Entity, &item.EntityID,
+			&before, &after, &diff, &item.IP, &item.Created)
+		if err != nil {
+			logger.Error(ctx, err)
+			return nil, types.ErrInternal
+		}
+		item.Before, item.After, item.Diff = before, after, diff
+		items = append(items, item)
+	}
+
+	return items, nil
+}
@@ -0,0 +1,146 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/KarrenAeris/crud/pkg/logger"
+)
+
+// версии TLS, которые можно задать минимальной
+var versions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+//ParseVersion возвращает версию TLS по строке "1.0" ... "1.3"
+func ParseVersion(version string) (uint16, error) {
+	value, ok := versions[version]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q", version)
+	}
+	return value, nil
+}
+
+//LoadPool загружает сертификаты удостоверяющих центров в PEM из файла
+func LoadPool(file string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates in %s", file)
+	}
+	return pool, nil
+}
+
+//Reloader хранит сертификат сервера и перечитывает его, когда меняются файлы сертификата или ключа,
+//чтобы обновлённый сертификат применялся без перезапуска. Уже открытые соединения не затрагиваются
+type Reloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	certTime time.Time
+	keyTime  time.Time
+}
+
+//NewReloader загружает сертификат и ключ в PEM
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+//GetCertificate отдаёт текущий сертификат, подходит для tls.Config.GetCertificate
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert, nil
+}
+
+//Reload перечитывает сертификат, если файлы изменились с прошлой загрузки. Если новые файлы
+//не читаются или не подходят друг к другу, остаётся прежний сертификат и возвращается ошибка
+func (r *Reloader) Reload() (bool, error) {
+	certTime, err := modTime(r.certFile)
+	if err != nil {
+		return false, err
+	}
+	keyTime, err := modTime(r.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.RLock()
+	changed := r.cert == nil || !certTime.Equal(r.certTime) || !keyTime.Equal(r.keyTime)
+	r.mu.RUnlock()
+	if !changed {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, err
+	}
+	if len(cert.Certificate) == 0 {
+		return false, errors.New("empty certificate chain")
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return false, err
+	}
+
+	r.mu.Lock()
+	r.cert, r.certTime, r.keyTime = &cert, certTime, keyTime
+	r.mu.Unlock()
+	return true, nil
+}
+
+//RunWatcher периодически проверяет файлы сертификата и перечитывает их, пока не отменён ctx
+func (r *Reloader) RunWatcher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := r.Reload()
+			if err != nil {
+				// файлы могут обновляться не одновременно: попробуем на следующей проверке
+				logger.Error(ctx, err)
+				continue
+			}
+			if reloaded {
+				r.mu.RLock()
+				expire := r.cert.Leaf.NotAfter
+				r.mu.RUnlock()
+				logger.Info(ctx, "reloaded TLS certificate", "file", r.certFile, "not_after", expire.Format(time.RFC3339))
+			}
+		}
+	}
+}
+
+// modTime возвращает время изменения файла
+func modTime(file string) (time.Time, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
@@ -5,11 +5,18 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
-	"log"
 	"time"
 
-	"github.com/jackc/pgx/v4"
-	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/KarrenAeris/crud/pkg/audit"
+	"github.com/KarrenAeris/crud/pkg/jwt"
+	"github.com/KarrenAeris/crud/pkg/lockout"
+	"github.com/KarrenAeris/crud/pkg/metrics"
+	"github.com/KarrenAeris/crud/pkg/sessions"
+	"github.com/KarrenAeris/crud/pkg/store"
+	"github.com/KarrenAeris/crud/pkg/tracing"
+	"github.com/KarrenAeris/crud/pkg/types"
+	"github.com/KarrenAeris/crud/pkg/utils"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -32,280 +39,291 @@ var (
 
 //Service описывает сервис работы с покупателям.
 type Service struct {
-	pool *pgxpool.Pool
+	store      store.Store
+	auditSvc   *audit.Service
+	lockoutSvc *lockout.Service
+	signer     *jwt.Signer
 }
 
-//NewService создаёт сервис.
-func NewService(pool *pgxpool.Pool) *Service {
-	return &Service{pool: pool}
+//NewService создаёт сервис. Если signer задан, токены доступа подписываются и проверяются без БД,
+//а токен из БД служит только для их обновления; nil - токены доступа хранятся в БД
+func NewService(st store.Store, auditSvc *audit.Service, lockoutSvc *lockout.Service, signer *jwt.Signer) *Service {
+	return &Service{store: st, auditSvc: auditSvc, lockoutSvc: lockoutSvc, signer: signer}
 }
 
 //Customer представляет информацию о покупателе.
 type Customer struct {
 	ID       int64     `json:"id"`
-	Name     string    `json:"name"`
-	Phone    string    `json:"phone"`
-	Password string    `json:"password"`
+	Name     string    `json:"name" validate:"required,max=255"`
+	Phone    string    `json:"phone" validate:"required,phone"`
+	Password string    `json:"password" validate:"required,max=72"`
+	Verified bool      `json:"phone_verified"`
 	Active   bool      `json:"active"`
 	Created  time.Time `json:"created"`
 }
 
 //Product представляет информацию о покупке.
 type Product struct {
-	ID    int64  `json:"id"`
-	Name  string `json:"name"`
-	Price int    `json:"price"`
-	Qty   int    `json:"qty"`
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	Price     int    `json:"price"`
+	Qty       int    `json:"qty"`
+	Available int    `json:"available"`
 }
 
 //All ....
 func (s *Service) All(ctx context.Context) (cs []*Customer, err error) {
-
-	sqlStatement := `SELECT * FROM customers`
-
-	rows, err := s.pool.Query(ctx, sqlStatement)
-	if err != nil {
-		return nil, err
-	}
-
-	defer rows.Close()
-
-	for rows.Next() {
-		item := &Customer{}
-		err := rows.Scan(
-			&item.ID,
-			&item.Name,
-			&item.Phone,
-			&item.Active,
-			&item.Created,
-		)
-		if err != nil {
-			log.Println(err)
-		}
-
-		cs = append(cs, item)
-	}
-
-	return cs, nil
+	return s.customers(ctx, false)
 }
 
 //AllActive ....
 func (s *Service) AllActive(ctx context.Context) (cs []*Customer, err error) {
+	return s.customers(ctx, true)
+}
 
-	sqlStatement := `SELECT * FROM customers WHERE active`
-
-	rows, err := s.pool.Query(ctx, sqlStatement)
+func (s *Service) customers(ctx context.Context, activeOnly bool) ([]*Customer, error) {
+	items, err := s.store.Customers(ctx, activeOnly)
 	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		item := &Customer{}
-		err := rows.Scan(
-			&item.ID,
-			&item.Name,
-			&item.Phone,
-			&item.Active,
-			&item.Created,
-		)
-		if err != nil {
-			log.Println(err)
-		}
-		cs = append(cs, item)
+		return nil, storeError(err)
 	}
 
+	cs := make([]*Customer, 0, len(items))
+	for _, item := range items {
+		cs = append(cs, fromTypes(item))
+	}
 	return cs, nil
 }
 
 //ByID ...
 func (s *Service) ByID(ctx context.Context, id int64) (*Customer, error) {
-	item := &Customer{}
-
-	sqlStatement := `SELECT id, name, phone, active, created FROM customers WHERE id = $1`
-	err := s.pool.QueryRow(ctx, sqlStatement, id).Scan(
-		&item.ID,
-		&item.Name,
-		&item.Phone,
-		&item.Active,
-		&item.Created,
-	)
-
-	if errors.Is(err, pgx.ErrNoRows) {
-		return nil, ErrNotFound
-	}
-
+	item, err := s.store.CustomerByID(ctx, id)
 	if err != nil {
-		log.Print(err)
-		return nil, ErrInternal
+		return nil, storeError(err)
 	}
-
-	return item, nil
+	return fromTypes(item), nil
 }
 
 //ChangeActive ...
 func (s *Service) ChangeActive(ctx context.Context, id int64, active bool) (*Customer, error) {
-	item := &Customer{}
-
-	sqlStatement := `UPDATE customers SET active = $2 where id = $1 RETURNING *`
-	err := s.pool.QueryRow(ctx, sqlStatement, id, active).Scan(
-		&item.ID,
-		&item.Name,
-		&item.Phone,
-		&item.Active,
-		&item.Created,
-	)
-
-	if errors.Is(err, pgx.ErrNoRows) {
-		return nil, ErrNotFound
+
+	before, err := s.ByID(ctx, id)
+	if err != nil {
+		return nil, err
 	}
 
+	changed, err := s.store.SetCustomerActive(ctx, id, active)
 	if err != nil {
-		log.Print(err)
-		return nil, ErrInternal
+		return nil, storeError(err)
 	}
+	item := fromTypes(changed)
+
+	s.auditSvc.Record(ctx, "update", "customer", id, before, item)
 	return item, nil
 }
 
 //Delete ...
 func (s *Service) Delete(ctx context.Context, id int64) (*Customer, error) {
-	item := &Customer{}
-
-	sqlStatement := `DELETE FROM customers WHERE id = $1 RETURNING *`
-	err := s.pool.QueryRow(ctx, sqlStatement, id).Scan(
-		&item.ID,
-		&item.Name,
-		&item.Phone,
-		&item.Active,
-		&item.Created,
-	)
-
-	if errors.Is(err, pgx.ErrNoRows) {
-		return nil, ErrNotFound
-	}
 
+	removed, err := s.store.RemoveCustomer(ctx, id)
 	if err != nil {
-		log.Print(err)
-		return nil, ErrInternal
+		return nil, storeError(err)
 	}
+	item := fromTypes(removed)
 
+	s.auditSvc.Record(ctx, "delete", "customer", id, item, nil)
 	return item, nil
 }
 
-//Save ...
+//Save ... телефон сохраняется в формате E.164, неверный номер - types.ErrInvalidPhone
 func (s *Service) Save(ctx context.Context, customer *Customer) (c *Customer, err error) {
 
-	item := &Customer{}
-
-	if customer.ID == 0 {
-		sqlStatement := `INSERT INTO customers(name, phone, password) VALUES($1, $2, $3) RETURNING *`
-		err = s.pool.QueryRow(ctx, sqlStatement, customer.Name, customer.Phone, customer.Password).Scan(
-			&item.ID,
-			&item.Name,
-			&item.Phone,
-			&item.Password,
-			&item.Active,
-			&item.Created,
-		)
-	} else {
-		sqlStatement := `UPDATE customers SET name = $1, phone = $2, password = $3 WHERE id = $4 RETURNING *`
-		err = s.pool.QueryRow(ctx, sqlStatement, customer.Name, customer.Phone, customer.Password, customer.ID).Scan(
-			&item.ID,
-			&item.Name,
-			&item.Phone,
-			&item.Password,
-			&item.Active,
-			&item.Created,
-		)
+	phone, err := utils.NormalizePhone(customer.Phone)
+	if err != nil {
+		return nil, err
+	}
+
+	var before *Customer
+	if customer.ID != 0 {
+		before, err = s.ByID(ctx, customer.ID)
+		if err != nil {
+			return nil, err
+		}
 	}
 
+	saved, err := s.store.SaveCustomer(ctx, &types.Customer{ID: customer.ID, Name: customer.Name, Phone: phone}, customer.Password)
 	if err != nil {
-		log.Print(err)
-		return nil, ErrInternal
+		return nil, storeError(err)
+	}
+	item := fromTypes(saved)
+	item.Password = customer.Password
+
+	action := "update"
+	if before == nil {
+		action = "create"
 	}
+	s.auditSvc.Record(ctx, action, "customer", item.ID, before, item)
 
 	return item, nil
 }
 
-//Token .... метод для генерации токена
-func (s *Service) Token(ctx context.Context, phone, password string) (string, error) {
-
-	var hash string
-	var id int64
+//Token .... метод для генерации токена. После частых ошибок входа по телефону или с одного адреса
+//вход временно запрещён, тогда возвращается *lockout.Error
+func (s *Service) Token(ctx context.Context, phone, password string) (*types.AuthTokens, error) {
+
+	// вход по номеру в любой записи: "992 900 000 123" и "+992900000123" - один покупатель.
+	// Неверный номер пустой, по нему ограничивается только адрес клиента
+	phone, err := utils.NormalizePhone(phone)
+	// попытка засчитывается до проверки пароля и снимается, если пароль верный
+	if lockErr := s.lockoutSvc.Attempt(ctx, types.UserCustomer, phone); lockErr != nil {
+		metrics.Login(metrics.UserCustomer, false)
+		return nil, lockErr
+	}
+	if err != nil {
+		metrics.Login(metrics.UserCustomer, false)
+		return nil, ErrNoSuchUser
+	}
 
-	err := s.pool.QueryRow(ctx, "select id, password from customers where phone = $1", phone).Scan(&id, &hash)
-	if err == pgx.ErrNoRows {
-		return "", ErrNoSuchUser
+	id, hash, err := s.store.CustomerCredentials(ctx, phone)
+	if err == types.ErrNotFound {
+		metrics.Login(metrics.UserCustomer, false)
+		return nil, ErrNoSuchUser
 	}
 	if err != nil {
-		return "", ErrInternal
+		s.lockoutSvc.Release(ctx, types.UserCustomer, phone)
+		return nil, ErrInternal
 	}
 
+	_, span := tracing.Start(ctx, "bcrypt.CompareHashAndPassword")
 	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	span.End()
 	if err != nil {
-		return "", ErrInvalidPassword
+		metrics.Login(metrics.UserCustomer, false)
+		return nil, ErrInvalidPassword
 	}
+	s.lockoutSvc.Release(ctx, types.UserCustomer, phone)
 
 	//генерируем токен
 	buffer := make([]byte, 256)
 	n, err := rand.Read(buffer)
 	if n != len(buffer) || err != nil {
-		return "", ErrInternal
+		return nil, ErrInternal
 	}
 
 	token := hex.EncodeToString(buffer)
-	_, err = s.pool.Exec(ctx, "insert into customers_tokens(token, customer_id) values($1, $2)", token, id)
+	if err = s.store.SaveCustomerToken(ctx, utils.HashToken(token), id, sessions.DeviceFrom(ctx)); err != nil {
+		return nil, ErrInternal
+	}
+
+	tokens, err := s.tokens(id, token)
 	if err != nil {
-		return "", ErrInternal
+		return nil, ErrInternal
 	}
 
-	return token, nil
+	s.lockoutSvc.Succeed(ctx, types.UserCustomer, phone)
+	metrics.Login(metrics.UserCustomer, true)
+	return tokens, nil
 }
 
 //Products ...
 func (s *Service) Products(ctx context.Context) ([]*Product, error) {
 
-	items := make([]*Product, 0)
+	products, err := s.store.Products(ctx)
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	items := make([]*Product, 0, len(products))
+	for _, product := range products {
+		items = append(items, &Product{
+			ID:        product.ID,
+			Name:      product.Name,
+			Price:     product.Price,
+			Qty:       product.Qty,
+			Available: product.Available,
+		})
+	}
 
-	sqlStatement := `SELECT id, name, price, qty FROM products WHERE active = true ORDER by id LIMIT 500`
-	rows, err := s.pool.Query(ctx, sqlStatement)
+	return items, nil
+}
 
+//Refresh выдаёт новый токен доступа по токену из БД. Отозванный, истёкший или неизвестный токен - types.ErrTokenNotFound.
+//Токен из БД каждый раз заменяется новым в той же сессии, старый перестаёт действовать.
+//Без подписанных токенов токен из БД и есть токен доступа
+func (s *Service) Refresh(ctx context.Context, refreshToken string) (*types.AuthTokens, error) {
+	token, err := utils.GenerateTokenStr()
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			return items, nil
-		}
 		return nil, ErrInternal
 	}
 
-	defer rows.Close()
-
-	for rows.Next() {
-		item := &Product{}
-		err = rows.Scan(&item.ID, &item.Name, &item.Price, &item.Qty)
-		if err != nil {
-			log.Print(err)
-			return nil, err
-		}
-		items = append(items, item)
+	hash := utils.HashToken(token)
+	id, err := s.store.RotateSession(ctx, types.UserCustomer, utils.HashToken(refreshToken), hash)
+	if err == types.ErrNotFound {
+		return nil, types.ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, ErrInternal
 	}
+	sessions.Touch(ctx, s.store, types.UserCustomer, hash)
 
-	return items, nil
+	tokens, err := s.tokens(id, token)
+	if err != nil {
+		return nil, ErrInternal
+	}
+	return tokens, nil
 }
 
-//IDByToken ....
-func (s *Service) IDByToken(ctx context.Context, token string) (int64, error) {
-	var id int64
-	sqlStatement := `SELECT customer_id FROM customers_tokens WHERE token = $1`
-	err := s.pool.QueryRow(ctx, sqlStatement, token).Scan(&id)
+// tokens собирает ответ на вход по токену из БД
+func (s *Service) tokens(id int64, token string) (*types.AuthTokens, error) {
+	if s.signer == nil {
+		return &types.AuthTokens{Token: token}, nil
+	}
 
+	access, _, err := s.signer.Issue(types.UserCustomer, id, []string{types.RoleCustomer})
 	if err != nil {
+		return nil, err
+	}
+	return &types.AuthTokens{Token: access, RefreshToken: token, ExpiresIn: int64(s.signer.TTL() / time.Second)}, nil
+}
 
-		if err == pgx.ErrNoRows {
+//IDByToken .... с подписанными токенами принимается только токен доступа, токен из БД - нет.
+//Использование токена из БД отмечается в его сессии
+func (s *Service) IDByToken(ctx context.Context, token string) (int64, error) {
+	if s.signer != nil {
+		claims, err := s.signer.Parse(token, types.UserCustomer)
+		if err != nil {
 			return 0, nil
 		}
+		return claims.UserID, nil
+	}
 
+	hash := utils.HashToken(token)
+	id, err := s.store.CustomerIDByToken(ctx, hash)
+	if err == types.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
 		return 0, ErrInternal
 	}
+	sessions.Touch(ctx, s.store, types.UserCustomer, hash)
 
 	return id, nil
-}
\ No newline at end of file
+}
+
+// storeError переводит ошибки хранилища в ошибки пакета
+func storeError(err error) error {
+	if err == types.ErrNotFound {
+		return ErrNotFound
+	}
+	return ErrInternal
+}
+
+func fromTypes(item *types.Customer) *Customer {
+	return &Customer{
+		ID:       item.ID,
+		Name:     item.Name,
+		Phone:    item.Phone,
+		Verified: item.Verified,
+		Active:   item.Active,
+		Created:  item.Created,
+	}
+}
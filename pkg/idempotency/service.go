@@ -0,0 +1,142 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/KarrenAeris/crud/pkg/logger"
+	"github.com/KarrenAeris/crud/pkg/types"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+var (
+	//ErrKeyReused возвращается, когда ключ повторно используется с другим телом запроса
+	ErrKeyReused = errors.New("idempotency key reused with different request")
+
+	//ErrInProgress возвращается, когда запрос с этим ключом ещё выполняется
+	ErrInProgress = errors.New("request with this idempotency key is in progress")
+)
+
+//Response представляет сохранённый ответ на запрос.
+type Response struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+//Service описывает сервис хранения ключей идемпотентности.
+type Service struct {
+	pool *pgxpool.Pool
+	ttl  time.Duration
+}
+
+//NewService создаёт сервис, ttl - сколько хранится ключ.
+func NewService(pool *pgxpool.Pool, ttl time.Duration) *Service {
+	return &Service{pool: pool, ttl: ttl}
+}
+
+//Start занимает ключ под новый запрос. Если запрос с этим ключом уже выполнен, возвращает сохранённый ответ
+func (s *Service) Start(ctx context.Context, userID int64, endpoint, key, hash string) (*Response, error) {
+
+	// истёкший ключ можно использовать заново
+	sqlstmt := `delete from idempotency_keys where user_id = $1 and endpoint = $2 and key = $3 and expire <= now()`
+	if _, err := s.pool.Exec(ctx, sqlstmt, userID, endpoint, key); err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+
+	sqlstmt = `
+	insert into idempotency_keys(key, user_id, endpoint, request_hash, expire)
+	values ($1, $2, $3, $4, CURRENT_TIMESTAMP + $5 * interval '1 second')
+	on conflict do nothing`
+
+	tag, err := s.pool.Exec(ctx, sqlstmt, key, userID, endpoint, hash, s.ttl.Seconds())
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	if tag.RowsAffected() == 1 {
+		return nil, nil
+	}
+
+	var storedHash string
+	response := &Response{}
+	sqlstmt = `select request_hash, status, content_type, body from idempotency_keys where user_id = $1 and endpoint = $2 and key = $3`
+	err = s.pool.QueryRow(ctx, sqlstmt, userID, endpoint, key).
+		Scan(&storedHash, &response.Status, &response.ContentType, &response.Body)
+	if err == pgx.ErrNoRows {
+		// ключ успели освободить между запросами - пусть клиент повторит
+		return nil, ErrInProgress
+	}
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+
+	if storedHash != hash {
+		return nil, ErrKeyReused
+	}
+	if response.Status == 0 {
+		return nil, ErrInProgress
+	}
+
+	return response, nil
+}
+
+//Finish сохраняет ответ на запрос с ключом
+func (s *Service) Finish(ctx context.Context, userID int64, endpoint, key string, response *Response) error {
+
+	sqlstmt := `update idempotency_keys set status = $4, content_type = $5, body = $6 where user_id = $1 and endpoint = $2 and key = $3`
+	_, err := s.pool.Exec(ctx, sqlstmt, userID, endpoint, key, response.Status, response.ContentType, response.Body)
+	if err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	return nil
+}
+
+//Discard освобождает ключ, например если запрос завершился внутренней ошибкой и его можно повторить
+func (s *Service) Discard(ctx context.Context, userID int64, endpoint, key string) error {
+
+	sqlstmt := `delete from idempotency_keys where user_id = $1 and endpoint = $2 and key = $3`
+	if _, err := s.pool.Exec(ctx, sqlstmt, userID, endpoint, key); err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	return nil
+}
+
+//Sweep удаляет истёкшие ключи и возвращает их количество
+func (s *Service) Sweep(ctx context.Context) (int64, error) {
+
+	tag, err := s.pool.Exec(ctx, `delete from idempotency_keys where expire <= now()`)
+	if err != nil {
+		logger.Error(ctx, err)
+		return 0, types.ErrInternal
+	}
+	return tag.RowsAffected(), nil
+}
+
+//RunSweeper периодически удаляет истёкшие ключи, пока не отменён ctx
+func (s *Service) RunSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.Sweep(ctx)
+			if err != nil {
+				continue
+			}
+			if n > 0 {
+				logger.Info(ctx, "removed expired idempotency keys", "count", n)
+			}
+		}
+	}
+}
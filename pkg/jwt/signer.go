@@ -0,0 +1,164 @@
+package jwt
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v4"
+
+	"github.com/KarrenAeris/crud/pkg/types"
+	"github.com/KarrenAeris/crud/pkg/utils"
+)
+
+//MinKeySize - наименьшая длина ключа подписи в байтах (256 бит для HS256)
+const MinKeySize = 32
+
+var (
+	//ErrInvalidToken возвращается, когда токен не разбирается, подпись неверна или ключ неизвестен
+	ErrInvalidToken = errors.New("invalid token")
+
+	//ErrNoKeys возвращается, когда не задан ни один ключ подписи
+	ErrNoKeys = errors.New("no signing keys")
+)
+
+//Claims - содержимое токена доступа: стандартные поля (sub - id пользователя, exp, iat, jti),
+//тип пользователя и роли
+type Claims struct {
+	UserType string   `json:"user_type"`
+	Roles    []string `json:"roles,omitempty"`
+	gojwt.RegisteredClaims
+
+	UserID int64 `json:"-"`
+}
+
+//Signer выпускает и проверяет токены доступа, подписанные HS256.
+//Ключей может быть несколько: новые токены подписываются текущим, а проверяются любым известным
+//по заголовку kid. Для смены ключа новый добавляется и делается текущим, старый удаляется,
+//когда истекут подписанные им токены
+type Signer struct {
+	keys map[string][]byte
+	kid  string
+	ttl  time.Duration
+}
+
+//NewSigner создаёт Signer с ключами keys (kid -> секрет), текущим ключом kid и временем жизни токена ttl.
+func NewSigner(keys map[string][]byte, kid string, ttl time.Duration) (*Signer, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	for id, key := range keys {
+		if id == "" {
+			return nil, errors.New("jwt: empty key id")
+		}
+		if len(key) < MinKeySize {
+			return nil, fmt.Errorf("jwt: key %q is shorter than %d bytes", id, MinKeySize)
+		}
+	}
+	if _, ok := keys[kid]; !ok {
+		return nil, fmt.Errorf("jwt: unknown signing key %q", kid)
+	}
+	if ttl <= 0 {
+		return nil, fmt.Errorf("jwt: invalid token ttl %s", ttl)
+	}
+	return &Signer{keys: keys, kid: kid, ttl: ttl}, nil
+}
+
+//ParseKeys разбирает список ключей вида "kid1:base64,kid2:base64" и возвращает ключи и kid последнего из них.
+func ParseKeys(value string) (map[string][]byte, string, error) {
+	keys := make(map[string][]byte)
+	last := ""
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		i := strings.Index(item, ":")
+		if i <= 0 {
+			return nil, "", fmt.Errorf("jwt: key %q must be kid:base64", item)
+		}
+		kid := item[:i]
+		if _, ok := keys[kid]; ok {
+			return nil, "", fmt.Errorf("jwt: duplicate key %q", kid)
+		}
+		secret, err := base64.StdEncoding.DecodeString(item[i+1:])
+		if err != nil {
+			return nil, "", fmt.Errorf("jwt: key %q: %w", kid, err)
+		}
+		keys[kid] = secret
+		last = kid
+	}
+	if len(keys) == 0 {
+		return nil, "", ErrNoKeys
+	}
+	return keys, last, nil
+}
+
+//TTL возвращает время жизни токена доступа.
+func (s *Signer) TTL() time.Duration {
+	return s.ttl
+}
+
+//Issue выпускает токен доступа пользователю id типа userType (types.UserCustomer или types.UserManager)
+//и возвращает его вместе со временем истечения.
+func (s *Signer) Issue(userType string, id int64, roles []string) (string, time.Time, error) {
+	jti, err := utils.GenerateTokenStr()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	expire := now.Add(s.ttl)
+	claims := &Claims{
+		UserType: userType,
+		Roles:    roles,
+		RegisteredClaims: gojwt.RegisteredClaims{
+			Subject:   strconv.FormatInt(id, 10),
+			IssuedAt:  gojwt.NewNumericDate(now),
+			ExpiresAt: gojwt.NewNumericDate(expire),
+			ID:        jti[:32],
+		},
+	}
+
+	token := gojwt.NewWithClaims(gojwt.SigningMethodHS256, claims)
+	token.Header["kid"] = s.kid
+	signed, err := token.SignedString(s.keys[s.kid])
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expire, nil
+}
+
+//Parse проверяет подпись и срок токена и что он выпущен для пользователя типа userType.
+//Истёкший токен - types.ErrExpireToken, любой другой неверный - ErrInvalidToken
+func (s *Signer) Parse(token, userType string) (*Claims, error) {
+	claims := &Claims{}
+	parser := gojwt.NewParser(gojwt.WithValidMethods([]string{gojwt.SigningMethodHS256.Alg()}))
+	_, err := parser.ParseWithClaims(token, claims, func(token *gojwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := s.keys[kid]
+		if !ok {
+			return nil, ErrInvalidToken
+		}
+		return key, nil
+	})
+	if errors.Is(err, gojwt.ErrTokenExpired) {
+		return nil, types.ErrExpireToken
+	}
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	// без exp токен был бы бессрочным, поэтому срок обязателен
+	if !claims.VerifyExpiresAt(time.Now(), true) || claims.UserType != userType {
+		return nil, ErrInvalidToken
+	}
+	claims.UserID, err = strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil || claims.UserID <= 0 {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
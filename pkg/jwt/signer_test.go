@@ -0,0 +1,179 @@
+package jwt
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v4"
+
+	"github.com/KarrenAeris/crud/pkg/types"
+)
+
+var (
+	oldKey = []byte(strings.Repeat("o", MinKeySize))
+	newKey = []byte(strings.Repeat("n", MinKeySize))
+)
+
+func newSigner(t *testing.T, keys map[string][]byte, kid string) *Signer {
+	signer, err := NewSigner(keys, kid, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// sign подписывает claims методом method ключом key с заголовком kid
+func sign(t *testing.T, method gojwt.SigningMethod, key interface{}, kid string, claims gojwt.Claims) string {
+	token := gojwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func claims(userType string, expire time.Time) *Claims {
+	return &Claims{
+		UserType: userType,
+		RegisteredClaims: gojwt.RegisteredClaims{
+			Subject:   "7",
+			IssuedAt:  gojwt.NewNumericDate(time.Now()),
+			ExpiresAt: gojwt.NewNumericDate(expire),
+		},
+	}
+}
+
+func TestIssueAndParse(t *testing.T) {
+	signer := newSigner(t, map[string][]byte{"new": newKey}, "new")
+
+	token, expire, err := signer.Issue(types.UserManager, 7, []string{types.RoleManager, types.RoleAdmin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(expire); d <= 0 || d > time.Minute {
+		t.Fatalf("expire in %s", d)
+	}
+
+	parsed, err := signer.Parse(token, types.UserManager)
+	if err != nil || parsed.UserID != 7 || strings.Join(parsed.Roles, ",") != "MANAGER,ADMIN" || parsed.ID == "" {
+		t.Fatalf("Parse = %+v, %v", parsed, err)
+	}
+	// токен продавца не подходит покупателю
+	if _, err = signer.Parse(token, types.UserCustomer); err != ErrInvalidToken {
+		t.Fatalf("other user type: %v", err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	before := newSigner(t, map[string][]byte{"old": oldKey}, "old")
+	token, _, err := before.Issue(types.UserCustomer, 7, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// новый ключ стал текущим, старые токены ещё принимаются
+	during := newSigner(t, map[string][]byte{"old": oldKey, "new": newKey}, "new")
+	if _, err = during.Parse(token, types.UserCustomer); err != nil {
+		t.Fatalf("token of old key during rotation: %v", err)
+	}
+	fresh, _, err := during.Issue(types.UserCustomer, 7, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, _, _ := gojwt.NewParser().ParseUnverified(fresh, &Claims{})
+	if header.Header["kid"] != "new" {
+		t.Fatalf("signed with kid %v", header.Header["kid"])
+	}
+
+	// старый ключ удалён - его токены и токены с подменённым kid отклоняются
+	after := newSigner(t, map[string][]byte{"new": newKey}, "new")
+	if _, err = after.Parse(token, types.UserCustomer); err != ErrInvalidToken {
+		t.Fatalf("token of removed key: %v", err)
+	}
+	if _, err = after.Parse(fresh, types.UserCustomer); err != nil {
+		t.Fatalf("token of new key: %v", err)
+	}
+	forged := sign(t, gojwt.SigningMethodHS256, oldKey, "new", claims(types.UserCustomer, time.Now().Add(time.Minute)))
+	if _, err = after.Parse(forged, types.UserCustomer); err != ErrInvalidToken {
+		t.Fatalf("token signed by other key: %v", err)
+	}
+	unknown := sign(t, gojwt.SigningMethodHS256, newKey, "missing", claims(types.UserCustomer, time.Now().Add(time.Minute)))
+	if _, err = after.Parse(unknown, types.UserCustomer); err != ErrInvalidToken {
+		t.Fatalf("unknown kid: %v", err)
+	}
+}
+
+func TestAlgorithmConfusion(t *testing.T) {
+	signer := newSigner(t, map[string][]byte{"new": newKey}, "new")
+	valid := claims(types.UserCustomer, time.Now().Add(time.Minute))
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"none", sign(t, gojwt.SigningMethodNone, gojwt.UnsafeAllowNoneSignatureType, "new", valid)},
+		{"HS384", sign(t, gojwt.SigningMethodHS384, newKey, "new", valid)},
+		{"HS512", sign(t, gojwt.SigningMethodHS512, newKey, "new", valid)},
+	}
+	for _, test := range tests {
+		if _, err := signer.Parse(test.token, types.UserCustomer); err != ErrInvalidToken {
+			t.Errorf("%s: err = %v, want %v", test.name, err, ErrInvalidToken)
+		}
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	signer := newSigner(t, map[string][]byte{"new": newKey}, "new")
+
+	expired := sign(t, gojwt.SigningMethodHS256, newKey, "new", claims(types.UserCustomer, time.Now().Add(-time.Second)))
+	if _, err := signer.Parse(expired, types.UserCustomer); err != types.ErrExpireToken {
+		t.Fatalf("expired: err = %v", err)
+	}
+
+	// токен без exp был бы бессрочным
+	endless := claims(types.UserCustomer, time.Time{})
+	endless.ExpiresAt = nil
+	if _, err := signer.Parse(sign(t, gojwt.SigningMethodHS256, newKey, "new", endless), types.UserCustomer); err != ErrInvalidToken {
+		t.Fatalf("without exp: err = %v", err)
+	}
+
+	noSubject := claims(types.UserCustomer, time.Now().Add(time.Minute))
+	noSubject.Subject = ""
+	if _, err := signer.Parse(sign(t, gojwt.SigningMethodHS256, newKey, "new", noSubject), types.UserCustomer); err != ErrInvalidToken {
+		t.Fatalf("without sub: err = %v", err)
+	}
+}
+
+func TestNewSignerAndParseKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		keys map[string][]byte
+		kid  string
+		ttl  time.Duration
+	}{
+		{"no keys", nil, "new", time.Minute},
+		{"short key", map[string][]byte{"new": newKey[:MinKeySize-1]}, "new", time.Minute},
+		{"empty kid", map[string][]byte{"": newKey}, "", time.Minute},
+		{"unknown kid", map[string][]byte{"new": newKey}, "old", time.Minute},
+		{"zero ttl", map[string][]byte{"new": newKey}, "new", 0},
+	}
+	for _, test := range tests {
+		if _, err := NewSigner(test.keys, test.kid, test.ttl); err == nil {
+			t.Errorf("%s: NewSigner succeeded", test.name)
+		}
+	}
+
+	encode := base64.StdEncoding.EncodeToString
+	keys, kid, err := ParseKeys(" old:" + encode(oldKey) + ", new:" + encode(newKey) + ",")
+	if err != nil || kid != "new" || string(keys["old"]) != string(oldKey) || string(keys["new"]) != string(newKey) {
+		t.Fatalf("ParseKeys = %v, %q, %v", keys, kid, err)
+	}
+	for _, value := range []string{"", "nokid", ":" + encode(newKey), "a:!!", "a:" + encode(newKey) + ",a:" + encode(oldKey)} {
+		if _, _, err = ParseKeys(value); err == nil {
+			t.Errorf("ParseKeys(%q) succeeded", value)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/KarrenAeris/crud/pkg/types"
+)
+
+//MemoryStore хранит счётчики в памяти процесса: подходит, когда сервис запущен в одном экземпляре
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*Entry
+}
+
+//NewMemoryStore создаёт пустое хранилище.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*Entry)}
+}
+
+//Entry ...
+func (s *MemoryStore) Entry(ctx context.Context, key string) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, types.ErrNotFound
+	}
+	result := *entry
+	return &result, nil
+}
+
+//Claim ...
+func (s *MemoryStore) Claim(ctx context.Context, key string, now time.Time, policy Policy) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, lockErr := policy.claim(s.entries[key], now)
+	if lockErr != nil {
+		return nil, lockErr
+	}
+	s.entries[key] = entry
+
+	result := *entry
+	return &result, nil
+}
+
+//Release ...
+func (s *MemoryStore) Release(ctx context.Context, key string, policy Policy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	entry = policy.release(entry)
+	if entry.Failures == 0 {
+		delete(s.entries, key)
+		return nil
+	}
+	s.entries[key] = entry
+	return nil
+}
+
+//Reset ...
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+//Sweep ...
+func (s *MemoryStore) Sweep(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for key, entry := range s.entries {
+		if entry.LastFailure.Before(before) && entry.LockedUntil.Before(before) {
+			delete(s.entries, key)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,136 @@
+package lockout
+
+import (
+	"context"
+	"time"
+
+	"github.com/KarrenAeris/crud/pkg/logger"
+	"github.com/KarrenAeris/crud/pkg/types"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+//PostgresStore хранит счётчики в таблице login_failures, общей для всех экземпляров сервиса
+type PostgresStore struct {
+	pool *pgxpool.Pool
+}
+
+//NewPostgresStore создаёт хранилище.
+func NewPostgresStore(pool *pgxpool.Pool) *PostgresStore {
+	return &PostgresStore{pool: pool}
+}
+
+//Entry ...
+func (s *PostgresStore) Entry(ctx context.Context, key string) (*Entry, error) {
+	sqlstmt := `select failures, last_failure, locked_until from login_failures where key = $1`
+	return entryRow(ctx, s.pool, sqlstmt, key)
+}
+
+//Claim ...
+func (s *PostgresStore) Claim(ctx context.Context, key string, now time.Time, policy Policy) (*Entry, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	// строка ключа блокируется до конца транзакции, чтобы параллельные попытки с разных реплик
+	// проверялись по очереди и каждая видела уже засчитанные
+	sqlstmt := `insert into login_failures(key, failures, last_failure) values ($1, 0, $2) on conflict do nothing`
+	if _, err = tx.Exec(ctx, sqlstmt, key, now); err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+
+	sqlstmt = `select failures, last_failure, locked_until from login_failures where key = $1 for update`
+	entry, err := entryRow(ctx, tx, sqlstmt, key)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, lockErr := policy.claim(entry, now)
+	if lockErr != nil {
+		return nil, lockErr
+	}
+
+	sqlstmt = `update login_failures set failures = $2, last_failure = $3, locked_until = $4 where key = $1`
+	if _, err = tx.Exec(ctx, sqlstmt, key, entry.Failures, entry.LastFailure, nullTime(entry.LockedUntil)); err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	return entry, nil
+}
+
+//Release ...
+func (s *PostgresStore) Release(ctx context.Context, key string, policy Policy) error {
+	sqlstmt := `
+	update login_failures set
+		failures = failures - 1,
+		locked_until = case when failures - 1 < $2 then null else locked_until end
+	where key = $1 and failures > 0`
+
+	if _, err := s.pool.Exec(ctx, sqlstmt, key, policy.MaxFailures); err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	return nil
+}
+
+//Reset ...
+func (s *PostgresStore) Reset(ctx context.Context, key string) error {
+	if _, err := s.pool.Exec(ctx, `delete from login_failures where key = $1`, key); err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	return nil
+}
+
+//Sweep ...
+func (s *PostgresStore) Sweep(ctx context.Context, before time.Time) (int64, error) {
+	sqlstmt := `delete from login_failures where last_failure < $1 and (locked_until is null or locked_until < $1)`
+	tag, err := s.pool.Exec(ctx, sqlstmt, before)
+	if err != nil {
+		logger.Error(ctx, err)
+		return 0, types.ErrInternal
+	}
+	return tag.RowsAffected(), nil
+}
+
+// queryRower - пул соединений или транзакция
+type queryRower interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// entryRow выполняет запрос, возвращающий один счётчик
+func entryRow(ctx context.Context, q queryRower, sqlstmt string, args ...interface{}) (*Entry, error) {
+	entry := &Entry{}
+	var lockedUntil *time.Time
+
+	err := q.QueryRow(ctx, sqlstmt, args...).Scan(&entry.Failures, &entry.LastFailure, &lockedUntil)
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	if lockedUntil != nil {
+		entry.LockedUntil = *lockedUntil
+	}
+	return entry, nil
+}
+
+// nullTime возвращает nil для нулевого времени
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
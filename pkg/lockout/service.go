@@ -0,0 +1,268 @@
+package lockout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/KarrenAeris/crud/pkg/logger"
+	"github.com/KarrenAeris/crud/pkg/sessions"
+	"github.com/KarrenAeris/crud/pkg/types"
+)
+
+//Policy описывает, как ограничиваются неудачные попытки входа по одному ключу (телефону или IP).
+type Policy struct {
+	MaxFailures int           // после стольких ошибок ключ блокируется на Lockout
+	Window      time.Duration // ошибка старше окна сбрасывает счётчик
+	BaseDelay   time.Duration // пауза после первой ошибки, после каждой следующей удваивается; 0 - без пауз
+	MaxDelay    time.Duration // наибольшая пауза
+	Lockout     time.Duration // на сколько блокируется ключ
+}
+
+var (
+	//PhonePolicy - ограничения по телефону: паузы 1с, 2с, 4с ... и блокировка после 5 ошибок
+	PhonePolicy = Policy{MaxFailures: 5, Window: 15 * time.Minute, BaseDelay: time.Second, MaxDelay: 30 * time.Second, Lockout: 15 * time.Minute}
+
+	//IPPolicy - ограничения по адресу клиента: без пауз, блокировка после 100 ошибок с любыми телефонами
+	IPPolicy = Policy{MaxFailures: 100, Window: 15 * time.Minute, Lockout: 15 * time.Minute}
+)
+
+//Entry представляет счётчик неудачных попыток по ключу.
+type Entry struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time // нулевое время - ключ не блокировался
+}
+
+//Store хранит счётчики неудачных попыток. Реализации: в Postgres (общий для всех реплик) и в памяти (для одного узла)
+type Store interface {
+	//Entry возвращает счётчик ключа, types.ErrNotFound - ошибок не было
+	Entry(ctx context.Context, key string) (*Entry, error)
+	//Claim атомарно проверяет счётчик по правилам policy и засчитывает попытку в момент now как ошибку.
+	//Если входить пока нельзя, счётчик не меняется и возвращается *Error
+	Claim(ctx context.Context, key string, now time.Time, policy Policy) (*Entry, error)
+	//Release снимает засчитанную через Claim попытку, если она оказалась удачной
+	Release(ctx context.Context, key string, policy Policy) error
+	//Reset удаляет счётчик ключа
+	Reset(ctx context.Context, key string) error
+	//Sweep удаляет счётчики, у которых и последняя ошибка, и блокировка раньше before
+	Sweep(ctx context.Context, before time.Time) (int64, error)
+}
+
+//Error возвращается, когда попытки входа временно запрещены. errors.Is(err, types.ErrTooManyAttempts) - true
+type Error struct {
+	Locked     bool          // ключ заблокирован, иначе - не прошла пауза после ошибки
+	RetryAfter time.Duration // через сколько можно повторить
+}
+
+func (e *Error) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("login locked, retry after %s", e.RetryAfter)
+	}
+	return fmt.Sprintf("too many login attempts, retry after %s", e.RetryAfter)
+}
+
+//Unwrap ...
+func (e *Error) Unwrap() error {
+	return types.ErrTooManyAttempts
+}
+
+//RetryAfterSeconds возвращает RetryAfter в целых секундах с округлением вверх - для заголовка Retry-After
+func (e *Error) RetryAfterSeconds() int {
+	return int(math.Ceil(e.RetryAfter.Seconds()))
+}
+
+//Service описывает сервис защиты входа от перебора паролей.
+//Ошибки считаются по телефону пользователя (отдельно для покупателей и продавцов) и по IP клиента из sessions.DeviceFrom
+type Service struct {
+	store Store
+	phone Policy
+	ip    Policy
+}
+
+//NewService создаёт сервис.
+func NewService(st Store, phone, ip Policy) *Service {
+	return &Service{store: st, phone: phone, ip: ip}
+}
+
+//Attempt проверяет, можно ли сейчас войти по телефону phone (пустой - только по IP), и сразу засчитывает
+//попытку как ошибку: параллельные запросы не проходят проверку раньше, чем засчитана ошибка предыдущего.
+//Если нельзя, возвращает *Error. Удачную попытку (и попытку, прерванную сбоем) снимает Release;
+//сбой хранилища не мешает входу
+func (s *Service) Attempt(ctx context.Context, userType, phone string) error {
+	now := time.Now().UTC()
+
+	limits := s.limits(ctx, userType, phone)
+	for i, limit := range limits {
+		entry, err := s.store.Claim(ctx, limit.key, now, limit.policy)
+		var lockErr *Error
+		if errors.As(err, &lockErr) {
+			// по предыдущим ключам попытка уже засчитана, а входа не было
+			s.release(ctx, limits[:i])
+			logger.Warn(ctx, "login rejected", "key", limit.key, "retry_after", lockErr.RetryAfter.String())
+			return lockErr
+		}
+		if err != nil {
+			continue
+		}
+		if entry.Failures == limit.policy.MaxFailures {
+			logger.Warn(ctx, "login locked", "key", limit.key, "until", entry.LockedUntil)
+		}
+	}
+	return nil
+}
+
+//Release снимает попытку, засчитанную Attempt, когда пароль или код оказались верными
+func (s *Service) Release(ctx context.Context, userType, phone string) {
+	s.release(ctx, s.limits(ctx, userType, phone))
+}
+
+//Succeed сбрасывает счётчик телефона после успешного входа. Счётчик IP не сбрасывается,
+//иначе перебор чужих паролей можно перемежать входом в свой аккаунт
+func (s *Service) Succeed(ctx context.Context, userType, phone string) {
+	_ = s.store.Reset(ctx, phoneKey(userType, phone))
+}
+
+//UnlockPhone снимает блокировку и паузы входа по телефону
+func (s *Service) UnlockPhone(ctx context.Context, userType, phone string) error {
+	return s.store.Reset(ctx, phoneKey(userType, phone))
+}
+
+//UnlockIP снимает блокировку и паузы входа с адреса ip
+func (s *Service) UnlockIP(ctx context.Context, ip string) error {
+	return s.store.Reset(ctx, ipKey(ip))
+}
+
+//Sweep удаляет счётчики, которые больше ни на что не влияют
+func (s *Service) Sweep(ctx context.Context) (int64, error) {
+	keep := s.phone.Window
+	for _, d := range []time.Duration{s.phone.Lockout, s.ip.Window, s.ip.Lockout} {
+		if d > keep {
+			keep = d
+		}
+	}
+	return s.store.Sweep(ctx, time.Now().UTC().Add(-keep))
+}
+
+//RunSweeper периодически удаляет устаревшие счётчики, пока не отменён ctx
+func (s *Service) RunSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.Sweep(ctx)
+			if err != nil {
+				continue
+			}
+			if n > 0 {
+				logger.Info(ctx, "removed stale login failures", "count", n)
+			}
+		}
+	}
+}
+
+// release снимает попытки по ключам limits
+func (s *Service) release(ctx context.Context, limits []limit) {
+	for _, limit := range limits {
+		_ = s.store.Release(ctx, limit.key, limit.policy)
+	}
+}
+
+type limit struct {
+	key    string
+	policy Policy
+}
+
+// limits возвращает ключи, по которым считаются ошибки входа
+func (s *Service) limits(ctx context.Context, userType, phone string) []limit {
+	limits := make([]limit, 0, 2)
+	if phone != "" {
+		limits = append(limits, limit{phoneKey(userType, phone), s.phone})
+	}
+	// адрес берётся из устройства запроса: его middleware.Device кладёт в контекст раньше любой
+	// аутентификации, в том числе Basic, которая проверяет пароль до middleware.Actor
+	if ip := sessions.DeviceFrom(ctx).IP; ip != "" {
+		limits = append(limits, limit{ipKey(ip), s.ip})
+	}
+	return limits
+}
+
+// check возвращает *Error, если по счётчику entry входить пока нельзя
+func check(entry *Entry, policy Policy, now time.Time) *Error {
+	if now.Before(entry.LockedUntil) {
+		return &Error{Locked: true, RetryAfter: entry.LockedUntil.Sub(now)}
+	}
+	if now.Sub(entry.LastFailure) > policy.Window {
+		return nil
+	}
+	if retry := entry.LastFailure.Add(policy.delay(entry.Failures)).Sub(now); retry > 0 {
+		return &Error{RetryAfter: retry}
+	}
+	return nil
+}
+
+// delay возвращает паузу после failures ошибок подряд
+func (p Policy) delay(failures int) time.Duration {
+	if failures <= 0 || p.BaseDelay <= 0 {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// claim возвращает счётчик после ещё одной попытки в момент now (entry nil - ошибок не было)
+// или *Error, если входить пока нельзя
+func (p Policy) claim(entry *Entry, now time.Time) (*Entry, *Error) {
+	result := &Entry{Failures: p.failures(entry, now), LastFailure: now}
+	if entry != nil {
+		if lockErr := check(entry, p, now); lockErr != nil {
+			return nil, lockErr
+		}
+		result.LockedUntil = entry.LockedUntil
+	}
+	if result.Failures >= p.MaxFailures {
+		result.LockedUntil = now.Add(p.Lockout)
+	}
+	return result, nil
+}
+
+// release возвращает счётчик после снятия одной попытки. Блокировку до порога ставила сама
+// снятая попытка, поэтому она тоже снимается
+func (p Policy) release(entry *Entry) *Entry {
+	result := *entry
+	if result.Failures > 0 {
+		result.Failures--
+	}
+	if result.Failures < p.MaxFailures {
+		result.LockedUntil = time.Time{}
+	}
+	return &result
+}
+
+// failures возвращает число ошибок после новой ошибки в момент now
+func (p Policy) failures(entry *Entry, now time.Time) int {
+	if entry == nil || now.Sub(entry.LastFailure) > p.Window {
+		return 1
+	}
+	return entry.Failures + 1
+}
+
+func phoneKey(userType, phone string) string {
+	return userType + ":" + phone
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
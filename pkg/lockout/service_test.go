@@ -0,0 +1,61 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicyDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   Policy
+		failures int
+		want     time.Duration
+	}{
+		{"no failures", PhonePolicy, 0, 0},
+		{"first", PhonePolicy, 1, time.Second},
+		{"doubles", PhonePolicy, 2, 2 * time.Second},
+		{"doubles again", PhonePolicy, 4, 8 * time.Second},
+		{"capped", PhonePolicy, 6, 30 * time.Second},
+		{"capped without overflow", PhonePolicy, 1000, 30 * time.Second},
+		{"without pauses", IPPolicy, 50, 0},
+		{"cap below base", Policy{BaseDelay: time.Minute, MaxDelay: time.Second}, 1, time.Second},
+	}
+	for _, test := range tests {
+		if got := test.policy.delay(test.failures); got != test.want {
+			t.Errorf("%s: delay(%d) = %s, want %s", test.name, test.failures, got, test.want)
+		}
+	}
+}
+
+func TestPolicyClaimRelease(t *testing.T) {
+	policy := Policy{MaxFailures: 3, Window: time.Minute, Lockout: time.Hour}
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var entry *Entry
+	for i := 1; i <= policy.MaxFailures; i++ {
+		next, lockErr := policy.claim(entry, now)
+		if lockErr != nil || next.Failures != i {
+			t.Fatalf("claim %d: %+v, %v", i, next, lockErr)
+		}
+		entry = next
+	}
+	if !entry.LockedUntil.Equal(now.Add(policy.Lockout)) {
+		t.Fatalf("not locked after %d failures: %+v", policy.MaxFailures, entry)
+	}
+	if _, lockErr := policy.claim(entry, now.Add(time.Second)); lockErr == nil || !lockErr.Locked {
+		t.Fatalf("claim while locked: %v", lockErr)
+	}
+
+	// снятие попытки, которая поставила блокировку, снимает и блокировку
+	entry = policy.release(entry)
+	if entry.Failures != policy.MaxFailures-1 || !entry.LockedUntil.IsZero() {
+		t.Fatalf("release: %+v", entry)
+	}
+
+	// после окна счётчик начинается заново
+	next, lockErr := policy.claim(entry, now.Add(2*policy.Window))
+	if lockErr != nil || next.Failures != 1 {
+		t.Fatalf("claim after window: %+v, %v", next, lockErr)
+	}
+}
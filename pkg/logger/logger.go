@@ -0,0 +1,128 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Уровни логирования
+const (
+	LevelDebug = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+var (
+	mu     sync.Mutex
+	output io.Writer = os.Stderr
+	level            = LevelInfo
+)
+
+var requestIDContextKey = &contextKey{"request id"}
+
+type contextKey struct {
+	name string
+}
+
+func (c *contextKey) String() string {
+	return c.name
+}
+
+//SetOutput задаёт, куда пишутся записи
+func SetOutput(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+	output = w
+}
+
+//SetLevel задаёт минимальный уровень записей по имени: debug, info, warn, error
+func SetLevel(name string) error {
+	for i, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			mu.Lock()
+			defer mu.Unlock()
+			level = i
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown log level %q", name)
+}
+
+//WithRequestID кладёт id запроса в контекст
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey, id)
+}
+
+//RequestID возвращает id запроса из контекста
+func RequestID(ctx context.Context) string {
+	if id, ok := ctx.Value(requestIDContextKey).(string); ok {
+		return id
+	}
+	return ""
+}
+
+//Debug пишет отладочную запись, kv - пары ключ, значение
+func Debug(ctx context.Context, msg string, kv ...interface{}) {
+	write(ctx, LevelDebug, msg, kv)
+}
+
+//Info пишет информационную запись
+func Info(ctx context.Context, msg string, kv ...interface{}) {
+	write(ctx, LevelInfo, msg, kv)
+}
+
+//Warn пишет предупреждение
+func Warn(ctx context.Context, msg string, kv ...interface{}) {
+	write(ctx, LevelWarn, msg, kv)
+}
+
+//Error пишет запись об ошибке
+func Error(ctx context.Context, err error, kv ...interface{}) {
+	msg := "<nil>"
+	if err != nil {
+		msg = err.Error()
+	}
+	write(ctx, LevelError, msg, kv)
+}
+
+func write(ctx context.Context, lvl int, msg string, kv []interface{}) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if lvl < level {
+		return
+	}
+
+	entry := make(map[string]interface{}, len(kv)/2+4)
+	for i := 0; i+1 < len(kv); i += 2 {
+		key := fmt.Sprint(kv[i])
+		if err, ok := kv[i+1].(error); ok {
+			entry[key] = err.Error()
+			continue
+		}
+		entry[key] = kv[i+1]
+	}
+	entry["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	entry["level"] = levelNames[lvl]
+	entry["msg"] = msg
+	if ctx != nil {
+		if id := RequestID(ctx); id != "" {
+			entry["request_id"] = id
+		}
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		data = []byte(fmt.Sprintf(`{"level":"error","msg":%q}`, err.Error()))
+	}
+	_, _ = output.Write(append(data, '\n'))
+}
@@ -2,182 +2,288 @@ package managers
 
 import (
 	"context"
-	"log"
-	"strconv"
+	"errors"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/KarrenAeris/crud/pkg/audit"
+	"github.com/KarrenAeris/crud/pkg/jwt"
+	"github.com/KarrenAeris/crud/pkg/lockout"
+	"github.com/KarrenAeris/crud/pkg/logger"
+	"github.com/KarrenAeris/crud/pkg/metrics"
+	"github.com/KarrenAeris/crud/pkg/sessions"
+	"github.com/KarrenAeris/crud/pkg/store"
+	"github.com/KarrenAeris/crud/pkg/tracing"
 	"github.com/KarrenAeris/crud/pkg/types"
 	"github.com/KarrenAeris/crud/pkg/utils"
-
-	"github.com/jackc/pgx/v4"
-	"github.com/jackc/pgx/v4/pgxpool"
 )
 
 //Service ...
 type Service struct {
-	pool *pgxpool.Pool
+	store      store.Store
+	auditSvc   *audit.Service
+	lockoutSvc *lockout.Service
+	signer     *jwt.Signer
 }
 
-//NewService ...
-func NewService(pool *pgxpool.Pool) *Service {
-	return &Service{pool: pool}
+//NewService ... signer - подпись токенов доступа, nil - токены доступа хранятся в БД
+func NewService(st store.Store, auditSvc *audit.Service, lockoutSvc *lockout.Service, signer *jwt.Signer) *Service {
+	return &Service{store: st, auditSvc: auditSvc, lockoutSvc: lockoutSvc, signer: signer}
 }
 
-//IDByToken ...
+//IDByToken ... с подписанными токенами принимается только токен доступа, токен из БД - нет.
+//Использование токена из БД отмечается в его сессии
 func (s *Service) IDByToken(ctx context.Context, token string) (int64, error) {
-	var id int64
-	sqlStatement := `select manager_id from managers_tokens where token = $1`
-
-	err := s.pool.QueryRow(ctx, sqlStatement, token).Scan(&id)
-
-	if err != nil {
-		log.Print(err)
-		if err == pgx.ErrNoRows {
+	if s.signer != nil {
+		claims, err := s.signer.Parse(token, types.UserManager)
+		if err != nil {
 			return 0, nil
 		}
+		return claims.UserID, nil
+	}
+
+	hash := utils.HashToken(token)
+	id, err := s.store.ManagerIDByToken(ctx, hash)
+	if err != nil {
 		return 0, nil
 	}
+	sessions.Touch(ctx, s.store, types.UserManager, hash)
 
 	return id, nil
 }
 
-//IsAdmin ...
+//IsAdmin ... если админам требуется второй фактор, админ без него прав админа не получает
 func (s *Service) IsAdmin(ctx context.Context, id int64) (isAdmin bool) {
-	sqlStmt := `select is_admin from managers  where id = $1`
-	err := s.pool.QueryRow(ctx, sqlStmt, id).Scan(&isAdmin)
+	isAdmin, err := s.store.IsAdmin(ctx, id)
+	if err != nil || !isAdmin {
+		return false
+	}
+
+	required, err := s.store.RequireAdminTOTP(ctx)
 	if err != nil {
 		return false
 	}
+	if required {
+		return s.totpEnabled(ctx, id)
+	}
 	return
 }
 
-//Create ...
-func (s *Service) Create(ctx context.Context, item *types.Manager) (string, error) {
-	var token string
-	var id int64
+//Create ... телефон сохраняется в формате E.164, неверный номер - types.ErrInvalidPhone
+func (s *Service) Create(ctx context.Context, item *types.Manager) (*types.AuthTokens, error) {
+
+	phone, err := utils.NormalizePhone(item.Phone)
+	if err != nil {
+		return nil, err
+	}
+	item.Phone = phone
+
+	id, err := s.store.CreateManager(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := utils.GenerateTokenStr()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.store.SaveManagerToken(ctx, utils.HashToken(token), id, sessions.DeviceFrom(ctx)); err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.tokens(id, item.IsAdmin, token)
+	if err != nil {
+		return nil, err
+	}
+
+	item.ID = id
+	s.auditSvc.Record(ctx, "create", "manager", id, nil, item)
+
+	return tokens, nil
+}
+
+//Token ... после частых ошибок входа по телефону или с одного адреса возвращает *lockout.Error.
+//Если подключён второй фактор, возвращает только Challenge, токены выдаёт VerifyChallenge
+func (s *Service) Token(ctx context.Context, phone, password string) (*types.AuthTokens, error) {
+	id, phone, err := s.checkPassword(ctx, phone, password)
+	if err != nil {
+		if err == types.ErrInvalidPassword || errors.Is(err, types.ErrTooManyAttempts) {
+			metrics.Login(metrics.UserManager, false)
+		}
+		return nil, err
+	}
+
+	if s.totpEnabled(ctx, id) {
+		challenge, err := s.newChallenge(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return &types.AuthTokens{Challenge: challenge}, nil
+	}
+
+	return s.login(ctx, id, phone)
+}
 
-	sqlStmt := `insert into managers(name,phone,is_admin) values ($1,$2,$3) on conflict (phone) do nothing returning id;`
-	err := s.pool.QueryRow(ctx, sqlStmt, item.Name, item.Phone, item.IsAdmin).Scan(&id)
+// login выдаёт токены после успешного входа и сбрасывает ошибки входа по телефону
+func (s *Service) login(ctx context.Context, id int64, phone string) (*types.AuthTokens, error) {
+	token, err := utils.GenerateTokenStr()
 	if err != nil {
-		log.Print(err)
-		return "", types.ErrInternal
+		logger.Error(ctx, err)
+		return nil, err
 	}
 
-	token, err = utils.GenerateTokenStr()
+	if err = s.store.SaveManagerToken(ctx, utils.HashToken(token), id, sessions.DeviceFrom(ctx)); err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.tokens(id, s.IsAdmin(ctx, id), token)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	_, err = s.pool.Exec(ctx, `insert into managers_tokens(token,manager_id) values($1,$2)`, token, id)
+	s.lockoutSvc.Succeed(ctx, types.UserManager, phone)
+	metrics.Login(metrics.UserManager, true)
+	return tokens, nil
+}
+
+//IDByPassword возвращает id продавца по телефону и паролю (HTTP Basic). Пароль проверяется bcrypt на каждый запрос,
+//ошибки считаются в ограничениях входа так же, как у Token. Неверный телефон или пароль - types.ErrInvalidPassword,
+//подключён второй фактор - types.ErrTwoFactorRequired (одного пароля мало, нужен вход через Token)
+func (s *Service) IDByPassword(ctx context.Context, phone, password string) (int64, error) {
+	id, phone, err := s.checkPassword(ctx, phone, password)
 	if err != nil {
-		return "", types.ErrInternal
+		return 0, err
+	}
+	if s.totpEnabled(ctx, id) {
+		return 0, types.ErrTwoFactorRequired
 	}
 
-	return token, nil
+	s.lockoutSvc.Succeed(ctx, types.UserManager, phone)
+	return id, nil
 }
 
-//Token ...
-func (s *Service) Token(ctx context.Context, phone, password string) (token string, err error) {
-	var hash string
-	var id int64
-	err = s.pool.QueryRow(ctx, `select id,password from managers where phone = $1`, phone).Scan(&id, &hash)
-	log.Println(err)
-	if err == pgx.ErrNoRows {
-		return "", types.ErrInvalidPassword
+// checkPassword проверяет пароль продавца и возвращает его id и телефон в формате E.164.
+// Попытка засчитывается в ограничения входа до проверки пароля и снимается, если пароль верный.
+// После частых ошибок возвращает *lockout.Error
+func (s *Service) checkPassword(ctx context.Context, phone, password string) (int64, string, error) {
+	// неверный номер пустой, по нему ограничивается только адрес клиента
+	phone, err := utils.NormalizePhone(phone)
+	if lockErr := s.lockoutSvc.Attempt(ctx, types.UserManager, phone); lockErr != nil {
+		return 0, "", lockErr
 	}
 	if err != nil {
-		return "", types.ErrInternal
+		return 0, "", types.ErrInvalidPassword
 	}
 
+	id, hash, err := s.store.ManagerCredentials(ctx, phone)
+	if err == types.ErrNotFound {
+		return 0, "", types.ErrInvalidPassword
+	}
+	if err != nil {
+		s.lockoutSvc.Release(ctx, types.UserManager, phone)
+		return 0, "", err
+	}
+
+	_, span := tracing.Start(ctx, "bcrypt.CompareHashAndPassword")
 	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	log.Println(err)
+	span.End()
 	if err != nil {
-		return "", types.ErrInvalidPassword
+		logger.Warn(ctx, "invalid manager password", "manager_id", id)
+		return 0, "", types.ErrInvalidPassword
 	}
 
-	token, err = utils.GenerateTokenStr()
-	log.Println(err)
+	s.lockoutSvc.Release(ctx, types.UserManager, phone)
+	return id, phone, nil
+}
+
+//Refresh выдаёт новый токен доступа по токену из БД. Отозванный, истёкший или неизвестный токен - types.ErrTokenNotFound.
+//Токен из БД каждый раз заменяется новым в той же сессии, старый перестаёт действовать.
+//Без подписанных токенов токен из БД и есть токен доступа
+func (s *Service) Refresh(ctx context.Context, refreshToken string) (*types.AuthTokens, error) {
+	token, err := utils.GenerateTokenStr()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	_, err = s.pool.Exec(ctx, `insert into managers_tokens(token,manager_id) values($1,$2)`, token, id)
-	log.Println(err)
+	hash := utils.HashToken(token)
+	id, err := s.store.RotateSession(ctx, types.UserManager, utils.HashToken(refreshToken), hash)
+	if err == types.ErrNotFound {
+		return nil, types.ErrTokenNotFound
+	}
 	if err != nil {
-		return "", types.ErrInternal
+		return nil, err
+	}
+	sessions.Touch(ctx, s.store, types.UserManager, hash)
+
+	return s.tokens(id, s.IsAdmin(ctx, id), token)
+}
+
+// tokens собирает ответ на вход по токену из БД
+func (s *Service) tokens(id int64, isAdmin bool, token string) (*types.AuthTokens, error) {
+	if s.signer == nil {
+		return &types.AuthTokens{Token: token}, nil
 	}
 
-	return token, nil
+	roles := []string{types.RoleManager}
+	if isAdmin {
+		roles = append(roles, types.RoleAdmin)
+	}
+	access, _, err := s.signer.Issue(types.UserManager, id, roles)
+	if err != nil {
+		return nil, err
+	}
+	return &types.AuthTokens{Token: access, RefreshToken: token, ExpiresIn: int64(s.signer.TTL() / time.Second)}, nil
 }
 
 //SaveProduct ...
 func (s *Service) SaveProduct(ctx context.Context, product *types.Product) (*types.Product, error) {
 
 	var err error
+	var before *types.Product
 
-	if product.ID == 0 {
-		sqlstmt := `insert into products(name,qty,price) values ($1,$2,$3) returning id,name,qty,price,active,created;`
-		err = s.pool.QueryRow(ctx, sqlstmt, product.Name, product.Qty, product.Price).
-			Scan(&product.ID, &product.Name, &product.Qty, &product.Price, &product.Active, &product.Created)
-	} else {
-		sqlstmt := `update  products set  name=$1, qty=$2,price=$3  where id = $4 returning id,name,qty,price,active,created;`
-		err = s.pool.QueryRow(ctx, sqlstmt, product.Name, product.Qty, product.Price, product.ID).
-			Scan(&product.ID, &product.Name, &product.Qty, &product.Price, &product.Active, &product.Created)
+	if product.ID != 0 {
+		before, err = s.ProductByID(ctx, product.ID)
+		if err != nil {
+			return nil, err
+		}
 	}
 
+	product, err = s.store.SaveProduct(ctx, product)
 	if err != nil {
-		log.Print(err)
-		return nil, types.ErrInternal
+		return nil, err
+	}
+
+	action := "update"
+	if before == nil {
+		action = "create"
 	}
+	s.auditSvc.Record(ctx, action, "product", product.ID, before, product)
+
 	return product, nil
 }
 
-//MakeSalePosition ...
-func (s *Service) MakeSalePosition(ctx context.Context, position *types.SalePosition) bool {
-	active := false
-	qty := 0
-	if err := s.pool.QueryRow(ctx, `select qty,active from products where id = $1`, position.ProductID).
-		Scan(&qty, &active); err != nil {
-		return false
-	}
-	if qty < position.Qty || !active {
-		return false
-	}
-	if _, err := s.pool.Exec(ctx, `update products set qty = $1 where id = $2`, qty-position.Qty, position.ProductID); err != nil {
-		log.Print(err)
-		return false
-	}
-	return true
+//ProductByID возвращает товар
+func (s *Service) ProductByID(ctx context.Context, id int64) (*types.Product, error) {
+	return s.store.ProductByID(ctx, id)
 }
 
 //MakeSale ...
 func (s *Service) MakeSale(ctx context.Context, sale *types.Sale) (*types.Sale, error) {
+	ctx, span := tracing.Start(ctx, "managers.MakeSale")
+	defer span.End()
 
-	positionsSQLstmt := "insert into sales_positions (sale_id,product_id,qty,price) values "
-
-	sqlstmt := `insert into sales(manager_id,customer_id) values ($1,$2) returning id, created;`
-
-	err := s.pool.QueryRow(ctx, sqlstmt, sale.ManagerID, sale.CustomerID).Scan(&sale.ID, &sale.Created)
+	sale, err := s.store.CreateSale(ctx, sale)
 	if err != nil {
-		log.Print(err)
-		return nil, types.ErrInternal
-	}
-	for _, position := range sale.Positions {
-		if !s.MakeSalePosition(ctx, position) {
-			log.Print("Invalid position")
-			return nil, types.ErrInternal
-		}
-		positionsSQLstmt += "(" + strconv.FormatInt(sale.ID, 10) + "," + strconv.FormatInt(position.ProductID, 10) + "," + strconv.Itoa(position.Price) + "," + strconv.Itoa(position.Qty) + "),"
+		return nil, err
 	}
 
-	positionsSQLstmt = positionsSQLstmt[0 : len(positionsSQLstmt)-1]
+	s.auditSvc.Record(ctx, "create", "sale", sale.ID, nil, sale)
 
-	log.Print(positionsSQLstmt)
-	_, err = s.pool.Exec(ctx, positionsSQLstmt)
-	if err != nil {
-		log.Print(err)
-		return nil, types.ErrInternal
+	metrics.SalesCreated.Inc()
+	for _, position := range sale.Positions {
+		metrics.UnitsSold.Add(float64(position.Qty))
 	}
 
 	return sale, nil
@@ -185,111 +291,170 @@ func (s *Service) MakeSale(ctx context.Context, sale *types.Sale) (*types.Sale,
 
 //GetSales ...
 func (s *Service) GetSales(ctx context.Context, id int64) (sum int, err error) {
-
-	sqlstmt := `
-	select coalesce(sum(sp.qty * sp.price),0) total
-	from managers m
-	left join sales s on s.manager_id= $1
-	left join sales_positions sp on sp.sale_id = s.id
-	group by m.id
-	limit 1`
-
-	err = s.pool.QueryRow(ctx, sqlstmt, id).Scan(&sum)
-	if err != nil {
-		log.Print(err)
-		return 0, types.ErrInternal
-	}
-	return sum, nil
+	return s.store.SalesTotal(ctx, id)
 }
 
 //Products ...
 func (s *Service) Products(ctx context.Context) ([]*types.Product, error) {
-
-	items := make([]*types.Product, 0)
-
-	sqlstmt := `select id, name, price, qty from products where active = true order by id limit 500`
-	rows, err := s.pool.Query(ctx, sqlstmt)
-
-	if err != nil {
-		if err == pgx.ErrNoRows {
-			return items, nil
-		}
-		return nil, types.ErrInternal
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		item := &types.Product{}
-		err = rows.Scan(&item.ID, &item.Name, &item.Price, &item.Qty)
-		if err != nil {
-			log.Print(err)
-			return nil, err
-		}
-		items = append(items, item)
-	}
-
-	return items, nil
+	return s.store.Products(ctx)
 }
 
 //RemoveProductByID ...
 func (s *Service) RemoveProductByID(ctx context.Context, id int64) (err error) {
 
-	_, err = s.pool.Exec(ctx, `delete from products where id = $1`, id)
+	before, err := s.ProductByID(ctx, id)
 	if err != nil {
-		log.Print(err)
-		return types.ErrInternal
+		return err
 	}
+
+	if err = s.store.RemoveProduct(ctx, id); err != nil {
+		return err
+	}
+
+	s.auditSvc.Record(ctx, "delete", "product", id, before, nil)
 	return nil
 }
 
 //RemoveCustomerByID ...
 func (s *Service) RemoveCustomerByID(ctx context.Context, id int64) (err error) {
 
-	_, err = s.pool.Exec(ctx, `DELETE from customers where id = $1`, id)
+	before, err := s.store.RemoveCustomer(ctx, id)
 	if err != nil {
-		log.Print(err)
-		return types.ErrInternal
+		return err
 	}
+
+	s.auditSvc.Record(ctx, "delete", "customer", id, before, nil)
 	return nil
 }
 
+//CustomerByID возвращает покупателя
+func (s *Service) CustomerByID(ctx context.Context, id int64) (*types.Customer, error) {
+	return s.store.CustomerByID(ctx, id)
+}
+
 //Customers ...
 func (s *Service) Customers(ctx context.Context) ([]*types.Customer, error) {
+	return s.store.Customers(ctx, true)
+}
+
+//ChangeCustomer ...
+func (s *Service) ChangeCustomer(ctx context.Context, customer *types.Customer) (*types.Customer, error) {
 
-	items := make([]*types.Customer, 0)
-	sqlstmt := `select id, name, phone, active, created from customers where active = true order by id limit 500`
-	rows, err := s.pool.Query(ctx, sqlstmt)
+	phone, err := utils.NormalizePhone(customer.Phone)
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			return items, nil
-		}
-		return nil, types.ErrInternal
+		return nil, err
 	}
-	defer rows.Close()
+	customer.Phone = phone
+
+	before, err := s.CustomerByID(ctx, customer.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	customer, err = s.store.UpdateCustomer(ctx, customer)
+	if err != nil {
+		return nil, err
+	}
+
+	s.auditSvc.Record(ctx, "update", "customer", customer.ID, before, customer)
+
+	return customer, nil
+}
+
+//SetBoss назначает продавцу руководителя (bossID = 0 - без руководителя) и отдел
+func (s *Service) SetBoss(ctx context.Context, id, bossID int64, departament string) (*types.Manager, error) {
+
+	if bossID != 0 {
+		// руководитель не может быть самим продавцом или его подчинённым
+		subtree, err := s.Subtree(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		for _, memberID := range subtree {
+			if memberID == bossID {
+				return nil, types.ErrInvalidBoss
+			}
+		}
 
-	for rows.Next() {
-		item := &types.Customer{}
-		err = rows.Scan(&item.ID, &item.Name, &item.Phone, &item.Active, &item.Created)
+		_, err = s.ByID(ctx, bossID)
+		if err == types.ErrNotFound {
+			return nil, types.ErrInvalidBoss
+		}
 		if err != nil {
-			log.Print(err)
 			return nil, err
 		}
-		items = append(items, item)
 	}
 
-	return items, nil
+	before, err := s.ByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := s.store.SetBoss(ctx, id, bossID, departament)
+	if err != nil {
+		return nil, err
+	}
+
+	s.auditSvc.Record(ctx, "update", "manager", id, before, item)
+	return item, nil
 }
 
-//ChangeCustomer ...
-func (s *Service) ChangeCustomer(ctx context.Context, customer *types.Customer) (*types.Customer, error) {
+//ByID возвращает продавца
+func (s *Service) ByID(ctx context.Context, id int64) (*types.Manager, error) {
+	return s.store.ManagerByID(ctx, id)
+}
+
+//Subtree возвращает id продавца и всех его подчинённых на любом уровне
+func (s *Service) Subtree(ctx context.Context, id int64) ([]int64, error) {
+	return s.store.Subtree(ctx, id)
+}
 
-	sqlstmt := `update customers set name = $2, phone = $3, active = $4  where id = $1 returning name,phone,active`
+//CanView проверяет, может ли продавец viewerID видеть данные продавца id:
+//админ видит всех, руководитель - себя и своих подчинённых
+func (s *Service) CanView(ctx context.Context, viewerID, id int64) bool {
+	if viewerID == id || s.IsAdmin(ctx, viewerID) {
+		return true
+	}
 
-	if err := s.pool.QueryRow(ctx, sqlstmt, customer.ID, customer.Name, customer.Phone, customer.Active).
-		Scan(&customer.Name, &customer.Phone, &customer.Active); err != nil {
-		log.Print(err)
-		return nil, types.ErrInternal
+	subtree, err := s.Subtree(ctx, viewerID)
+	if err != nil {
+		return false
+	}
+	for _, memberID := range subtree {
+		if memberID == id {
+			return true
+		}
 	}
+	return false
+}
 
-	return customer, nil
+//Team возвращает оргструктуру: rootID = 0 - все продавцы, иначе продавец rootID и его подчинённые
+func (s *Service) Team(ctx context.Context, rootID int64) ([]*types.TeamNode, error) {
+
+	members, err := s.store.TeamMembers(ctx, rootID)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[int64]*types.TeamNode)
+	for _, node := range members {
+		nodes[node.ID] = node
+	}
+
+	roots := make([]*types.TeamNode, 0)
+	for _, node := range members {
+		boss, ok := nodes[node.BossID]
+		if !ok || node.ID == rootID {
+			roots = append(roots, node)
+			continue
+		}
+		boss.Children = append(boss.Children, node)
+	}
+
+	return roots, nil
+}
+
+//TeamSales возвращает продажи каждого продавца из списка ids
+func (s *Service) TeamSales(ctx context.Context, ids []int64) ([]*types.TeamSales, error) {
+	return s.store.TeamSales(ctx, ids)
 }
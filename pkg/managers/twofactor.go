@@ -0,0 +1,254 @@
+package managers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+	"time"
+
+	"github.com/KarrenAeris/crud/pkg/logger"
+	"github.com/KarrenAeris/crud/pkg/metrics"
+	"github.com/KarrenAeris/crud/pkg/totp"
+	"github.com/KarrenAeris/crud/pkg/types"
+	"github.com/KarrenAeris/crud/pkg/utils"
+)
+
+// Параметры второго фактора
+const (
+	TOTPIssuer           = "crud"          // название сервиса в приложении-аутентификаторе
+	RecoveryCodes        = 10              // сколько кодов восстановления выдаётся при подключении
+	ChallengeTTL         = 5 * time.Minute // сколько ждёт код незавершённый вход
+	MaxChallengeAttempts = 5               // неудачных попыток ввода кода на один вход
+)
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+//EnrollTOTP создаёт новый секрет второго фактора. До подтверждения кодом (ConfirmTOTP) он не действует.
+//Если второй фактор уже подключён - types.ErrTwoFactorEnabled
+func (s *Service) EnrollTOTP(ctx context.Context, id int64) (*types.TOTPEnrollment, error) {
+	item, err := s.ByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+
+	if err = s.store.SaveTOTPSecret(ctx, id, secret); err != nil {
+		return nil, err
+	}
+
+	return &types.TOTPEnrollment{Secret: secret, URI: totp.URI(TOTPIssuer, item.Phone, secret)}, nil
+}
+
+//ConfirmTOTP подключает второй фактор по коду из приложения и возвращает коды восстановления.
+//Коды показываются один раз, хранятся только их хеши. Неверный код - types.ErrInvalidCode,
+//секрет не создавался - types.ErrTwoFactorDisabled, уже подключён - types.ErrTwoFactorEnabled
+func (s *Service) ConfirmTOTP(ctx context.Context, id int64, code string) ([]string, error) {
+	item, err := s.store.TOTP(ctx, id)
+	if err == types.ErrNotFound {
+		return nil, types.ErrTwoFactorDisabled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if item.Enabled {
+		return nil, types.ErrTwoFactorEnabled
+	}
+
+	step, ok := totp.Validate(item.Secret, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return nil, types.ErrInvalidCode
+	}
+
+	codes := make([]string, RecoveryCodes)
+	hashes := make([]string, RecoveryCodes)
+	for i := range codes {
+		codes[i], err = recoveryCode()
+		if err != nil {
+			logger.Error(ctx, err)
+			return nil, types.ErrInternal
+		}
+		hashes[i] = utils.HashToken(normalizeRecoveryCode(codes[i]))
+	}
+
+	err = s.store.EnableTOTP(ctx, id, step, hashes)
+	if err == types.ErrNotFound {
+		// параллельный запрос успел подключить или удалить секрет
+		return nil, types.ErrTwoFactorEnabled
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.auditSvc.Record(ctx, "update", "manager_2fa", id, map[string]bool{"enabled": false}, map[string]bool{"enabled": true})
+	return codes, nil
+}
+
+//DisableTOTP отключает второй фактор по действующему коду или коду восстановления.
+//Не подключён - types.ErrTwoFactorDisabled, неверный код - types.ErrInvalidCode
+func (s *Service) DisableTOTP(ctx context.Context, id int64, code string) error {
+	if !s.totpEnabled(ctx, id) {
+		return types.ErrTwoFactorDisabled
+	}
+
+	ok, err := s.checkSecondFactor(ctx, id, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return types.ErrInvalidCode
+	}
+
+	if err = s.store.DisableTOTP(ctx, id); err != nil {
+		return err
+	}
+
+	s.auditSvc.Record(ctx, "update", "manager_2fa", id, map[string]bool{"enabled": true}, map[string]bool{"enabled": false})
+	return nil
+}
+
+//SetRequireAdminTOTP включает или отключает обязательный второй фактор для админов.
+//Включить может только админ с подключённым вторым фактором, иначе - types.ErrTwoFactorDisabled
+func (s *Service) SetRequireAdminTOTP(ctx context.Context, adminID int64, required bool) error {
+	if required && !s.totpEnabled(ctx, adminID) {
+		return types.ErrTwoFactorDisabled
+	}
+
+	before, err := s.store.RequireAdminTOTP(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err = s.store.SetRequireAdminTOTP(ctx, required); err != nil {
+		return err
+	}
+
+	s.auditSvc.Record(ctx, "update", "auth_policy", 0,
+		map[string]bool{"require_admin_totp": before}, map[string]bool{"require_admin_totp": required})
+	return nil
+}
+
+//VerifyChallenge завершает вход по токену из Token и коду второго фактора (или коду восстановления).
+//Неизвестный или истёкший вход - types.ErrTokenNotFound, неверный код - types.ErrInvalidCode,
+//после MaxChallengeAttempts ошибок вход удаляется и возвращается types.ErrTooManyAttempts.
+//Ошибки кода считаются в ограничениях входа по телефону, после частых ошибок - *lockout.Error
+func (s *Service) VerifyChallenge(ctx context.Context, challenge, code string) (*types.AuthTokens, error) {
+	hash := utils.HashToken(challenge)
+
+	item, err := s.store.LoginChallenge(ctx, hash)
+	if err == types.ErrNotFound {
+		return nil, types.ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(item.Expire) {
+		_ = s.store.DeleteLoginChallenge(ctx, hash)
+		return nil, types.ErrTokenNotFound
+	}
+
+	manager, err := s.ByID(ctx, item.ManagerID)
+	if err != nil {
+		return nil, err
+	}
+	// попытка засчитывается до проверки кода и снимается, если код верный
+	if lockErr := s.lockoutSvc.Attempt(ctx, types.UserManager, manager.Phone); lockErr != nil {
+		metrics.Login(metrics.UserManager, false)
+		return nil, lockErr
+	}
+
+	ok, err := s.checkSecondFactor(ctx, item.ManagerID, code)
+	if err != nil {
+		s.lockoutSvc.Release(ctx, types.UserManager, manager.Phone)
+		return nil, err
+	}
+	if !ok {
+		logger.Warn(ctx, "invalid manager two-factor code", "manager_id", item.ManagerID)
+		metrics.Login(metrics.UserManager, false)
+
+		if item.Attempts+1 >= MaxChallengeAttempts {
+			if err = s.store.DeleteLoginChallenge(ctx, hash); err != nil {
+				return nil, err
+			}
+			return nil, types.ErrTooManyAttempts
+		}
+		if err = s.store.AddLoginChallengeAttempt(ctx, hash); err != nil {
+			return nil, err
+		}
+		return nil, types.ErrInvalidCode
+	}
+	s.lockoutSvc.Release(ctx, types.UserManager, manager.Phone)
+
+	if err = s.store.DeleteLoginChallenge(ctx, hash); err != nil {
+		return nil, err
+	}
+
+	return s.login(ctx, item.ManagerID, manager.Phone)
+}
+
+// totpEnabled сообщает, подключён ли у продавца второй фактор
+func (s *Service) totpEnabled(ctx context.Context, id int64) bool {
+	item, err := s.store.TOTP(ctx, id)
+	if err != nil {
+		return false
+	}
+	return item.Enabled
+}
+
+// checkSecondFactor проверяет код из приложения или код восстановления, принятый код повторно не действует
+func (s *Service) checkSecondFactor(ctx context.Context, id int64, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if len(code) != totp.Digits {
+		return s.store.UseRecoveryCode(ctx, id, utils.HashToken(normalizeRecoveryCode(code)))
+	}
+
+	item, err := s.store.TOTP(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := totp.Validate(item.Secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return s.store.UseTOTPStep(ctx, id, step)
+}
+
+// newChallenge сохраняет незавершённый вход и возвращает его токен
+func (s *Service) newChallenge(ctx context.Context, id int64) (string, error) {
+	token, err := utils.GenerateTokenStr()
+	if err != nil {
+		logger.Error(ctx, err)
+		return "", err
+	}
+
+	item := &types.LoginChallenge{
+		Hash:      utils.HashToken(token),
+		ManagerID: id,
+		Expire:    time.Now().Add(ChallengeTTL),
+	}
+	if err = s.store.SaveLoginChallenge(ctx, item); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// recoveryCode создаёт код восстановления вида xxxxx-xxxxx
+func recoveryCode() (string, error) {
+	buffer := make([]byte, 8)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(recoveryEncoding.EncodeToString(buffer))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+// normalizeRecoveryCode приводит введённый код восстановления к виду, от которого считается хеш
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(code), "-", "", -1))
+}
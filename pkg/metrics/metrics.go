@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "crud"
+
+// Кто входит в систему
+const (
+	UserCustomer = "customer"
+	UserManager  = "manager"
+)
+
+// Результат входа
+const (
+	LoginSuccess = "success"
+	LoginFailure = "failure"
+)
+
+var (
+	//HTTPRequests считает запросы по маршруту, методу и статусу
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests by route template, method and status.",
+	}, []string{"route", "method", "status"})
+
+	//HTTPDuration - время обработки запросов по маршруту и методу
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route template and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	//Logins считает попытки входа покупателей и продавцов
+	Logins = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Number of token requests by user type and result.",
+	}, []string{"user", "result"})
+
+	//SalesCreated считает оформленные продажи
+	SalesCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sales_created_total",
+		Help:      "Number of sales created.",
+	})
+
+	//UnitsSold считает проданные единицы товара
+	UnitsSold = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "units_sold_total",
+		Help:      "Number of product units sold.",
+	})
+)
+
+//Login учитывает попытку входа
+func Login(user string, ok bool) {
+	result := LoginSuccess
+	if !ok {
+		result = LoginFailure
+	}
+	Logins.WithLabelValues(user, result).Inc()
+}
+
+//Handler отдаёт метрики в текстовом формате Prometheus
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+//RegisterPool регистрирует метрики пула соединений с БД
+func RegisterPool(pool *pgxpool.Pool) error {
+	return prometheus.Register(&poolCollector{pool: pool})
+}
+
+var (
+	poolAcquiredConns = prometheus.NewDesc(namespace+"_db_pool_acquired_conns",
+		"Number of currently acquired connections.", nil, nil)
+	poolIdleConns = prometheus.NewDesc(namespace+"_db_pool_idle_conns",
+		"Number of currently idle connections.", nil, nil)
+	poolTotalConns = prometheus.NewDesc(namespace+"_db_pool_total_conns",
+		"Total number of connections in the pool.", nil, nil)
+	poolMaxConns = prometheus.NewDesc(namespace+"_db_pool_max_conns",
+		"Maximum size of the pool.", nil, nil)
+	poolAcquireCount = prometheus.NewDesc(namespace+"_db_pool_acquire_total",
+		"Number of successful connection acquires.", nil, nil)
+	poolEmptyAcquireCount = prometheus.NewDesc(namespace+"_db_pool_empty_acquire_total",
+		"Number of acquires that had to wait for a connection.", nil, nil)
+	poolAcquireDuration = prometheus.NewDesc(namespace+"_db_pool_acquire_wait_seconds_total",
+		"Total time spent acquiring connections.", nil, nil)
+)
+
+// poolCollector снимает статистику пула в момент запроса метрик
+type poolCollector struct {
+	pool *pgxpool.Pool
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolAcquiredConns
+	ch <- poolIdleConns
+	ch <- poolTotalConns
+	ch <- poolMaxConns
+	ch <- poolAcquireCount
+	ch <- poolEmptyAcquireCount
+	ch <- poolAcquireDuration
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+
+	ch <- prometheus.MustNewConstMetric(poolAcquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(poolIdleConns, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(poolTotalConns, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(poolMaxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(poolAcquireCount, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolEmptyAcquireCount, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolAcquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+}
@@ -0,0 +1,350 @@
+package orders
+
+import (
+	"context"
+
+	"github.com/KarrenAeris/crud/pkg/logger"
+	"github.com/KarrenAeris/crud/pkg/managers"
+	"github.com/KarrenAeris/crud/pkg/reservations"
+	"github.com/KarrenAeris/crud/pkg/types"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+//Service описывает сервис работы с корзинами и заказами покупателей.
+type Service struct {
+	pool           *pgxpool.Pool
+	managerSvc     *managers.Service
+	reservationSvc *reservations.Service
+}
+
+//NewService создаёт сервис.
+func NewService(pool *pgxpool.Pool, managerSvc *managers.Service, reservationSvc *reservations.Service) *Service {
+	return &Service{pool: pool, managerSvc: managerSvc, reservationSvc: reservationSvc}
+}
+
+//Cart возвращает позиции корзины покупателя
+func (s *Service) Cart(ctx context.Context, customerID int64) ([]*types.CartPosition, error) {
+
+	items := make([]*types.CartPosition, 0)
+
+	sqlstmt := `
+	select cp.product_id, p.name, p.price, cp.qty, cp.created
+	from carts_positions cp
+	join products p on p.id = cp.product_id
+	where cp.customer_id = $1
+	order by cp.created`
+
+	rows, err := s.pool.Query(ctx, sqlstmt, customerID)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &types.CartPosition{}
+		err = rows.Scan(&item.ProductID, &item.Name, &item.Price, &item.Qty, &item.Created)
+		if err != nil {
+			logger.Error(ctx, err)
+			return nil, types.ErrInternal
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+//SetCartPosition кладёт товар в корзину или меняет его количество, при qty = 0 убирает товар из корзины
+func (s *Service) SetCartPosition(ctx context.Context, customerID int64, position *types.CartPosition) ([]*types.CartPosition, error) {
+
+	if position.Qty <= 0 {
+		return s.RemoveCartPosition(ctx, customerID, position.ProductID)
+	}
+
+	active := false
+	err := s.pool.QueryRow(ctx, `select active from products where id = $1`, position.ProductID).Scan(&active)
+	if err == pgx.ErrNoRows || (err == nil && !active) {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+
+	sqlstmt := `
+	insert into carts_positions(customer_id, product_id, qty) values ($1, $2, $3)
+	on conflict (customer_id, product_id) do update set qty = excluded.qty`
+
+	_, err = s.pool.Exec(ctx, sqlstmt, customerID, position.ProductID, position.Qty)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+
+	return s.Cart(ctx, customerID)
+}
+
+//RemoveCartPosition убирает товар из корзины покупателя
+func (s *Service) RemoveCartPosition(ctx context.Context, customerID, productID int64) ([]*types.CartPosition, error) {
+
+	_, err := s.pool.Exec(ctx, `delete from carts_positions where customer_id = $1 and product_id = $2`, customerID, productID)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+
+	return s.Cart(ctx, customerID)
+}
+
+//Checkout оформляет заказ из активных товаров корзины покупателя, резервирует их и убирает из корзины.
+//Товары, снятые с продажи, в заказ не попадают и остаются в корзине
+func (s *Service) Checkout(ctx context.Context, customerID int64) (*types.Order, error) {
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	sqlstmt := `
+	select cp.product_id, p.price, cp.qty
+	from carts_positions cp
+	join products p on p.id = cp.product_id and p.active
+	where cp.customer_id = $1
+	order by cp.created`
+
+	rows, err := tx.Query(ctx, sqlstmt, customerID)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+
+	order := &types.Order{CustomerID: customerID, Status: types.OrderPending}
+	for rows.Next() {
+		position := &types.OrderPosition{}
+		err = rows.Scan(&position.ProductID, &position.Price, &position.Qty)
+		if err != nil {
+			rows.Close()
+			logger.Error(ctx, err)
+			return nil, types.ErrInternal
+		}
+		order.Positions = append(order.Positions, position)
+	}
+	rows.Close()
+
+	if len(order.Positions) == 0 {
+		return nil, types.ErrCartEmpty
+	}
+
+	err = tx.QueryRow(ctx, `insert into orders(customer_id, status) values ($1, $2) returning id, created`, customerID, order.Status).
+		Scan(&order.ID, &order.Created)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+
+	for _, position := range order.Positions {
+		position.OrderID = order.ID
+		err = tx.QueryRow(ctx, `insert into orders_positions(order_id, product_id, price, qty) values ($1, $2, $3, $4) returning id`,
+			position.OrderID, position.ProductID, position.Price, position.Qty).Scan(&position.ID)
+		if err != nil {
+			logger.Error(ctx, err)
+			return nil, types.ErrInternal
+		}
+
+		_, err = s.reservationSvc.ReserveTx(ctx, tx, &types.Reservation{
+			ProductID: position.ProductID,
+			Qty:       position.Qty,
+			OrderID:   order.ID,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// из корзины убираются только заказанные товары: снятые с продажи остаются, покупатель увидит их в корзине
+	productIDs := make([]int64, 0, len(order.Positions))
+	for _, position := range order.Positions {
+		productIDs = append(productIDs, position.ProductID)
+	}
+	_, err = tx.Exec(ctx, `delete from carts_positions where customer_id = $1 and product_id = any($2)`, customerID, productIDs)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+
+	return order, nil
+}
+
+//ByID возвращает заказ вместе с позициями
+func (s *Service) ByID(ctx context.Context, id int64) (*types.Order, error) {
+
+	order := &types.Order{}
+
+	sqlstmt := `
+	select id, customer_id, coalesce(manager_id, 0), coalesce(sale_id, 0), status, created
+	from orders where id = $1`
+
+	err := s.pool.QueryRow(ctx, sqlstmt, id).
+		Scan(&order.ID, &order.CustomerID, &order.ManagerID, &order.SaleID, &order.Status, &order.Created)
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+
+	rows, err := s.pool.Query(ctx, `select id, order_id, product_id, price, qty from orders_positions where order_id = $1 order by id`, id)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		position := &types.OrderPosition{}
+		err = rows.Scan(&position.ID, &position.OrderID, &position.ProductID, &position.Price, &position.Qty)
+		if err != nil {
+			logger.Error(ctx, err)
+			return nil, types.ErrInternal
+		}
+		order.Positions = append(order.Positions, position)
+	}
+
+	return order, nil
+}
+
+//Orders возвращает список заказов, customerID = 0 - заказы всех покупателей, пустой status - в любом статусе
+func (s *Service) Orders(ctx context.Context, customerID int64, status string) ([]*types.Order, error) {
+
+	items := make([]*types.Order, 0)
+
+	sqlstmt := `
+	select id, customer_id, coalesce(manager_id, 0), coalesce(sale_id, 0), status, created
+	from orders
+	where ($1 = 0 or customer_id = $1) and ($2 = '' or status = $2)
+	order by id desc limit 500`
+
+	rows, err := s.pool.Query(ctx, sqlstmt, customerID, status)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &types.Order{}
+		err = rows.Scan(&item.ID, &item.CustomerID, &item.ManagerID, &item.SaleID, &item.Status, &item.Created)
+		if err != nil {
+			logger.Error(ctx, err)
+			return nil, types.ErrInternal
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+//Confirm подтверждает заказ продавцом и создаёт по нему продажу
+func (s *Service) Confirm(ctx context.Context, managerID, id int64) (*types.Order, error) {
+
+	order, err := s.ByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status != types.OrderPending {
+		return nil, types.ErrOrderStatus
+	}
+
+	// продажа в своей транзакции подтверждает заказ, только если он ещё ожидает подтверждения
+	// (два продавца не подтвердят его дважды), снимает его резерв и списывает товар:
+	// при ошибке заказ остаётся ожидающим, а товар - зарезервированным за ним
+	sale := &types.Sale{ManagerID: managerID, CustomerID: order.CustomerID, OrderID: id}
+	for _, position := range order.Positions {
+		sale.Positions = append(sale.Positions, &types.SalePosition{
+			ProductID: position.ProductID,
+			Price:     position.Price,
+			Qty:       position.Qty,
+		})
+	}
+
+	sale, err = s.managerSvc.MakeSale(ctx, sale)
+	if err != nil {
+		return nil, err
+	}
+	order.Status = types.OrderConfirmed
+	order.ManagerID = managerID
+	order.SaleID = sale.ID
+
+	return order, nil
+}
+
+//Fulfill отмечает подтверждённый заказ как выданный
+func (s *Service) Fulfill(ctx context.Context, id int64) (*types.Order, error) {
+	if err := s.changeStatus(ctx, s.pool, id, 0, types.OrderFulfilled, types.OrderConfirmed); err != nil {
+		return nil, err
+	}
+	return s.ByID(ctx, id)
+}
+
+//Cancel отменяет заказ, ожидающий подтверждения, и снимает его резервы. customerID = 0 - отмена продавцом
+func (s *Service) Cancel(ctx context.Context, customerID, id int64) (*types.Order, error) {
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	if err = s.changeStatus(ctx, tx, id, customerID, types.OrderCancelled, types.OrderPending); err != nil {
+		return nil, err
+	}
+	if err = s.reservationSvc.ReleaseOrderTx(ctx, tx, id); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	return s.ByID(ctx, id)
+}
+
+// execer - пул соединений или транзакция
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+}
+
+func (s *Service) changeStatus(ctx context.Context, db execer, id, customerID int64, status, from string) error {
+
+	sqlstmt := `update orders set status = $2 where id = $1 and status = $3 and ($4 = 0 or customer_id = $4)`
+	tag, err := db.Exec(ctx, sqlstmt, id, status, from, customerID)
+	if err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	if tag.RowsAffected() == 0 {
+		return s.statusError(ctx, id)
+	}
+	return nil
+}
+
+// statusError различает отсутствующий заказ и заказ в неподходящем статусе
+func (s *Service) statusError(ctx context.Context, id int64) error {
+	_, err := s.ByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	return types.ErrOrderStatus
+}
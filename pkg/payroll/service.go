@@ -0,0 +1,364 @@
+package payroll
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/KarrenAeris/crud/pkg/logger"
+	"github.com/KarrenAeris/crud/pkg/types"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+//Service описывает сервис расчёта зарплаты продавцов.
+type Service struct {
+	pool *pgxpool.Pool
+}
+
+//NewService создаёт сервис.
+func NewService(pool *pgxpool.Pool) *Service {
+	return &Service{pool: pool}
+}
+
+//Rules возвращает текущие правила расчёта комиссии
+func (s *Service) Rules(ctx context.Context) (*types.CommissionRules, error) {
+
+	rules := &types.CommissionRules{
+		Tiers:      make([]*types.CommissionTier, 0),
+		Categories: make([]*types.CategoryRate, 0),
+	}
+
+	rows, err := s.pool.Query(ctx, `select min_percent, rate from commission_tiers order by min_percent`)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	for rows.Next() {
+		tier := &types.CommissionTier{}
+		if err = rows.Scan(&tier.MinPercent, &tier.Rate); err != nil {
+			rows.Close()
+			logger.Error(ctx, err)
+			return nil, types.ErrInternal
+		}
+		rules.Tiers = append(rules.Tiers, tier)
+	}
+	rows.Close()
+
+	rows, err = s.pool.Query(ctx, `select category, rate from commission_categories order by category`)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+	for rows.Next() {
+		category := &types.CategoryRate{}
+		if err = rows.Scan(&category.Category, &category.Rate); err != nil {
+			logger.Error(ctx, err)
+			return nil, types.ErrInternal
+		}
+		rules.Categories = append(rules.Categories, category)
+	}
+
+	return rules, nil
+}
+
+//SaveRules полностью заменяет правила расчёта комиссии
+func (s *Service) SaveRules(ctx context.Context, rules *types.CommissionRules) (*types.CommissionRules, error) {
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err = tx.Exec(ctx, `delete from commission_tiers`); err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	if _, err = tx.Exec(ctx, `delete from commission_categories`); err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+
+	for _, tier := range rules.Tiers {
+		_, err = tx.Exec(ctx, `insert into commission_tiers(min_percent, rate) values ($1, $2)`, tier.MinPercent, tier.Rate)
+		if err != nil {
+			logger.Error(ctx, err)
+			return nil, types.ErrInternal
+		}
+	}
+	for _, category := range rules.Categories {
+		_, err = tx.Exec(ctx, `insert into commission_categories(category, rate) values ($1, $2)`, category.Category, category.Rate)
+		if err != nil {
+			logger.Error(ctx, err)
+			return nil, types.ErrInternal
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+
+	return s.Rules(ctx)
+}
+
+//Calculate считает зарплату всех активных продавцов за месяц period и сохраняет расчёт как черновик
+func (s *Service) Calculate(ctx context.Context, adminID int64, period time.Time) (*types.Payroll, error) {
+
+	period = time.Date(period.Year(), period.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	rules, err := s.Rules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlstmt := `
+	select m.id, m.name, m.salary, m.plan, coalesce(p.category, ''), coalesce(sum(sp.qty * sp.price), 0)
+	from managers m
+	left join sales s on s.manager_id = m.id and s.created >= $1 and s.created < $2
+	left join sales_positions sp on sp.sale_id = s.id
+	left join products p on p.id = sp.product_id
+	where m.active
+	group by m.id, m.name, m.salary, m.plan, p.category
+	order by m.id`
+
+	rows, err := s.pool.Query(ctx, sqlstmt, period, period.AddDate(0, 1, 0))
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+
+	items := make([]*types.PayrollItem, 0)
+	revenues := make(map[int64]map[string]int64)
+	for rows.Next() {
+		item := &types.PayrollItem{}
+		var category string
+		var revenue int64
+		err = rows.Scan(&item.ManagerID, &item.Name, &item.Salary, &item.Plan, &category, &revenue)
+		if err != nil {
+			rows.Close()
+			logger.Error(ctx, err)
+			return nil, types.ErrInternal
+		}
+
+		if _, ok := revenues[item.ManagerID]; !ok {
+			revenues[item.ManagerID] = make(map[string]int64)
+			items = append(items, item)
+		}
+		revenues[item.ManagerID][category] += revenue
+	}
+	rows.Close()
+
+	for _, item := range items {
+		for _, revenue := range revenues[item.ManagerID] {
+			item.Revenue += revenue
+		}
+		item.Commission = Commission(item.Plan, revenues[item.ManagerID], rules)
+		item.Total = item.Salary + item.Commission
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	payroll := &types.Payroll{Period: period, Status: types.PayrollDraft, CreatedBy: adminID, Items: items}
+	err = tx.QueryRow(ctx, `insert into payrolls(period, status, created_by) values ($1, $2, $3) returning id, created`,
+		period, payroll.Status, adminID).Scan(&payroll.ID, &payroll.Created)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+
+	for _, item := range items {
+		item.PayrollID = payroll.ID
+		sqlstmt = `
+		insert into payrolls_items(payroll_id, manager_id, salary, plan, revenue, commission, total)
+		values ($1, $2, $3, $4, $5, $6, $7)`
+		_, err = tx.Exec(ctx, sqlstmt, item.PayrollID, item.ManagerID, item.Salary, item.Plan, item.Revenue, item.Commission, item.Total)
+		if err != nil {
+			logger.Error(ctx, err)
+			return nil, types.ErrInternal
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+
+	return payroll, nil
+}
+
+//Commission считает комиссию с продаж сверх плана. Сверхплановая выручка делится между категориями
+//пропорционально их выручке; для категории со своей ставкой берётся она, для остальных - ставка
+//уровня, которого достиг продавец (уровни задаются минимальным процентом выполнения плана)
+func Commission(plan int64, revenues map[string]int64, rules *types.CommissionRules) int64 {
+	var revenue int64
+	for _, value := range revenues {
+		revenue += value
+	}
+	excess := revenue - plan
+	if excess <= 0 || revenue == 0 {
+		return 0
+	}
+
+	tierRate := 0
+	tiers := append([]*types.CommissionTier(nil), rules.Tiers...)
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].MinPercent < tiers[j].MinPercent })
+	for _, tier := range tiers {
+		// без плана любая выручка - сверх плана, подходит любой уровень
+		if plan == 0 || mul(revenue, 100).Cmp(mul(int64(tier.MinPercent), plan)) >= 0 {
+			tierRate = tier.Rate
+		}
+	}
+
+	categoryRates := make(map[string]int)
+	for _, category := range rules.Categories {
+		categoryRates[category.Category] = category.Rate
+	}
+
+	var commission int64
+	for category, value := range revenues {
+		rate, ok := categoryRates[category]
+		if !ok {
+			rate = tierRate
+		}
+		// сверхплановая выручка категории * ставка в сотых долях процента. Произведение выручек
+		// в копейках не помещается в int64, результат - не больше excess
+		share := mul(excess, value)
+		share.Mul(share, big.NewInt(int64(rate)))
+		share.Quo(share, mul(revenue, 10000))
+		commission += share.Int64()
+	}
+	return commission
+}
+
+//mul возвращает произведение a и b без переполнения
+func mul(a, b int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(a), big.NewInt(b))
+}
+
+//Payrolls возвращает список расчётов без начислений
+func (s *Service) Payrolls(ctx context.Context) ([]*types.Payroll, error) {
+
+	items := make([]*types.Payroll, 0)
+
+	sqlstmt := `
+	select id, period, status, created_by, coalesce(locked_by, 0), locked, created
+	from payrolls order by period desc, id desc limit 500`
+
+	rows, err := s.pool.Query(ctx, sqlstmt)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &types.Payroll{}
+		err = rows.Scan(&item.ID, &item.Period, &item.Status, &item.CreatedBy, &item.LockedBy, &item.Locked, &item.Created)
+		if err != nil {
+			logger.Error(ctx, err)
+			return nil, types.ErrInternal
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+//ByID возвращает расчёт вместе с начислениями
+func (s *Service) ByID(ctx context.Context, id int64) (*types.Payroll, error) {
+
+	payroll := &types.Payroll{}
+
+	sqlstmt := `
+	select id, period, status, created_by, coalesce(locked_by, 0), locked, created
+	from payrolls where id = $1`
+
+	err := s.pool.QueryRow(ctx, sqlstmt, id).Scan(&payroll.ID, &payroll.Period, &payroll.Status,
+		&payroll.CreatedBy, &payroll.LockedBy, &payroll.Locked, &payroll.Created)
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+
+	payroll.Items, err = s.items(ctx, `where pi.payroll_id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	return payroll, nil
+}
+
+//Lock утверждает расчёт. За месяц может быть утверждён только один расчёт
+func (s *Service) Lock(ctx context.Context, adminID, id int64) (*types.Payroll, error) {
+
+	sqlstmt := `update payrolls set status = $2, locked_by = $3, locked = CURRENT_TIMESTAMP where id = $1 and status = $4`
+	tag, err := s.pool.Exec(ctx, sqlstmt, id, types.PayrollLocked, adminID, types.PayrollDraft)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		// уникальный индекс не даёт утвердить второй расчёт за тот же месяц
+		return nil, types.ErrPayrollLocked
+	}
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	if tag.RowsAffected() == 0 {
+		if _, err = s.ByID(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, types.ErrPayrollLocked
+	}
+
+	return s.ByID(ctx, id)
+}
+
+//ManagerItems возвращает начисления продавца из утверждённых расчётов
+func (s *Service) ManagerItems(ctx context.Context, managerID int64) ([]*types.PayrollItem, error) {
+	return s.items(ctx, `join payrolls p on p.id = pi.payroll_id and p.status = 'locked' where pi.manager_id = $1`, managerID)
+}
+
+func (s *Service) items(ctx context.Context, condition string, arg int64) ([]*types.PayrollItem, error) {
+
+	items := make([]*types.PayrollItem, 0)
+
+	sqlstmt := `
+	select pi.payroll_id, pi.manager_id, m.name, pi.salary, pi.plan, pi.revenue, pi.commission, pi.total
+	from payrolls_items pi
+	join managers m on m.id = pi.manager_id ` + condition + `
+	order by pi.payroll_id desc, pi.manager_id`
+
+	rows, err := s.pool.Query(ctx, sqlstmt, arg)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &types.PayrollItem{}
+		err = rows.Scan(&item.PayrollID, &item.ManagerID, &item.Name, &item.Salary, &item.Plan,
+			&item.Revenue, &item.Commission, &item.Total)
+		if err != nil {
+			logger.Error(ctx, err)
+			return nil, types.ErrInternal
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
@@ -0,0 +1,40 @@
+package payroll
+
+import (
+	"testing"
+
+	"github.com/KarrenAeris/crud/pkg/types"
+)
+
+func TestCommission(t *testing.T) {
+	rules := &types.CommissionRules{
+		Tiers: []*types.CommissionTier{
+			{MinPercent: 150, Rate: 1000},
+			{MinPercent: 100, Rate: 500},
+		},
+		Categories: []*types.CategoryRate{{Category: "phones", Rate: 200}},
+	}
+
+	tests := []struct {
+		name     string
+		plan     int64
+		revenues map[string]int64
+		want     int64
+	}{
+		{"no sales", 1000, nil, 0},
+		{"below plan", 1000, map[string]int64{"food": 999}, 0},
+		{"first tier", 1000, map[string]int64{"food": 1200}, 10},
+		{"second tier", 1000, map[string]int64{"food": 2000}, 100},
+		{"category rate", 1000, map[string]int64{"food": 1000, "phones": 1000}, 50 + 10},
+		{"without plan", 0, map[string]int64{"food": 1000}, 100},
+		// выручка в копейках за крупный месяц: excess * value больше, чем помещается в int64
+		{"large revenue", 10000000000, map[string]int64{"food": 20000000000}, 1000000000},
+		{"large revenue by category", 10000000000, map[string]int64{"food": 15000000000, "phones": 15000000000},
+			1000000000 + 200000000},
+	}
+	for _, test := range tests {
+		if got := Commission(test.plan, test.revenues, rules); got != test.want {
+			t.Errorf("%s: Commission = %d, want %d", test.name, got, test.want)
+		}
+	}
+}
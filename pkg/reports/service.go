@@ -0,0 +1,116 @@
+package reports
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/KarrenAeris/crud/pkg/logger"
+	"github.com/KarrenAeris/crud/pkg/types"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Группировка отчёта по периодам
+const (
+	GroupDay   = "day"
+	GroupWeek  = "week"
+	GroupMonth = "month"
+)
+
+//ErrInvalidGroup возвращается, когда указана неизвестная группировка
+var ErrInvalidGroup = errors.New("invalid report group")
+
+//ErrPeriodTooLong возвращается, когда в отчёте слишком много периодов для группировки
+var ErrPeriodTooLong = errors.New("report period is too long for the group")
+
+//Service описывает сервис отчётов по продажам.
+type Service struct {
+	pool *pgxpool.Pool
+}
+
+//NewService создаёт сервис.
+func NewService(pool *pgxpool.Pool) *Service {
+	return &Service{pool: pool}
+}
+
+//Performance возвращает выручку, число продаж, средний чек и выполнение плана продавцов
+//за [from, to) по периодам group. managerIDs = nil - по всем продавцам
+func (s *Service) Performance(ctx context.Context, from, to time.Time, group string, managerIDs []int64) ([]*types.Performance, error) {
+
+	// отчёт содержит строку на каждого продавца в каждом периоде, поэтому длина отчёта ограничена
+	var last time.Time
+	switch group {
+	case GroupDay:
+		last = from.AddDate(0, 0, 366)
+	case GroupWeek:
+		last = from.AddDate(3, 0, 0)
+	case GroupMonth:
+		last = from.AddDate(10, 0, 0)
+	default:
+		return nil, ErrInvalidGroup
+	}
+	if to.After(last) {
+		return nil, ErrPeriodTooLong
+	}
+
+	items := make([]*types.Performance, 0)
+
+	// отчёт строится от продавцов и периодов, поэтому продавец без продаж попадает в него с нулями.
+	// Уволенные продавцы остаются только в периодах, где у них есть продажи
+	sqlstmt := `
+	select m.id, m.name, m.plan, p.period,
+		count(distinct s.id), coalesce(sum(sp.qty * sp.price), 0)
+	from managers m
+	cross join generate_series(date_trunc($3::text, $1::timestamp), $2::timestamp - interval '1 microsecond',
+		('1 ' || $3::text)::interval) p(period)
+	left join sales s on s.manager_id = m.id
+		and s.created >= greatest(p.period, $1::timestamp)
+		and s.created < least(p.period + ('1 ' || $3::text)::interval, $2::timestamp)
+	left join sales_positions sp on sp.sale_id = s.id
+	where $4::bigint[] is null or m.id = any($4)
+	group by m.id, m.name, m.plan, p.period
+	having m.active or count(s.id) > 0
+	order by p.period, m.id`
+
+	rows, err := s.pool.Query(ctx, sqlstmt, from, to, group, managerIDs)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &types.Performance{}
+		err = rows.Scan(&item.ManagerID, &item.Name, &item.Plan, &item.Period, &item.Sales, &item.Revenue)
+		if err != nil {
+			logger.Error(ctx, err)
+			return nil, types.ErrInternal
+		}
+
+		if item.Sales > 0 {
+			item.AverageTicket = item.Revenue / item.Sales
+		}
+		// план в managers.plan месячный - для дня и недели берём его долю
+		if plan := periodPlan(item.Plan, item.Period, group); plan > 0 {
+			item.PlanPercent = float64(item.Revenue) * 100 / plan
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// periodPlan возвращает долю месячного плана, приходящуюся на период
+func periodPlan(monthly int64, period time.Time, group string) float64 {
+	daysInMonth := time.Date(period.Year(), period.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+
+	switch group {
+	case GroupDay:
+		return float64(monthly) / float64(daysInMonth)
+	case GroupWeek:
+		return float64(monthly) * 7 / float64(daysInMonth)
+	default:
+		return float64(monthly)
+	}
+}
@@ -0,0 +1,218 @@
+package reservations
+
+import (
+	"context"
+	"time"
+
+	"github.com/KarrenAeris/crud/pkg/logger"
+	"github.com/KarrenAeris/crud/pkg/types"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+//Service описывает сервис резервирования товара.
+type Service struct {
+	pool *pgxpool.Pool
+	ttl  time.Duration
+}
+
+//NewService создаёт сервис, ttl - время жизни резерва.
+func NewService(pool *pgxpool.Pool, ttl time.Duration) *Service {
+	return &Service{pool: pool, ttl: ttl}
+}
+
+//Reserve резервирует товар, если его хватает с учётом уже действующих резервов
+func (s *Service) Reserve(ctx context.Context, item *types.Reservation) (*types.Reservation, error) {
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	item, err = s.ReserveTx(ctx, tx, item)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	return item, nil
+}
+
+//ReserveTx резервирует товар в рамках уже открытой транзакции
+func (s *Service) ReserveTx(ctx context.Context, tx pgx.Tx, item *types.Reservation) (*types.Reservation, error) {
+
+	// блокируем строку товара, чтобы параллельные резервы не продали один и тот же остаток
+	var qty int
+	var active bool
+	err := tx.QueryRow(ctx, `select qty, active from products where id = $1 for update`, item.ProductID).Scan(&qty, &active)
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+
+	reserved := 0
+	sqlstmt := `select coalesce(sum(qty), 0) from reservations where product_id = $1 and expire > now()`
+	if err = tx.QueryRow(ctx, sqlstmt, item.ProductID).Scan(&reserved); err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+
+	if !active || qty-reserved < item.Qty {
+		return nil, types.ErrInvalidPosition
+	}
+
+	sqlstmt = `
+	insert into reservations(product_id, qty, order_id, manager_id, expire)
+	values ($1, $2, nullif($3, 0), nullif($4, 0), CURRENT_TIMESTAMP + $5 * interval '1 second')
+	returning id, expire, created`
+
+	err = tx.QueryRow(ctx, sqlstmt, item.ProductID, item.Qty, item.OrderID, item.ManagerID, s.ttl.Seconds()).
+		Scan(&item.ID, &item.Expire, &item.Created)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+
+	return item, nil
+}
+
+//ByManager возвращает действующие резервы продавца (черновики продаж)
+func (s *Service) ByManager(ctx context.Context, managerID int64) ([]*types.Reservation, error) {
+
+	items := make([]*types.Reservation, 0)
+
+	sqlstmt := `
+	select id, product_id, qty, coalesce(order_id, 0), coalesce(manager_id, 0), expire, created
+	from reservations
+	where manager_id = $1 and expire > now()
+	order by id`
+
+	rows, err := s.pool.Query(ctx, sqlstmt, managerID)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &types.Reservation{}
+		err = rows.Scan(&item.ID, &item.ProductID, &item.Qty, &item.OrderID, &item.ManagerID, &item.Expire, &item.Created)
+		if err != nil {
+			logger.Error(ctx, err)
+			return nil, types.ErrInternal
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+//Release снимает резерв продавца
+func (s *Service) Release(ctx context.Context, managerID, id int64) error {
+
+	tag, err := s.pool.Exec(ctx, `delete from reservations where id = $1 and manager_id = $2`, id, managerID)
+	if err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	if tag.RowsAffected() == 0 {
+		return types.ErrNotFound
+	}
+	return nil
+}
+
+//ReleaseOrderTx снимает все резервы заказа в рамках уже открытой транзакции
+func (s *Service) ReleaseOrderTx(ctx context.Context, tx pgx.Tx, orderID int64) error {
+
+	if _, err := tx.Exec(ctx, `delete from reservations where order_id = $1`, orderID); err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	return nil
+}
+
+//Sweep удаляет истёкшие резервы и возвращает их количество. Заказы, ожидающие подтверждения,
+//без резерва отменяются: их товар уже могли купить другие
+func (s *Service) Sweep(ctx context.Context) (int64, error) {
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		logger.Error(ctx, err)
+		return 0, types.ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `delete from reservations where expire <= now() returning coalesce(order_id, 0)`)
+	if err != nil {
+		logger.Error(ctx, err)
+		return 0, types.ErrInternal
+	}
+
+	var n int64
+	orderIDs := make([]int64, 0)
+	for rows.Next() {
+		var orderID int64
+		if err = rows.Scan(&orderID); err != nil {
+			rows.Close()
+			logger.Error(ctx, err)
+			return 0, types.ErrInternal
+		}
+		n++
+		if orderID != 0 {
+			orderIDs = append(orderIDs, orderID)
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		logger.Error(ctx, err)
+		return 0, types.ErrInternal
+	}
+
+	if len(orderIDs) > 0 {
+		sqlstmt := `update orders set status = $2 where id = any($1) and status = $3`
+		tag, err := tx.Exec(ctx, sqlstmt, orderIDs, types.OrderCancelled, types.OrderPending)
+		if err != nil {
+			logger.Error(ctx, err)
+			return 0, types.ErrInternal
+		}
+		if tag.RowsAffected() > 0 {
+			logger.Info(ctx, "cancelled orders with expired reservations", "count", tag.RowsAffected())
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logger.Error(ctx, err)
+		return 0, types.ErrInternal
+	}
+	return n, nil
+}
+
+//RunSweeper периодически удаляет истёкшие резервы, пока не отменён ctx
+func (s *Service) RunSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.Sweep(ctx)
+			if err != nil {
+				continue
+			}
+			if n > 0 {
+				logger.Info(ctx, "released expired reservations", "count", n)
+			}
+		}
+	}
+}
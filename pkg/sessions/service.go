@@ -0,0 +1,102 @@
+package sessions
+
+import (
+	"context"
+	"time"
+
+	"github.com/KarrenAeris/crud/pkg/audit"
+	"github.com/KarrenAeris/crud/pkg/logger"
+	"github.com/KarrenAeris/crud/pkg/store"
+	"github.com/KarrenAeris/crud/pkg/types"
+	"github.com/KarrenAeris/crud/pkg/utils"
+)
+
+const (
+	//LastSeenInterval - как часто обновляется время последнего использования сессии
+	LastSeenInterval = time.Minute
+
+	//MaxUserAgentLength - сколько символов User-Agent сохраняется
+	MaxUserAgentLength = 512
+)
+
+type contextKey struct {
+	name string
+}
+
+func (c *contextKey) String() string {
+	return c.name
+}
+
+var deviceContextKey = &contextKey{"device context"}
+
+//WithDevice кладёт в контекст устройство, с которого выполняется запрос
+func WithDevice(ctx context.Context, device types.Device) context.Context {
+	if len(device.UserAgent) > MaxUserAgentLength {
+		device.UserAgent = device.UserAgent[:MaxUserAgentLength]
+	}
+	return context.WithValue(ctx, deviceContextKey, device)
+}
+
+//DeviceFrom возвращает устройство, с которого выполняется запрос; без него - пустое
+func DeviceFrom(ctx context.Context) types.Device {
+	device, _ := ctx.Value(deviceContextKey).(types.Device)
+	return device
+}
+
+//Touch отмечает использование сессии с токеном tokenHash. Без отметки токен всё равно работает,
+//поэтому ошибка только логируется
+func Touch(ctx context.Context, st store.Sessions, userType, tokenHash string) {
+	now := time.Now().UTC()
+	if err := st.TouchSession(ctx, userType, tokenHash, DeviceFrom(ctx), now, now.Add(-LastSeenInterval)); err != nil {
+		logger.Error(ctx, err)
+	}
+}
+
+//Service описывает сервис сессий - входов покупателей и продавцов (токенов из БД).
+//В режиме подписанных токенов сессия - токен обновления: после отзыва сессии уже выданный
+//токен доступа действует до своего истечения, но обновить его нельзя
+type Service struct {
+	store    store.Store
+	auditSvc *audit.Service
+}
+
+//NewService ...
+func NewService(st store.Store, auditSvc *audit.Service) *Service {
+	return &Service{store: st, auditSvc: auditSvc}
+}
+
+//All возвращает сессии пользователя. Сессия с токеном token отмечается как текущая.
+//userType - types.UserCustomer или types.UserManager
+func (s *Service) All(ctx context.Context, userType string, userID int64, token string) ([]*types.Session, error) {
+	items, err := s.store.Sessions(ctx, userType, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if token == "" {
+		return items, nil
+	}
+	current, err := s.store.SessionByToken(ctx, userType, utils.HashToken(token))
+	if err == types.ErrNotFound {
+		return items, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		item.Current = item.ID == current.ID
+	}
+	return items, nil
+}
+
+//Revoke завершает сессию пользователя: её токен больше не принимается.
+//Чужая или неизвестная сессия - types.ErrNotFound
+func (s *Service) Revoke(ctx context.Context, userType string, userID, id int64) (*types.Session, error) {
+	item, err := s.store.RevokeSession(ctx, userType, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.auditSvc.Record(ctx, "delete", userType+"_session", id, item, nil)
+	return item, nil
+}
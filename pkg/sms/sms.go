@@ -0,0 +1,74 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/KarrenAeris/crud/pkg/logger"
+)
+
+// Куда отправляются сообщения
+const (
+	SenderLog  = "log"
+	SenderFile = "file"
+)
+
+//Sender отправляет SMS. Реализацию для шлюза оператора достаточно подставить вместо LogSender
+type Sender interface {
+	Send(ctx context.Context, phone, text string) error
+}
+
+//New создаёт отправителя по названию: log - в лог сервиса, file - дописывает сообщения в файл path
+func New(kind, path string) (Sender, error) {
+	switch kind {
+	case SenderLog, "":
+		return LogSender{}, nil
+	case SenderFile:
+		if path == "" {
+			return nil, fmt.Errorf("sms file path is empty")
+		}
+		return NewFileSender(path), nil
+	default:
+		return nil, fmt.Errorf("unknown sms sender %q", kind)
+	}
+}
+
+//LogSender пишет сообщения в лог вместо отправки, для локальной разработки
+type LogSender struct{}
+
+//Send ...
+func (LogSender) Send(ctx context.Context, phone, text string) error {
+	logger.Info(ctx, "sms", "phone", phone, "text", text)
+	return nil
+}
+
+//FileSender дописывает сообщения в файл по строке на сообщение, для локальной разработки
+type FileSender struct {
+	mu   sync.Mutex
+	path string
+}
+
+//NewFileSender создаёт отправителя в файл path
+func NewFileSender(path string) *FileSender {
+	return &FileSender{path: path}
+}
+
+//Send ...
+func (s *FileSender) Send(ctx context.Context, phone, text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(file, "%s\t%s\t%s\n", time.Now().UTC().Format(time.RFC3339), phone, text)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
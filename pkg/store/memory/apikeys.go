@@ -0,0 +1,119 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/KarrenAeris/crud/pkg/types"
+)
+
+type apiKey struct {
+	types.APIKey
+	hash string
+}
+
+//CreateAPIKey ...
+func (s *Store) CreateAPIKey(ctx context.Context, key *types.APIKey, keyHash string) (*types.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.managers[key.ManagerID]; !ok {
+		return nil, types.ErrInternal
+	}
+	for _, stored := range s.apiKeys {
+		if stored.hash == keyHash {
+			return nil, types.ErrInternal
+		}
+	}
+
+	stored := &apiKey{APIKey: *key, hash: keyHash}
+	stored.ID = s.nextID()
+	stored.Scopes = append([]string(nil), key.Scopes...)
+	stored.LastUsed, stored.Revoked = nil, nil
+	stored.Created = now()
+	s.apiKeys[stored.ID] = stored
+	return copyAPIKey(stored), nil
+}
+
+//APIKeys ...
+func (s *Store) APIKeys(ctx context.Context) ([]*types.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := make([]*types.APIKey, 0, len(s.apiKeys))
+	for _, stored := range s.apiKeys {
+		items = append(items, copyAPIKey(stored))
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID > items[j].ID })
+	return items, nil
+}
+
+//APIKeyByID ...
+func (s *Store) APIKeyByID(ctx context.Context, id int64) (*types.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.apiKeys[id]
+	if !ok {
+		return nil, types.ErrNotFound
+	}
+	return copyAPIKey(stored), nil
+}
+
+//APIKeyByHash ...
+func (s *Store) APIKeyByHash(ctx context.Context, keyHash string) (*types.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, stored := range s.apiKeys {
+		if stored.hash == keyHash {
+			return copyAPIKey(stored), nil
+		}
+	}
+	return nil, types.ErrNotFound
+}
+
+//TouchAPIKey ...
+func (s *Store) TouchAPIKey(ctx context.Context, id int64, at, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.apiKeys[id]
+	if ok && (stored.LastUsed == nil || stored.LastUsed.Before(before)) {
+		at = at.UTC()
+		stored.LastUsed = &at
+	}
+	return nil
+}
+
+//RevokeAPIKey ...
+func (s *Store) RevokeAPIKey(ctx context.Context, id int64) (*types.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.apiKeys[id]
+	if !ok {
+		return nil, types.ErrNotFound
+	}
+	if stored.Revoked == nil {
+		revoked := now()
+		stored.Revoked = &revoked
+	}
+	return copyAPIKey(stored), nil
+}
+
+// copyAPIKey возвращает копию ключа, которую можно отдать наружу
+func copyAPIKey(stored *apiKey) *types.APIKey {
+	item := stored.APIKey
+	item.Scopes = append([]string(nil), stored.Scopes...)
+	if stored.LastUsed != nil {
+		lastUsed := *stored.LastUsed
+		item.LastUsed = &lastUsed
+	}
+	if stored.Revoked != nil {
+		revoked := *stored.Revoked
+		item.Revoked = &revoked
+	}
+	return &item
+}
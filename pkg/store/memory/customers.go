@@ -0,0 +1,142 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/KarrenAeris/crud/pkg/types"
+)
+
+//Customers ...
+func (s *Store) Customers(ctx context.Context, activeOnly bool) ([]*types.Customer, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := make([]*types.Customer, 0)
+	for _, item := range s.customers {
+		if activeOnly && !item.Active {
+			continue
+		}
+		customer := item.Customer
+		items = append(items, &customer)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+
+	return items, nil
+}
+
+//CustomerByID ...
+func (s *Store) CustomerByID(ctx context.Context, id int64) (*types.Customer, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	item, ok := s.customers[id]
+	if !ok {
+		return nil, types.ErrNotFound
+	}
+	customer := item.Customer
+	return &customer, nil
+}
+
+//CustomerCredentials ...
+func (s *Store) CustomerCredentials(ctx context.Context, phone string) (int64, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, item := range s.customers {
+		if item.Phone == phone {
+			return item.ID, item.password, nil
+		}
+	}
+	return 0, "", types.ErrNotFound
+}
+
+//SaveCustomer ...
+func (s *Store) SaveCustomer(ctx context.Context, item *types.Customer, passwordHash string) (*types.Customer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.customerPhoneTaken(item.Phone, item.ID) {
+		return nil, types.ErrInternal
+	}
+
+	if item.ID == 0 {
+		stored := &customer{
+			Customer: types.Customer{ID: s.nextID(), Name: item.Name, Phone: item.Phone, Active: true, Created: now()},
+			password: passwordHash,
+		}
+		s.customers[stored.ID] = stored
+		result := stored.Customer
+		return &result, nil
+	}
+
+	stored, ok := s.customers[item.ID]
+	if !ok {
+		return nil, types.ErrNotFound
+	}
+	stored.Verified = stored.Verified && stored.Phone == item.Phone
+	stored.Name, stored.Phone, stored.password = item.Name, item.Phone, passwordHash
+	result := stored.Customer
+	return &result, nil
+}
+
+//UpdateCustomer ...
+func (s *Store) UpdateCustomer(ctx context.Context, item *types.Customer) (*types.Customer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.customers[item.ID]
+	if !ok {
+		return nil, types.ErrNotFound
+	}
+	if s.customerPhoneTaken(item.Phone, item.ID) {
+		return nil, types.ErrInternal
+	}
+	stored.Verified = stored.Verified && stored.Phone == item.Phone
+	stored.Name, stored.Phone, stored.Active = item.Name, item.Phone, item.Active
+	result := stored.Customer
+	return &result, nil
+}
+
+//SetCustomerActive ...
+func (s *Store) SetCustomerActive(ctx context.Context, id int64, active bool) (*types.Customer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.customers[id]
+	if !ok {
+		return nil, types.ErrNotFound
+	}
+	stored.Active = active
+	result := stored.Customer
+	return &result, nil
+}
+
+//RemoveCustomer ...
+func (s *Store) RemoveCustomer(ctx context.Context, id int64) (*types.Customer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.customers[id]
+	if !ok {
+		return nil, types.ErrNotFound
+	}
+	delete(s.customers, id)
+	for token, session := range s.customerTokens {
+		if session.UserID == id {
+			delete(s.customerTokens, token)
+		}
+	}
+	result := stored.Customer
+	return &result, nil
+}
+
+// customerPhoneTaken повторяет ограничение UNIQUE на телефон; вызывается под блокировкой
+func (s *Store) customerPhoneTaken(phone string, exceptID int64) bool {
+	for _, item := range s.customers {
+		if item.Phone == phone && item.ID != exceptID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,177 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/KarrenAeris/crud/pkg/types"
+)
+
+//CreateManager ...
+func (s *Store) CreateManager(ctx context.Context, item *types.Manager) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, stored := range s.managers {
+		if stored.Phone == item.Phone {
+			return 0, types.ErrPhoneUsed
+		}
+	}
+
+	stored := &manager{Manager: *item, password: item.Password}
+	stored.ID = s.nextID()
+	stored.Password = ""
+	stored.Verified = false
+	stored.Created = now()
+	s.managers[stored.ID] = stored
+
+	return stored.ID, nil
+}
+
+//ManagerByID ...
+func (s *Store) ManagerByID(ctx context.Context, id int64) (*types.Manager, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.managers[id]
+	if !ok {
+		return nil, types.ErrNotFound
+	}
+	result := stored.Manager
+	return &result, nil
+}
+
+//ManagerCredentials ...
+func (s *Store) ManagerCredentials(ctx context.Context, phone string) (int64, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, stored := range s.managers {
+		if stored.Phone == phone {
+			return stored.ID, stored.password, nil
+		}
+	}
+	return 0, "", types.ErrNotFound
+}
+
+//SetManagerPassword задаёт bcrypt хеш пароля продавца. В Postgres пароль заводится вне API
+func (s *Store) SetManagerPassword(id int64, passwordHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.managers[id]
+	if !ok {
+		return types.ErrNotFound
+	}
+	stored.password = passwordHash
+	return nil
+}
+
+//IsAdmin ...
+func (s *Store) IsAdmin(ctx context.Context, id int64) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.managers[id]
+	if !ok {
+		return false, types.ErrNotFound
+	}
+	return stored.IsAdmin, nil
+}
+
+//SetBoss ...
+func (s *Store) SetBoss(ctx context.Context, id, bossID int64, departament string) (*types.Manager, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.managers[id]
+	if !ok {
+		return nil, types.ErrNotFound
+	}
+	if _, ok = s.managers[bossID]; bossID != 0 && !ok {
+		// в Postgres это нарушение внешнего ключа
+		return nil, types.ErrInternal
+	}
+	stored.BossID, stored.Departament = bossID, departament
+	result := stored.Manager
+	return &result, nil
+}
+
+//Subtree ...
+func (s *Store) Subtree(ctx context.Context, id int64) ([]int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := make([]int64, 0)
+	if _, ok := s.managers[id]; !ok {
+		return ids, nil
+	}
+
+	seen := map[int64]bool{id: true}
+	queue := []int64{id}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		ids = append(ids, current)
+		for _, stored := range s.managers {
+			if stored.BossID == current && !seen[stored.ID] {
+				seen[stored.ID] = true
+				queue = append(queue, stored.ID)
+			}
+		}
+	}
+
+	return ids, nil
+}
+
+//TeamMembers ...
+func (s *Store) TeamMembers(ctx context.Context, rootID int64) ([]*types.TeamNode, error) {
+
+	var ids []int64
+	if rootID != 0 {
+		var err error
+		if ids, err = s.Subtree(ctx, rootID); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if rootID == 0 {
+		// без корня - все, кто достижим от продавцов без руководителя
+		seen := make(map[int64]bool)
+		for _, stored := range s.managers {
+			if stored.BossID == 0 {
+				seen[stored.ID] = true
+			}
+		}
+		for grown := true; grown; {
+			grown = false
+			for _, stored := range s.managers {
+				if !seen[stored.ID] && seen[stored.BossID] {
+					seen[stored.ID] = true
+					grown = true
+				}
+			}
+		}
+		for id := range seen {
+			ids = append(ids, id)
+		}
+	}
+
+	items := make([]*types.TeamNode, 0, len(ids))
+	for _, id := range ids {
+		stored := s.managers[id]
+		items = append(items, &types.TeamNode{
+			ID:          stored.ID,
+			Name:        stored.Name,
+			BossID:      stored.BossID,
+			Departament: stored.Departament,
+			Children:    make([]*types.TeamNode, 0),
+		})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+
+	return items, nil
+}
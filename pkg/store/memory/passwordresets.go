@@ -0,0 +1,82 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/KarrenAeris/crud/pkg/types"
+)
+
+//SavePasswordReset ...
+func (s *Store) SavePasswordReset(ctx context.Context, reset *types.PasswordReset) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *reset
+	stored.Attempts = 0
+	stored.Created = now()
+	s.passwordResets[phoneCodeKey{reset.UserType, reset.UserID}] = &stored
+	return nil
+}
+
+//PasswordReset ...
+func (s *Store) PasswordReset(ctx context.Context, userType string, userID int64) (*types.PasswordReset, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.passwordResets[phoneCodeKey{userType, userID}]
+	if !ok {
+		return nil, types.ErrNotFound
+	}
+	result := *stored
+	return &result, nil
+}
+
+//ClaimPasswordReset ...
+func (s *Store) ClaimPasswordReset(ctx context.Context, userType string, userID int64, maxAttempts int) (*types.PasswordReset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.passwordResets[phoneCodeKey{userType, userID}]
+	if !ok || stored.Attempts >= maxAttempts || !stored.Expire.After(now()) {
+		return nil, types.ErrNotFound
+	}
+	stored.Attempts++
+	result := *stored
+	return &result, nil
+}
+
+//ResetPassword ...
+func (s *Store) ResetPassword(ctx context.Context, userType string, userID int64, codeHash, passwordHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := phoneCodeKey{userType, userID}
+	if reset, ok := s.passwordResets[key]; !ok || reset.Hash != codeHash {
+		return types.ErrNotFound
+	}
+
+	tokens := s.customerTokens
+	switch userType {
+	case types.UserManager:
+		stored, ok := s.managers[userID]
+		if !ok {
+			return types.ErrNotFound
+		}
+		stored.password = passwordHash
+		tokens = s.managerTokens
+	default:
+		stored, ok := s.customers[userID]
+		if !ok {
+			return types.ErrNotFound
+		}
+		stored.password = passwordHash
+	}
+
+	for token, session := range tokens {
+		if session.UserID == userID {
+			delete(tokens, token)
+		}
+	}
+	delete(s.passwordResets, key)
+	return nil
+}
@@ -0,0 +1,81 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/KarrenAeris/crud/pkg/types"
+)
+
+// phoneCodeKey - ключ кодов подтверждения телефона и сброса пароля
+type phoneCodeKey struct {
+	userType string
+	userID   int64
+}
+
+//SavePhoneCode ...
+func (s *Store) SavePhoneCode(ctx context.Context, code *types.PhoneCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *code
+	stored.Attempts = 0
+	stored.Created = now()
+	s.phoneCodes[phoneCodeKey{code.UserType, code.UserID}] = &stored
+	return nil
+}
+
+//PhoneCode ...
+func (s *Store) PhoneCode(ctx context.Context, userType string, userID int64) (*types.PhoneCode, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.phoneCodes[phoneCodeKey{userType, userID}]
+	if !ok {
+		return nil, types.ErrNotFound
+	}
+	result := *stored
+	return &result, nil
+}
+
+//ClaimPhoneCode ...
+func (s *Store) ClaimPhoneCode(ctx context.Context, userType string, userID int64, maxAttempts int) (*types.PhoneCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.phoneCodes[phoneCodeKey{userType, userID}]
+	if !ok || stored.Attempts >= maxAttempts || !stored.Expire.After(now()) {
+		return nil, types.ErrNotFound
+	}
+	stored.Attempts++
+	result := *stored
+	return &result, nil
+}
+
+//ConfirmPhone ...
+func (s *Store) ConfirmPhone(ctx context.Context, userType string, userID int64, phone, codeHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := phoneCodeKey{userType, userID}
+	if code, ok := s.phoneCodes[key]; !ok || code.Hash != codeHash {
+		return types.ErrNotFound
+	}
+
+	switch userType {
+	case types.UserManager:
+		stored, ok := s.managers[userID]
+		if !ok || stored.Phone != phone {
+			return types.ErrNotFound
+		}
+		stored.Verified = true
+	default:
+		stored, ok := s.customers[userID]
+		if !ok || stored.Phone != phone {
+			return types.ErrNotFound
+		}
+		stored.Verified = true
+	}
+
+	delete(s.phoneCodes, key)
+	return nil
+}
@@ -0,0 +1,76 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/KarrenAeris/crud/pkg/types"
+)
+
+//Products ...
+func (s *Store) Products(ctx context.Context) ([]*types.Product, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := make([]*types.Product, 0)
+	for _, stored := range s.products {
+		if !stored.Active {
+			continue
+		}
+		item := *stored
+		item.Available = item.Qty
+		items = append(items, &item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+
+	return items, nil
+}
+
+//ProductByID ...
+func (s *Store) ProductByID(ctx context.Context, id int64) (*types.Product, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.products[id]
+	if !ok {
+		return nil, types.ErrNotFound
+	}
+	item := *stored
+	return &item, nil
+}
+
+//SaveProduct ...
+func (s *Store) SaveProduct(ctx context.Context, product *types.Product) (*types.Product, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// повторяем ограничения CHECK из схемы
+	if product.Price <= 0 || product.Qty < 0 {
+		return nil, types.ErrInternal
+	}
+
+	stored, ok := s.products[product.ID]
+	if product.ID == 0 {
+		stored = &types.Product{ID: s.nextID(), Active: true, Created: now()}
+		s.products[stored.ID] = stored
+	} else if !ok {
+		return nil, types.ErrNotFound
+	}
+	stored.Name, stored.Qty, stored.Price, stored.Category = product.Name, product.Qty, product.Price, product.Category
+
+	*product = *stored
+	product.Available = 0
+	return product, nil
+}
+
+//RemoveProduct ...
+func (s *Store) RemoveProduct(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.products[id]; !ok {
+		return types.ErrNotFound
+	}
+	delete(s.products, id)
+	return nil
+}
@@ -0,0 +1,102 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/KarrenAeris/crud/pkg/types"
+)
+
+//CreateSale ...
+func (s *Store) CreateSale(ctx context.Context, sale *types.Sale) (*types.Sale, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.managers[sale.ManagerID]; !ok {
+		return nil, types.ErrInternal
+	}
+
+	// сначала проверяем все позиции, чтобы продажа сохранилась целиком или никак
+	need := make(map[int64]int)
+	for _, position := range sale.Positions {
+		product, ok := s.products[position.ProductID]
+		need[position.ProductID] += position.Qty
+		if !ok || !product.Active || position.Qty <= 0 || product.Qty < need[position.ProductID] {
+			return nil, types.ErrInvalidPosition
+		}
+	}
+
+	sale.ID = s.nextID()
+	sale.Created = now()
+	stored := &types.Sale{ID: sale.ID, ManagerID: sale.ManagerID, CustomerID: sale.CustomerID, Created: sale.Created}
+	for _, position := range sale.Positions {
+		s.products[position.ProductID].Qty -= position.Qty
+
+		position.ID = s.nextID()
+		position.SaleID = sale.ID
+		position.Created = sale.Created
+		item := *position
+		stored.Positions = append(stored.Positions, &item)
+	}
+	s.sales[sale.ID] = stored
+
+	return sale, nil
+}
+
+//SalesTotal ...
+func (s *Store) SalesTotal(ctx context.Context, managerID int64) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sum := 0
+	for _, sale := range s.sales {
+		if sale.ManagerID != managerID {
+			continue
+		}
+		for _, position := range sale.Positions {
+			sum += position.Qty * position.Price
+		}
+	}
+	return sum, nil
+}
+
+//TeamSales ...
+func (s *Store) TeamSales(ctx context.Context, ids []int64) ([]*types.TeamSales, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := make([]*types.TeamSales, 0)
+	for _, id := range sortedIDs(ids) {
+		stored, ok := s.managers[id]
+		if !ok {
+			continue
+		}
+		item := &types.TeamSales{ManagerID: stored.ID, Name: stored.Name, BossID: stored.BossID}
+		for _, sale := range s.sales {
+			if sale.ManagerID != id {
+				continue
+			}
+			item.Sales++
+			for _, position := range sale.Positions {
+				item.Total += int64(position.Qty * position.Price)
+			}
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// sortedIDs возвращает отсортированные id без повторов
+func sortedIDs(ids []int64) []int64 {
+	seen := make(map[int64]bool)
+	result := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
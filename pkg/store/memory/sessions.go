@@ -0,0 +1,99 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/KarrenAeris/crud/pkg/types"
+)
+
+//Sessions ...
+func (s *Store) Sessions(ctx context.Context, userType string, userID int64) ([]*types.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := make([]*types.Session, 0)
+	for _, stored := range s.sessionTokens(userType) {
+		if stored.UserID == userID && stored.Expire.After(now()) {
+			result := *stored
+			items = append(items, &result)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].LastSeen.Equal(items[j].LastSeen) {
+			return items[i].LastSeen.After(items[j].LastSeen)
+		}
+		return items[i].ID > items[j].ID
+	})
+	return items, nil
+}
+
+//SessionByToken ...
+func (s *Store) SessionByToken(ctx context.Context, userType string, tokenHash string) (*types.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.sessionTokens(userType)[tokenHash]
+	if !ok {
+		return nil, types.ErrNotFound
+	}
+	result := *stored
+	return &result, nil
+}
+
+//TouchSession ...
+func (s *Store) TouchSession(ctx context.Context, userType string, tokenHash string, device types.Device, at, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.sessionTokens(userType)[tokenHash]
+	if !ok || !stored.LastSeen.Before(before) {
+		return nil
+	}
+	stored.LastSeen = at.UTC()
+	stored.UserAgent = device.UserAgent
+	stored.IP = device.IP
+	return nil
+}
+
+//RevokeSession ...
+func (s *Store) RevokeSession(ctx context.Context, userType string, userID, id int64) (*types.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens := s.sessionTokens(userType)
+	for hash, stored := range tokens {
+		if stored.ID == id && stored.UserID == userID {
+			delete(tokens, hash)
+			result := *stored
+			return &result, nil
+		}
+	}
+	return nil, types.ErrNotFound
+}
+
+//RotateSession ...
+func (s *Store) RotateSession(ctx context.Context, userType string, tokenHash, newHash string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens := s.sessionTokens(userType)
+	stored, ok := tokens[tokenHash]
+	current := now()
+	if !ok || !stored.Expire.After(current) {
+		return 0, types.ErrNotFound
+	}
+	delete(tokens, tokenHash)
+	stored.Expire = current.Add(types.TokenTTL)
+	tokens[newHash] = stored
+	return stored.UserID, nil
+}
+
+// sessionTokens возвращает токены пользователей типа userType; вызывается под блокировкой
+func (s *Store) sessionTokens(userType string) map[string]*types.Session {
+	if userType == types.UserManager {
+		return s.managerTokens
+	}
+	return s.customerTokens
+}
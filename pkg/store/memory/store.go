@@ -0,0 +1,76 @@
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/KarrenAeris/crud/pkg/store"
+	"github.com/KarrenAeris/crud/pkg/types"
+)
+
+var _ store.Store = (*Store)(nil)
+
+//Store реализует store.Store в памяти процесса, например для тестов.
+//Безопасен для параллельного использования; наружу отдаются копии записей.
+//Резервов в памяти нет, поэтому весь остаток товара доступен для продажи
+type Store struct {
+	mu sync.RWMutex
+
+	lastID    int64
+	customers map[int64]*customer
+	managers  map[int64]*manager
+	products  map[int64]*types.Product
+	sales     map[int64]*types.Sale
+
+	customerTokens map[string]*types.Session
+	managerTokens  map[string]*types.Session
+
+	phoneCodes     map[phoneCodeKey]*types.PhoneCode
+	passwordResets map[phoneCodeKey]*types.PasswordReset
+
+	apiKeys map[int64]*apiKey
+
+	totp             map[int64]*types.TOTP
+	recoveryCodes    map[int64]map[string]bool
+	loginChallenges  map[string]*types.LoginChallenge
+	requireAdminTOTP bool
+}
+
+type customer struct {
+	types.Customer
+	password string
+}
+
+type manager struct {
+	types.Manager
+	password string
+}
+
+//NewStore создаёт пустое хранилище.
+func NewStore() *Store {
+	return &Store{
+		customers:      make(map[int64]*customer),
+		managers:       make(map[int64]*manager),
+		products:       make(map[int64]*types.Product),
+		sales:          make(map[int64]*types.Sale),
+		customerTokens: make(map[string]*types.Session),
+		managerTokens:  make(map[string]*types.Session),
+		phoneCodes:     make(map[phoneCodeKey]*types.PhoneCode),
+		passwordResets: make(map[phoneCodeKey]*types.PasswordReset),
+		apiKeys:        make(map[int64]*apiKey),
+
+		totp:            make(map[int64]*types.TOTP),
+		recoveryCodes:   make(map[int64]map[string]bool),
+		loginChallenges: make(map[string]*types.LoginChallenge),
+	}
+}
+
+// nextID выдаёт id, как BIGSERIAL; вызывается под блокировкой на запись
+func (s *Store) nextID() int64 {
+	s.lastID++
+	return s.lastID
+}
+
+func now() time.Time {
+	return time.Now().UTC()
+}
@@ -0,0 +1,69 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/KarrenAeris/crud/pkg/types"
+)
+
+//SaveCustomerToken ...
+func (s *Store) SaveCustomerToken(ctx context.Context, tokenHash string, customerID int64, device types.Device) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.customers[customerID]; !ok {
+		return types.ErrInternal
+	}
+	s.customerTokens[tokenHash] = s.newSession(customerID, device)
+	return nil
+}
+
+//CustomerIDByToken ...
+func (s *Store) CustomerIDByToken(ctx context.Context, tokenHash string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.customerTokens[tokenHash]
+	if !ok || !session.Expire.After(now()) {
+		return 0, types.ErrNotFound
+	}
+	return session.UserID, nil
+}
+
+//SaveManagerToken ...
+func (s *Store) SaveManagerToken(ctx context.Context, tokenHash string, managerID int64, device types.Device) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.managers[managerID]; !ok {
+		return types.ErrInternal
+	}
+	s.managerTokens[tokenHash] = s.newSession(managerID, device)
+	return nil
+}
+
+//ManagerIDByToken ...
+func (s *Store) ManagerIDByToken(ctx context.Context, tokenHash string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.managerTokens[tokenHash]
+	if !ok || !session.Expire.After(now()) {
+		return 0, types.ErrNotFound
+	}
+	return session.UserID, nil
+}
+
+// newSession создаёт сессию; вызывается под блокировкой
+func (s *Store) newSession(userID int64, device types.Device) *types.Session {
+	created := now()
+	return &types.Session{
+		ID:        s.nextID(),
+		UserID:    userID,
+		UserAgent: device.UserAgent,
+		IP:        device.IP,
+		LastSeen:  created,
+		Created:   created,
+		Expire:    created.Add(types.TokenTTL),
+	}
+}
@@ -0,0 +1,165 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/KarrenAeris/crud/pkg/types"
+)
+
+//TOTP ...
+func (s *Store) TOTP(ctx context.Context, managerID int64) (*types.TOTP, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.totp[managerID]
+	if !ok {
+		return nil, types.ErrNotFound
+	}
+	result := *stored
+	return &result, nil
+}
+
+//SaveTOTPSecret ...
+func (s *Store) SaveTOTPSecret(ctx context.Context, managerID int64, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.managers[managerID]; !ok {
+		return types.ErrInternal
+	}
+	if stored, ok := s.totp[managerID]; ok && stored.Enabled {
+		return types.ErrTwoFactorEnabled
+	}
+	s.totp[managerID] = &types.TOTP{ManagerID: managerID, Secret: secret, Created: now()}
+	return nil
+}
+
+//EnableTOTP ...
+func (s *Store) EnableTOTP(ctx context.Context, managerID int64, step int64, recoveryHashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.totp[managerID]
+	if !ok || stored.Enabled {
+		return types.ErrNotFound
+	}
+	stored.Enabled = true
+	stored.LastStep = step
+
+	codes := make(map[string]bool, len(recoveryHashes))
+	for _, hash := range recoveryHashes {
+		codes[hash] = true
+	}
+	s.recoveryCodes[managerID] = codes
+	return nil
+}
+
+//UseTOTPStep ...
+func (s *Store) UseTOTPStep(ctx context.Context, managerID int64, step int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.totp[managerID]
+	if !ok || !stored.Enabled || stored.LastStep >= step {
+		return false, nil
+	}
+	stored.LastStep = step
+	return true, nil
+}
+
+//UseRecoveryCode ...
+func (s *Store) UseRecoveryCode(ctx context.Context, managerID int64, codeHash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.recoveryCodes[managerID][codeHash] {
+		return false, nil
+	}
+	delete(s.recoveryCodes[managerID], codeHash)
+	return true, nil
+}
+
+//DisableTOTP ...
+func (s *Store) DisableTOTP(ctx context.Context, managerID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.totp, managerID)
+	delete(s.recoveryCodes, managerID)
+	for hash, challenge := range s.loginChallenges {
+		if challenge.ManagerID == managerID {
+			delete(s.loginChallenges, hash)
+		}
+	}
+	return nil
+}
+
+//SaveLoginChallenge ...
+func (s *Store) SaveLoginChallenge(ctx context.Context, challenge *types.LoginChallenge) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := now()
+	for hash, stored := range s.loginChallenges {
+		if stored.Expire.Before(current) {
+			delete(s.loginChallenges, hash)
+		}
+	}
+
+	stored := *challenge
+	stored.Attempts = 0
+	s.loginChallenges[challenge.Hash] = &stored
+	return nil
+}
+
+//LoginChallenge ...
+func (s *Store) LoginChallenge(ctx context.Context, hash string) (*types.LoginChallenge, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.loginChallenges[hash]
+	if !ok {
+		return nil, types.ErrNotFound
+	}
+	result := *stored
+	return &result, nil
+}
+
+//AddLoginChallengeAttempt ...
+func (s *Store) AddLoginChallengeAttempt(ctx context.Context, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.loginChallenges[hash]
+	if !ok {
+		return types.ErrNotFound
+	}
+	stored.Attempts++
+	return nil
+}
+
+//DeleteLoginChallenge ...
+func (s *Store) DeleteLoginChallenge(ctx context.Context, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.loginChallenges, hash)
+	return nil
+}
+
+//RequireAdminTOTP ...
+func (s *Store) RequireAdminTOTP(ctx context.Context) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.requireAdminTOTP, nil
+}
+
+//SetRequireAdminTOTP ...
+func (s *Store) SetRequireAdminTOTP(ctx context.Context, required bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requireAdminTOTP = required
+	return nil
+}
@@ -0,0 +1,92 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/KarrenAeris/crud/pkg/logger"
+	"github.com/KarrenAeris/crud/pkg/types"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const apiKeyColumns = `id, manager_id, name, prefix, scopes, expire, last_used, revoked, created`
+
+//CreateAPIKey ...
+func (s *Store) CreateAPIKey(ctx context.Context, key *types.APIKey, keyHash string) (*types.APIKey, error) {
+	sqlstmt := `
+	insert into api_keys(manager_id, name, prefix, key_hash, scopes, expire) values ($1, $2, $3, $4, $5, $6)
+	returning ` + apiKeyColumns
+	return s.apiKeyRow(ctx, sqlstmt, key.ManagerID, key.Name, key.Prefix, keyHash, key.Scopes, key.Expire)
+}
+
+//APIKeys ...
+func (s *Store) APIKeys(ctx context.Context) ([]*types.APIKey, error) {
+	rows, err := s.pool.Query(ctx, `select `+apiKeyColumns+` from api_keys order by id desc`)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	items := make([]*types.APIKey, 0)
+	for rows.Next() {
+		item := &types.APIKey{}
+		err = rows.Scan(&item.ID, &item.ManagerID, &item.Name, &item.Prefix, &item.Scopes,
+			&item.Expire, &item.LastUsed, &item.Revoked, &item.Created)
+		if err != nil {
+			logger.Error(ctx, err)
+			return nil, types.ErrInternal
+		}
+		items = append(items, item)
+	}
+	if err = rows.Err(); err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	return items, nil
+}
+
+//APIKeyByID ...
+func (s *Store) APIKeyByID(ctx context.Context, id int64) (*types.APIKey, error) {
+	return s.apiKeyRow(ctx, `select `+apiKeyColumns+` from api_keys where id = $1`, id)
+}
+
+//APIKeyByHash ...
+func (s *Store) APIKeyByHash(ctx context.Context, keyHash string) (*types.APIKey, error) {
+	return s.apiKeyRow(ctx, `select `+apiKeyColumns+` from api_keys where key_hash = $1`, keyHash)
+}
+
+//TouchAPIKey ...
+func (s *Store) TouchAPIKey(ctx context.Context, id int64, at, before time.Time) error {
+	// отметка обновляется не на каждый запрос, чтобы частые вызовы не писали в БД
+	sqlstmt := `update api_keys set last_used = $2 where id = $1 and (last_used is null or last_used < $3)`
+	if _, err := s.pool.Exec(ctx, sqlstmt, id, at, before); err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	return nil
+}
+
+//RevokeAPIKey ...
+func (s *Store) RevokeAPIKey(ctx context.Context, id int64) (*types.APIKey, error) {
+	sqlstmt := `
+	update api_keys set revoked = coalesce(revoked, CURRENT_TIMESTAMP) where id = $1
+	returning ` + apiKeyColumns
+	return s.apiKeyRow(ctx, sqlstmt, id)
+}
+
+func (s *Store) apiKeyRow(ctx context.Context, sqlstmt string, args ...interface{}) (*types.APIKey, error) {
+	item := &types.APIKey{}
+
+	err := s.pool.QueryRow(ctx, sqlstmt, args...).Scan(&item.ID, &item.ManagerID, &item.Name, &item.Prefix, &item.Scopes,
+		&item.Expire, &item.LastUsed, &item.Revoked, &item.Created)
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	return item, nil
+}
@@ -0,0 +1,107 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/KarrenAeris/crud/pkg/logger"
+	"github.com/KarrenAeris/crud/pkg/types"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const customerColumns = `id, name, phone, phone_verified, active, created`
+
+//Customers ...
+func (s *Store) Customers(ctx context.Context, activeOnly bool) ([]*types.Customer, error) {
+
+	items := make([]*types.Customer, 0)
+
+	sqlstmt := `select ` + customerColumns + ` from customers where active or not $1 order by id limit 500`
+	rows, err := s.pool.Query(ctx, sqlstmt, activeOnly)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &types.Customer{}
+		err = rows.Scan(&item.ID, &item.Name, &item.Phone, &item.Verified, &item.Active, &item.Created)
+		if err != nil {
+			logger.Error(ctx, err)
+			return nil, types.ErrInternal
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+//CustomerByID ...
+func (s *Store) CustomerByID(ctx context.Context, id int64) (*types.Customer, error) {
+	return s.customerRow(ctx, `select `+customerColumns+` from customers where id = $1`, id)
+}
+
+//CustomerCredentials ...
+func (s *Store) CustomerCredentials(ctx context.Context, phone string) (int64, string, error) {
+	var id int64
+	var hash string
+
+	err := s.pool.QueryRow(ctx, `select id, password from customers where phone = $1`, phone).Scan(&id, &hash)
+	if err == pgx.ErrNoRows {
+		return 0, "", types.ErrNotFound
+	}
+	if err != nil {
+		logger.Error(ctx, err)
+		return 0, "", types.ErrInternal
+	}
+	return id, hash, nil
+}
+
+//SaveCustomer ...
+func (s *Store) SaveCustomer(ctx context.Context, customer *types.Customer, passwordHash string) (*types.Customer, error) {
+	if customer.ID == 0 {
+		sqlstmt := `insert into customers(name, phone, password) values ($1, $2, $3) returning ` + customerColumns
+		return s.customerRow(ctx, sqlstmt, customer.Name, customer.Phone, passwordHash)
+	}
+
+	// phone_verified = ... видит старый телефон: подтверждение остаётся, только если телефон не менялся
+	sqlstmt := `
+	update customers set name = $1, phone = $2, password = $3, phone_verified = phone_verified and phone = $2
+	where id = $4 returning ` + customerColumns
+	return s.customerRow(ctx, sqlstmt, customer.Name, customer.Phone, passwordHash, customer.ID)
+}
+
+//UpdateCustomer ...
+func (s *Store) UpdateCustomer(ctx context.Context, customer *types.Customer) (*types.Customer, error) {
+	sqlstmt := `
+	update customers set name = $2, phone = $3, active = $4, phone_verified = phone_verified and phone = $3
+	where id = $1 returning ` + customerColumns
+	return s.customerRow(ctx, sqlstmt, customer.ID, customer.Name, customer.Phone, customer.Active)
+}
+
+//SetCustomerActive ...
+func (s *Store) SetCustomerActive(ctx context.Context, id int64, active bool) (*types.Customer, error) {
+	sqlstmt := `update customers set active = $2 where id = $1 returning ` + customerColumns
+	return s.customerRow(ctx, sqlstmt, id, active)
+}
+
+//RemoveCustomer ...
+func (s *Store) RemoveCustomer(ctx context.Context, id int64) (*types.Customer, error) {
+	return s.customerRow(ctx, `delete from customers where id = $1 returning `+customerColumns, id)
+}
+
+// customerRow выполняет запрос, возвращающий одного покупателя
+func (s *Store) customerRow(ctx context.Context, sqlstmt string, args ...interface{}) (*types.Customer, error) {
+	item := &types.Customer{}
+
+	err := s.pool.QueryRow(ctx, sqlstmt, args...).Scan(&item.ID, &item.Name, &item.Phone, &item.Verified, &item.Active, &item.Created)
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	return item, nil
+}
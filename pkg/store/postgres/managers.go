@@ -0,0 +1,154 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/KarrenAeris/crud/pkg/logger"
+	"github.com/KarrenAeris/crud/pkg/types"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const managerColumns = `id, name, phone, salary, plan, coalesce(boss_id, 0), coalesce(deparment, ''), is_admin, phone_verified, created`
+
+//CreateManager ...
+func (s *Store) CreateManager(ctx context.Context, manager *types.Manager) (int64, error) {
+	var id int64
+
+	sqlstmt := `insert into managers(name,phone,is_admin,salary,plan) values ($1,$2,$3,$4,$5) on conflict (phone) do nothing returning id;`
+	err := s.pool.QueryRow(ctx, sqlstmt, manager.Name, manager.Phone, manager.IsAdmin, manager.Salary, manager.Plan).Scan(&id)
+	// при занятом телефоне строка не вставляется и id не возвращается
+	if err == pgx.ErrNoRows {
+		return 0, types.ErrPhoneUsed
+	}
+	if err != nil {
+		logger.Error(ctx, err)
+		return 0, types.ErrInternal
+	}
+	return id, nil
+}
+
+//ManagerByID ...
+func (s *Store) ManagerByID(ctx context.Context, id int64) (*types.Manager, error) {
+	return s.managerRow(ctx, `select `+managerColumns+` from managers where id = $1`, id)
+}
+
+//ManagerCredentials ...
+func (s *Store) ManagerCredentials(ctx context.Context, phone string) (int64, string, error) {
+	var id int64
+	var hash string
+
+	err := s.pool.QueryRow(ctx, `select id, coalesce(password, '') from managers where phone = $1`, phone).Scan(&id, &hash)
+	if err == pgx.ErrNoRows {
+		return 0, "", types.ErrNotFound
+	}
+	if err != nil {
+		logger.Error(ctx, err)
+		return 0, "", types.ErrInternal
+	}
+	return id, hash, nil
+}
+
+//IsAdmin ...
+func (s *Store) IsAdmin(ctx context.Context, id int64) (bool, error) {
+	isAdmin := false
+
+	err := s.pool.QueryRow(ctx, `select is_admin from managers where id = $1`, id).Scan(&isAdmin)
+	if err == pgx.ErrNoRows {
+		return false, types.ErrNotFound
+	}
+	if err != nil {
+		logger.Error(ctx, err)
+		return false, types.ErrInternal
+	}
+	return isAdmin, nil
+}
+
+//SetBoss ...
+func (s *Store) SetBoss(ctx context.Context, id, bossID int64, departament string) (*types.Manager, error) {
+	sqlstmt := `
+	update managers set boss_id = nullif($2, 0), deparment = nullif($3, '') where id = $1
+	returning ` + managerColumns
+	return s.managerRow(ctx, sqlstmt, id, bossID, departament)
+}
+
+//Subtree ...
+func (s *Store) Subtree(ctx context.Context, id int64) ([]int64, error) {
+
+	ids := make([]int64, 0)
+
+	sqlstmt := `
+	with recursive team as (
+		select id from managers where id = $1
+		union
+		select m.id from managers m join team t on m.boss_id = t.id
+	)
+	select id from team`
+
+	rows, err := s.pool.Query(ctx, sqlstmt, id)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var memberID int64
+		if err = rows.Scan(&memberID); err != nil {
+			logger.Error(ctx, err)
+			return nil, types.ErrInternal
+		}
+		ids = append(ids, memberID)
+	}
+
+	return ids, nil
+}
+
+//TeamMembers ...
+func (s *Store) TeamMembers(ctx context.Context, rootID int64) ([]*types.TeamNode, error) {
+
+	items := make([]*types.TeamNode, 0)
+
+	sqlstmt := `
+	with recursive team as (
+		select id, name, boss_id, deparment from managers
+		where ($1 = 0 and boss_id is null) or id = $1
+		union
+		select m.id, m.name, m.boss_id, m.deparment from managers m join team t on m.boss_id = t.id
+	)
+	select id, name, coalesce(boss_id, 0), coalesce(deparment, '') from team order by id`
+
+	rows, err := s.pool.Query(ctx, sqlstmt, rootID)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &types.TeamNode{Children: make([]*types.TeamNode, 0)}
+		if err = rows.Scan(&item.ID, &item.Name, &item.BossID, &item.Departament); err != nil {
+			logger.Error(ctx, err)
+			return nil, types.ErrInternal
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// managerRow выполняет запрос, возвращающий одного продавца
+func (s *Store) managerRow(ctx context.Context, sqlstmt string, args ...interface{}) (*types.Manager, error) {
+	item := &types.Manager{}
+
+	err := s.pool.QueryRow(ctx, sqlstmt, args...).Scan(&item.ID, &item.Name, &item.Phone,
+		&item.Salary, &item.Plan, &item.BossID, &item.Departament, &item.IsAdmin, &item.Verified, &item.Created)
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	return item, nil
+}
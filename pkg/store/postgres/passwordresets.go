@@ -0,0 +1,111 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/KarrenAeris/crud/pkg/logger"
+	"github.com/KarrenAeris/crud/pkg/types"
+
+	"github.com/jackc/pgx/v4"
+)
+
+//SavePasswordReset ...
+func (s *Store) SavePasswordReset(ctx context.Context, reset *types.PasswordReset) error {
+	sqlstmt := `
+	insert into password_resets(user_type, user_id, phone, code_hash, expire) values ($1, $2, $3, $4, $5)
+	on conflict (user_type, user_id) do update
+	set phone = excluded.phone, code_hash = excluded.code_hash, attempts = 0, expire = excluded.expire, created = CURRENT_TIMESTAMP`
+
+	_, err := s.pool.Exec(ctx, sqlstmt, reset.UserType, reset.UserID, reset.Phone, reset.Hash, reset.Expire)
+	if err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	return nil
+}
+
+//PasswordReset ...
+func (s *Store) PasswordReset(ctx context.Context, userType string, userID int64) (*types.PasswordReset, error) {
+	item := &types.PasswordReset{UserType: userType, UserID: userID}
+
+	sqlstmt := `select phone, code_hash, attempts, expire, created from password_resets where user_type = $1 and user_id = $2`
+	err := s.pool.QueryRow(ctx, sqlstmt, userType, userID).Scan(&item.Phone, &item.Hash, &item.Attempts, &item.Expire, &item.Created)
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	return item, nil
+}
+
+//ClaimPasswordReset ...
+func (s *Store) ClaimPasswordReset(ctx context.Context, userType string, userID int64, maxAttempts int) (*types.PasswordReset, error) {
+	item := &types.PasswordReset{UserType: userType, UserID: userID}
+
+	// проверка и учёт попытки одним запросом, чтобы параллельные запросы не получили лишних попыток
+	sqlstmt := `
+	update password_resets set attempts = attempts + 1
+	where user_type = $1 and user_id = $2 and attempts < $3 and expire > now()
+	returning phone, code_hash, attempts, expire, created`
+	err := s.pool.QueryRow(ctx, sqlstmt, userType, userID, maxAttempts).
+		Scan(&item.Phone, &item.Hash, &item.Attempts, &item.Expire, &item.Created)
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	return item, nil
+}
+
+//ResetPassword ...
+func (s *Store) ResetPassword(ctx context.Context, userType string, userID int64, codeHash, passwordHash string) error {
+	// таблицы пользователя выбираются из списка, а не подставляются из аргумента
+	updatestmt := `update customers set password = $2 where id = $1`
+	deletestmt := `delete from customers_tokens where customer_id = $1`
+	if userType == types.UserManager {
+		updatestmt = `update managers set password = $2 where id = $1`
+		deletestmt = `delete from managers_tokens where manager_id = $1`
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	// код удаляется первым: из двух параллельных запросов с верным кодом пройдёт только один
+	sqlstmt := `delete from password_resets where user_type = $1 and user_id = $2 and code_hash = $3`
+	tag, err := tx.Exec(ctx, sqlstmt, userType, userID, codeHash)
+	if err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	if tag.RowsAffected() == 0 {
+		return types.ErrNotFound
+	}
+
+	tag, err = tx.Exec(ctx, updatestmt, userID, passwordHash)
+	if err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	if tag.RowsAffected() == 0 {
+		return types.ErrNotFound
+	}
+
+	if _, err = tx.Exec(ctx, deletestmt, userID); err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	return nil
+}
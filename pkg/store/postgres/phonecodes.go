@@ -0,0 +1,104 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/KarrenAeris/crud/pkg/logger"
+	"github.com/KarrenAeris/crud/pkg/types"
+
+	"github.com/jackc/pgx/v4"
+)
+
+//SavePhoneCode ...
+func (s *Store) SavePhoneCode(ctx context.Context, code *types.PhoneCode) error {
+	sqlstmt := `
+	insert into phone_codes(user_type, user_id, phone, code_hash, expire) values ($1, $2, $3, $4, $5)
+	on conflict (user_type, user_id) do update
+	set phone = excluded.phone, code_hash = excluded.code_hash, attempts = 0, expire = excluded.expire, created = CURRENT_TIMESTAMP`
+
+	_, err := s.pool.Exec(ctx, sqlstmt, code.UserType, code.UserID, code.Phone, code.Hash, code.Expire)
+	if err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	return nil
+}
+
+//PhoneCode ...
+func (s *Store) PhoneCode(ctx context.Context, userType string, userID int64) (*types.PhoneCode, error) {
+	item := &types.PhoneCode{UserType: userType, UserID: userID}
+
+	sqlstmt := `select phone, code_hash, attempts, expire, created from phone_codes where user_type = $1 and user_id = $2`
+	err := s.pool.QueryRow(ctx, sqlstmt, userType, userID).Scan(&item.Phone, &item.Hash, &item.Attempts, &item.Expire, &item.Created)
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	return item, nil
+}
+
+//ClaimPhoneCode ...
+func (s *Store) ClaimPhoneCode(ctx context.Context, userType string, userID int64, maxAttempts int) (*types.PhoneCode, error) {
+	item := &types.PhoneCode{UserType: userType, UserID: userID}
+
+	// проверка и учёт попытки одним запросом, чтобы параллельные запросы не получили лишних попыток
+	sqlstmt := `
+	update phone_codes set attempts = attempts + 1
+	where user_type = $1 and user_id = $2 and attempts < $3 and expire > now()
+	returning phone, code_hash, attempts, expire, created`
+	err := s.pool.QueryRow(ctx, sqlstmt, userType, userID, maxAttempts).
+		Scan(&item.Phone, &item.Hash, &item.Attempts, &item.Expire, &item.Created)
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	return item, nil
+}
+
+//ConfirmPhone ...
+func (s *Store) ConfirmPhone(ctx context.Context, userType string, userID int64, phone, codeHash string) error {
+	// таблица пользователя выбирается из списка, а не подставляется из аргумента
+	sqlstmt := `update customers set phone_verified = true where id = $1 and phone = $2`
+	if userType == types.UserManager {
+		sqlstmt = `update managers set phone_verified = true where id = $1 and phone = $2`
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	// код удаляется первым: из двух параллельных запросов с верным кодом пройдёт только один
+	deletestmt := `delete from phone_codes where user_type = $1 and user_id = $2 and code_hash = $3`
+	tag, err := tx.Exec(ctx, deletestmt, userType, userID, codeHash)
+	if err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	if tag.RowsAffected() == 0 {
+		return types.ErrNotFound
+	}
+
+	tag, err = tx.Exec(ctx, sqlstmt, userID, phone)
+	if err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	if tag.RowsAffected() == 0 {
+		return types.ErrNotFound
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	return nil
+}
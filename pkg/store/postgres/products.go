@@ -0,0 +1,95 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/KarrenAeris/crud/pkg/logger"
+	"github.com/KarrenAeris/crud/pkg/types"
+
+	"github.com/jackc/pgx/v4"
+)
+
+//Products ...
+func (s *Store) Products(ctx context.Context) ([]*types.Product, error) {
+
+	items := make([]*types.Product, 0)
+
+	sqlstmt := `
+	select p.id, p.name, p.price, p.qty,
+		p.qty - coalesce((select sum(r.qty) from reservations r where r.product_id = p.id and r.expire > now()), 0),
+		p.category, p.active, p.created
+	from products p where p.active = true order by p.id limit 500`
+	rows, err := s.pool.Query(ctx, sqlstmt)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &types.Product{}
+		err = rows.Scan(&item.ID, &item.Name, &item.Price, &item.Qty, &item.Available, &item.Category, &item.Active, &item.Created)
+		if err != nil {
+			logger.Error(ctx, err)
+			return nil, types.ErrInternal
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+//ProductByID ...
+func (s *Store) ProductByID(ctx context.Context, id int64) (*types.Product, error) {
+	item := &types.Product{}
+
+	sqlstmt := `select id, name, qty, price, category, active, created from products where id = $1`
+	err := s.pool.QueryRow(ctx, sqlstmt, id).
+		Scan(&item.ID, &item.Name, &item.Qty, &item.Price, &item.Category, &item.Active, &item.Created)
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	return item, nil
+}
+
+//SaveProduct ...
+func (s *Store) SaveProduct(ctx context.Context, product *types.Product) (*types.Product, error) {
+	var err error
+
+	if product.ID == 0 {
+		sqlstmt := `insert into products(name,qty,price,category) values ($1,$2,$3,$4) returning id,name,qty,price,category,active,created;`
+		err = s.pool.QueryRow(ctx, sqlstmt, product.Name, product.Qty, product.Price, product.Category).
+			Scan(&product.ID, &product.Name, &product.Qty, &product.Price, &product.Category, &product.Active, &product.Created)
+	} else {
+		sqlstmt := `update products set name=$1, qty=$2, price=$3, category=$4 where id = $5 returning id,name,qty,price,category,active,created;`
+		err = s.pool.QueryRow(ctx, sqlstmt, product.Name, product.Qty, product.Price, product.Category, product.ID).
+			Scan(&product.ID, &product.Name, &product.Qty, &product.Price, &product.Category, &product.Active, &product.Created)
+	}
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+
+	return product, nil
+}
+
+//RemoveProduct ...
+func (s *Store) RemoveProduct(ctx context.Context, id int64) error {
+
+	tag, err := s.pool.Exec(ctx, `delete from products where id = $1`, id)
+	if err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	if tag.RowsAffected() == 0 {
+		return types.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/KarrenAeris/crud/pkg/logger"
+	"github.com/KarrenAeris/crud/pkg/types"
+
+	"github.com/jackc/pgx/v4"
+)
+
+//CreateSale ...
+func (s *Store) CreateSale(ctx context.Context, sale *types.Sale) (*types.Sale, error) {
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	productIDs := make([]int64, 0, len(sale.Positions))
+	for _, position := range sale.Positions {
+		productIDs = append(productIDs, position.ProductID)
+	}
+
+	// черновик продавца (его резервы на эти товары) закрывается продажей
+	sqlstmt := `delete from reservations where manager_id = $1 and order_id is null and product_id = any($2)`
+	if _, err = tx.Exec(ctx, sqlstmt, sale.ManagerID, productIDs); err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+
+	// заказ подтверждается и его резерв снимается в той же транзакции: если продажа не пройдёт,
+	// заказ останется ожидающим, а товар - зарезервированным за ним
+	if sale.OrderID != 0 {
+		sqlstmt = `update orders set status = $3, manager_id = $2 where id = $1 and status = $4`
+		tag, err := tx.Exec(ctx, sqlstmt, sale.OrderID, sale.ManagerID, types.OrderConfirmed, types.OrderPending)
+		if err != nil {
+			logger.Error(ctx, err)
+			return nil, types.ErrInternal
+		}
+		// заказ уже подтвердил или отменил кто-то другой
+		if tag.RowsAffected() == 0 {
+			return nil, types.ErrOrderStatus
+		}
+
+		if _, err = tx.Exec(ctx, `delete from reservations where order_id = $1`, sale.OrderID); err != nil {
+			logger.Error(ctx, err)
+			return nil, types.ErrInternal
+		}
+	}
+
+	sqlstmt = `insert into sales(manager_id,customer_id) values ($1,$2) returning id, created;`
+	err = tx.QueryRow(ctx, sqlstmt, sale.ManagerID, sale.CustomerID).Scan(&sale.ID, &sale.Created)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+
+	if sale.OrderID != 0 {
+		if _, err = tx.Exec(ctx, `update orders set sale_id = $2 where id = $1`, sale.OrderID, sale.ID); err != nil {
+			logger.Error(ctx, err)
+			return nil, types.ErrInternal
+		}
+	}
+
+	for _, position := range sale.Positions {
+		if err = s.createSalePosition(ctx, tx, sale.ID, position); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	return sale, nil
+}
+
+// createSalePosition списывает товар позиции и сохраняет её
+func (s *Store) createSalePosition(ctx context.Context, tx pgx.Tx, saleID int64, position *types.SalePosition) error {
+	active := false
+	qty := 0
+	reserved := 0
+
+	// блокируем строку товара, чтобы параллельные продажи не списали один и тот же остаток
+	sqlstmt := `
+	select qty, active, coalesce((select sum(r.qty) from reservations r where r.product_id = p.id and r.expire > now()), 0)
+	from products p where id = $1 for update`
+	err := tx.QueryRow(ctx, sqlstmt, position.ProductID).Scan(&qty, &active, &reserved)
+	if err == pgx.ErrNoRows {
+		return types.ErrInvalidPosition
+	}
+	if err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+
+	// зарезервированный под чужие заказы товар продать нельзя
+	if position.Qty <= 0 || qty-reserved < position.Qty || !active {
+		logger.Warn(ctx, "invalid sale position", "product_id", position.ProductID, "qty", position.Qty)
+		return types.ErrInvalidPosition
+	}
+
+	if _, err = tx.Exec(ctx, `update products set qty = qty - $1 where id = $2`, position.Qty, position.ProductID); err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+
+	sqlstmt = `insert into sales_positions (sale_id,product_id,qty,price) values ($1,$2,$3,$4) returning id, created`
+	err = tx.QueryRow(ctx, sqlstmt, saleID, position.ProductID, position.Qty, position.Price).
+		Scan(&position.ID, &position.Created)
+	if err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	position.SaleID = saleID
+	return nil
+}
+
+//SalesTotal ...
+func (s *Store) SalesTotal(ctx context.Context, managerID int64) (int, error) {
+	sum := 0
+
+	sqlstmt := `
+	select coalesce(sum(sp.qty * sp.price), 0)
+	from sales s
+	join sales_positions sp on sp.sale_id = s.id
+	where s.manager_id = $1`
+
+	if err := s.pool.QueryRow(ctx, sqlstmt, managerID).Scan(&sum); err != nil {
+		logger.Error(ctx, err)
+		return 0, types.ErrInternal
+	}
+	return sum, nil
+}
+
+//TeamSales ...
+func (s *Store) TeamSales(ctx context.Context, ids []int64) ([]*types.TeamSales, error) {
+
+	items := make([]*types.TeamSales, 0)
+
+	sqlstmt := `
+	select m.id, m.name, coalesce(m.boss_id, 0), count(distinct s.id), coalesce(sum(sp.qty * sp.price), 0)
+	from managers m
+	left join sales s on s.manager_id = m.id
+	left join sales_positions sp on sp.sale_id = s.id
+	where m.id = any($1)
+	group by m.id, m.name, m.boss_id
+	order by m.id`
+
+	rows, err := s.pool.Query(ctx, sqlstmt, ids)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &types.TeamSales{}
+		if err = rows.Scan(&item.ManagerID, &item.Name, &item.BossID, &item.Sales, &item.Total); err != nil {
+			logger.Error(ctx, err)
+			return nil, types.ErrInternal
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
@@ -0,0 +1,102 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/KarrenAeris/crud/pkg/logger"
+	"github.com/KarrenAeris/crud/pkg/types"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// sessionTable возвращает таблицу токенов и колонку пользователя.
+// Они выбираются из списка, а не подставляются из аргумента
+func sessionTable(userType string) (string, string) {
+	if userType == types.UserManager {
+		return "managers_tokens", "manager_id"
+	}
+	return "customers_tokens", "customer_id"
+}
+
+//Sessions ...
+func (s *Store) Sessions(ctx context.Context, userType string, userID int64) ([]*types.Session, error) {
+	table, column := sessionTable(userType)
+	sqlstmt := fmt.Sprintf(`
+	select id, %[2]s, user_agent, ip, last_seen, created, expire from %[1]s
+	where %[2]s = $1 and expire > now() order by last_seen desc, id desc`, table, column)
+
+	rows, err := s.pool.Query(ctx, sqlstmt, userID)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	items := make([]*types.Session, 0)
+	for rows.Next() {
+		item := &types.Session{}
+		err = rows.Scan(&item.ID, &item.UserID, &item.UserAgent, &item.IP, &item.LastSeen, &item.Created, &item.Expire)
+		if err != nil {
+			logger.Error(ctx, err)
+			return nil, types.ErrInternal
+		}
+		items = append(items, item)
+	}
+	if err = rows.Err(); err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	return items, nil
+}
+
+//SessionByToken ...
+func (s *Store) SessionByToken(ctx context.Context, userType string, tokenHash string) (*types.Session, error) {
+	table, column := sessionTable(userType)
+	sqlstmt := fmt.Sprintf(`select id, %[2]s, user_agent, ip, last_seen, created, expire from %[1]s where token_hash = $1`, table, column)
+	return s.sessionRow(ctx, sqlstmt, tokenHash)
+}
+
+//TouchSession ...
+func (s *Store) TouchSession(ctx context.Context, userType string, tokenHash string, device types.Device, at, before time.Time) error {
+	table, _ := sessionTable(userType)
+	sqlstmt := fmt.Sprintf(`
+	update %s set last_seen = $2, user_agent = $3, ip = $4
+	where token_hash = $1 and last_seen < $5`, table)
+
+	return s.exec(ctx, sqlstmt, tokenHash, at, device.UserAgent, device.IP, before)
+}
+
+//RevokeSession ...
+func (s *Store) RevokeSession(ctx context.Context, userType string, userID, id int64) (*types.Session, error) {
+	table, column := sessionTable(userType)
+	sqlstmt := fmt.Sprintf(`
+	delete from %[1]s where id = $1 and %[2]s = $2
+	returning id, %[2]s, user_agent, ip, last_seen, created, expire`, table, column)
+	return s.sessionRow(ctx, sqlstmt, id, userID)
+}
+
+//RotateSession ...
+func (s *Store) RotateSession(ctx context.Context, userType string, tokenHash, newHash string) (int64, error) {
+	table, column := sessionTable(userType)
+	sqlstmt := fmt.Sprintf(`
+	update %[1]s set token_hash = $2, expire = now() + $3 * interval '1 second'
+	where token_hash = $1 and expire > now()
+	returning %[2]s`, table, column)
+	return s.idByToken(ctx, sqlstmt, tokenHash, newHash, int64(types.TokenTTL/time.Second))
+}
+
+func (s *Store) sessionRow(ctx context.Context, sqlstmt string, args ...interface{}) (*types.Session, error) {
+	item := &types.Session{}
+
+	err := s.pool.QueryRow(ctx, sqlstmt, args...).Scan(&item.ID, &item.UserID, &item.UserAgent, &item.IP, &item.LastSeen, &item.Created, &item.Expire)
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	return item, nil
+}
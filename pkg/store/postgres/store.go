@@ -0,0 +1,19 @@
+package postgres
+
+import (
+	"github.com/KarrenAeris/crud/pkg/store"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+var _ store.Store = (*Store)(nil)
+
+//Store реализует store.Store поверх Postgres.
+type Store struct {
+	pool *pgxpool.Pool
+}
+
+//NewStore создаёт хранилище.
+func NewStore(pool *pgxpool.Pool) *Store {
+	return &Store{pool: pool}
+}
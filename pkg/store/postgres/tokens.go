@@ -0,0 +1,54 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/KarrenAeris/crud/pkg/logger"
+	"github.com/KarrenAeris/crud/pkg/types"
+
+	"github.com/jackc/pgx/v4"
+)
+
+//SaveCustomerToken ...
+func (s *Store) SaveCustomerToken(ctx context.Context, tokenHash string, customerID int64, device types.Device) error {
+	sqlstmt := `insert into customers_tokens(token_hash, customer_id, user_agent, ip) values($1, $2, $3, $4)`
+	return s.exec(ctx, sqlstmt, tokenHash, customerID, device.UserAgent, device.IP)
+}
+
+//CustomerIDByToken ...
+func (s *Store) CustomerIDByToken(ctx context.Context, tokenHash string) (int64, error) {
+	return s.idByToken(ctx, `select customer_id from customers_tokens where token_hash = $1 and expire > now()`, tokenHash)
+}
+
+//SaveManagerToken ...
+func (s *Store) SaveManagerToken(ctx context.Context, tokenHash string, managerID int64, device types.Device) error {
+	sqlstmt := `insert into managers_tokens(token_hash, manager_id, user_agent, ip) values($1, $2, $3, $4)`
+	return s.exec(ctx, sqlstmt, tokenHash, managerID, device.UserAgent, device.IP)
+}
+
+//ManagerIDByToken ...
+func (s *Store) ManagerIDByToken(ctx context.Context, tokenHash string) (int64, error) {
+	return s.idByToken(ctx, `select manager_id from managers_tokens where token_hash = $1 and expire > now()`, tokenHash)
+}
+
+func (s *Store) idByToken(ctx context.Context, sqlstmt string, args ...interface{}) (int64, error) {
+	var id int64
+
+	err := s.pool.QueryRow(ctx, sqlstmt, args...).Scan(&id)
+	if err == pgx.ErrNoRows {
+		return 0, types.ErrNotFound
+	}
+	if err != nil {
+		logger.Error(ctx, err)
+		return 0, types.ErrInternal
+	}
+	return id, nil
+}
+
+func (s *Store) exec(ctx context.Context, sqlstmt string, args ...interface{}) error {
+	if _, err := s.pool.Exec(ctx, sqlstmt, args...); err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/KarrenAeris/crud/pkg/logger"
+	"github.com/KarrenAeris/crud/pkg/types"
+
+	"github.com/jackc/pgx/v4"
+)
+
+//TOTP ...
+func (s *Store) TOTP(ctx context.Context, managerID int64) (*types.TOTP, error) {
+	item := &types.TOTP{ManagerID: managerID}
+
+	sqlstmt := `select secret, enabled, last_step, created from manager_totp where manager_id = $1`
+	err := s.pool.QueryRow(ctx, sqlstmt, managerID).Scan(&item.Secret, &item.Enabled, &item.LastStep, &item.Created)
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	return item, nil
+}
+
+//SaveTOTPSecret ...
+func (s *Store) SaveTOTPSecret(ctx context.Context, managerID int64, secret string) error {
+	sqlstmt := `
+	insert into manager_totp(manager_id, secret) values ($1, $2)
+	on conflict (manager_id) do update
+	set secret = excluded.secret, last_step = 0, created = CURRENT_TIMESTAMP
+	where not manager_totp.enabled`
+
+	tag, err := s.pool.Exec(ctx, sqlstmt, managerID, secret)
+	if err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	if tag.RowsAffected() == 0 {
+		return types.ErrTwoFactorEnabled
+	}
+	return nil
+}
+
+//EnableTOTP ...
+func (s *Store) EnableTOTP(ctx context.Context, managerID int64, step int64, recoveryHashes []string) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	sqlstmt := `update manager_totp set enabled = true, last_step = $2 where manager_id = $1 and not enabled`
+	tag, err := tx.Exec(ctx, sqlstmt, managerID, step)
+	if err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	if tag.RowsAffected() == 0 {
+		return types.ErrNotFound
+	}
+
+	if _, err = tx.Exec(ctx, `delete from manager_recovery_codes where manager_id = $1`, managerID); err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	for _, hash := range recoveryHashes {
+		_, err = tx.Exec(ctx, `insert into manager_recovery_codes(manager_id, code_hash) values ($1, $2)`, managerID, hash)
+		if err != nil {
+			logger.Error(ctx, err)
+			return types.ErrInternal
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	return nil
+}
+
+//UseTOTPStep ...
+func (s *Store) UseTOTPStep(ctx context.Context, managerID int64, step int64) (bool, error) {
+	// сравнение и запись одним запросом, чтобы один код не прошёл в двух параллельных запросах
+	sqlstmt := `update manager_totp set last_step = $2 where manager_id = $1 and enabled and last_step < $2`
+	tag, err := s.pool.Exec(ctx, sqlstmt, managerID, step)
+	if err != nil {
+		logger.Error(ctx, err)
+		return false, types.ErrInternal
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+//UseRecoveryCode ...
+func (s *Store) UseRecoveryCode(ctx context.Context, managerID int64, codeHash string) (bool, error) {
+	sqlstmt := `delete from manager_recovery_codes where manager_id = $1 and code_hash = $2`
+	tag, err := s.pool.Exec(ctx, sqlstmt, managerID, codeHash)
+	if err != nil {
+		logger.Error(ctx, err)
+		return false, types.ErrInternal
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+//DisableTOTP ...
+func (s *Store) DisableTOTP(ctx context.Context, managerID int64) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	for _, sqlstmt := range []string{
+		`delete from manager_totp where manager_id = $1`,
+		`delete from manager_recovery_codes where manager_id = $1`,
+		`delete from login_challenges where manager_id = $1`,
+	} {
+		if _, err = tx.Exec(ctx, sqlstmt, managerID); err != nil {
+			logger.Error(ctx, err)
+			return types.ErrInternal
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	return nil
+}
+
+//SaveLoginChallenge ...
+func (s *Store) SaveLoginChallenge(ctx context.Context, challenge *types.LoginChallenge) error {
+	// заодно убираем истёкшие входы, отдельная очистка для них не нужна
+	if _, err := s.pool.Exec(ctx, `delete from login_challenges where expire < CURRENT_TIMESTAMP`); err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+
+	sqlstmt := `insert into login_challenges(token_hash, manager_id, expire) values ($1, $2, $3)`
+	if _, err := s.pool.Exec(ctx, sqlstmt, challenge.Hash, challenge.ManagerID, challenge.Expire); err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	return nil
+}
+
+//LoginChallenge ...
+func (s *Store) LoginChallenge(ctx context.Context, hash string) (*types.LoginChallenge, error) {
+	item := &types.LoginChallenge{Hash: hash}
+
+	sqlstmt := `select manager_id, attempts, expire from login_challenges where token_hash = $1`
+	err := s.pool.QueryRow(ctx, sqlstmt, hash).Scan(&item.ManagerID, &item.Attempts, &item.Expire)
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, types.ErrInternal
+	}
+	return item, nil
+}
+
+//AddLoginChallengeAttempt ...
+func (s *Store) AddLoginChallengeAttempt(ctx context.Context, hash string) error {
+	tag, err := s.pool.Exec(ctx, `update login_challenges set attempts = attempts + 1 where token_hash = $1`, hash)
+	if err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	if tag.RowsAffected() == 0 {
+		return types.ErrNotFound
+	}
+	return nil
+}
+
+//DeleteLoginChallenge ...
+func (s *Store) DeleteLoginChallenge(ctx context.Context, hash string) error {
+	if _, err := s.pool.Exec(ctx, `delete from login_challenges where token_hash = $1`, hash); err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	return nil
+}
+
+//RequireAdminTOTP ...
+func (s *Store) RequireAdminTOTP(ctx context.Context) (bool, error) {
+	required := false
+
+	err := s.pool.QueryRow(ctx, `select require_admin_totp from auth_policy`).Scan(&required)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		logger.Error(ctx, err)
+		return false, types.ErrInternal
+	}
+	return required, nil
+}
+
+//SetRequireAdminTOTP ...
+func (s *Store) SetRequireAdminTOTP(ctx context.Context, required bool) error {
+	sqlstmt := `
+	insert into auth_policy(id, require_admin_totp) values (true, $1)
+	on conflict (id) do update set require_admin_totp = excluded.require_admin_totp`
+
+	if _, err := s.pool.Exec(ctx, sqlstmt, required); err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/KarrenAeris/crud/pkg/types"
+)
+
+// Хранилища возвращают types.ErrNotFound, если записи нет, и types.ErrInternal при сбое хранилища.
+// Бизнес-правила (пароли, журнал, метрики) остаются в сервисах.
+
+//Customers хранит покупателей.
+type Customers interface {
+	//Customers возвращает покупателей, activeOnly - только активных
+	Customers(ctx context.Context, activeOnly bool) ([]*types.Customer, error)
+	//CustomerByID возвращает покупателя
+	CustomerByID(ctx context.Context, id int64) (*types.Customer, error)
+	//CustomerCredentials возвращает id и bcrypt хеш пароля покупателя по телефону
+	CustomerCredentials(ctx context.Context, phone string) (int64, string, error)
+	//SaveCustomer создаёт (ID = 0) или обновляет имя, телефон и пароль покупателя.
+	//При смене телефона подтверждение снимается
+	SaveCustomer(ctx context.Context, customer *types.Customer, passwordHash string) (*types.Customer, error)
+	//UpdateCustomer обновляет имя, телефон и активность покупателя. При смене телефона подтверждение снимается
+	UpdateCustomer(ctx context.Context, customer *types.Customer) (*types.Customer, error)
+	//SetCustomerActive включает или отключает покупателя
+	SetCustomerActive(ctx context.Context, id int64, active bool) (*types.Customer, error)
+	//RemoveCustomer удаляет покупателя и возвращает его
+	RemoveCustomer(ctx context.Context, id int64) (*types.Customer, error)
+}
+
+//Managers хранит продавцов и их оргструктуру.
+type Managers interface {
+	//CreateManager создаёт продавца и возвращает его id.
+	//Если телефон уже занят, возвращает types.ErrPhoneUsed
+	CreateManager(ctx context.Context, manager *types.Manager) (int64, error)
+	//ManagerByID возвращает продавца
+	ManagerByID(ctx context.Context, id int64) (*types.Manager, error)
+	//ManagerCredentials возвращает id и bcrypt хеш пароля продавца по телефону
+	ManagerCredentials(ctx context.Context, phone string) (int64, string, error)
+	//IsAdmin проверяет, админ ли продавец
+	IsAdmin(ctx context.Context, id int64) (bool, error)
+	//SetBoss назначает продавцу руководителя (bossID = 0 - без руководителя) и отдел
+	SetBoss(ctx context.Context, id, bossID int64, departament string) (*types.Manager, error)
+	//Subtree возвращает id продавца и всех его подчинённых на любом уровне
+	Subtree(ctx context.Context, id int64) ([]int64, error)
+	//TeamMembers возвращает плоский список продавца rootID и его подчинённых (rootID = 0 - всех), упорядоченный по id
+	TeamMembers(ctx context.Context, rootID int64) ([]*types.TeamNode, error)
+}
+
+//Products хранит товары.
+type Products interface {
+	//Products возвращает активные товары с доступным (не зарезервированным) остатком
+	Products(ctx context.Context) ([]*types.Product, error)
+	//ProductByID возвращает товар
+	ProductByID(ctx context.Context, id int64) (*types.Product, error)
+	//SaveProduct создаёт (ID = 0) или обновляет товар
+	SaveProduct(ctx context.Context, product *types.Product) (*types.Product, error)
+	//RemoveProduct удаляет товар
+	RemoveProduct(ctx context.Context, id int64) error
+}
+
+//Sales хранит продажи.
+type Sales interface {
+	//CreateSale списывает товар и сохраняет продажу целиком или не сохраняет ничего.
+	//Черновики (резервы) продавца на товары продажи закрываются ею.
+	//Если задан OrderID, заказ подтверждается в той же транзакции; если он уже не ожидает
+	//подтверждения, возвращает types.ErrOrderStatus.
+	//Если товара не хватает или он не активен, возвращает types.ErrInvalidPosition
+	CreateSale(ctx context.Context, sale *types.Sale) (*types.Sale, error)
+	//SalesTotal возвращает сумму продаж продавца
+	SalesTotal(ctx context.Context, managerID int64) (int, error)
+	//TeamSales возвращает число и сумму продаж каждого продавца из списка ids
+	TeamSales(ctx context.Context, ids []int64) ([]*types.TeamSales, error)
+}
+
+//Tokens хранит токены покупателей и продавцов. Сами токены не хранятся, только их хеши (utils.HashToken).
+type Tokens interface {
+	//SaveCustomerToken сохраняет хеш токена покупателя и устройство, с которого выполнен вход
+	SaveCustomerToken(ctx context.Context, tokenHash string, customerID int64, device types.Device) error
+	//CustomerIDByToken возвращает id покупателя по хешу действующего токена
+	CustomerIDByToken(ctx context.Context, tokenHash string) (int64, error)
+	//SaveManagerToken сохраняет хеш токена продавца и устройство, с которого выполнен вход
+	SaveManagerToken(ctx context.Context, tokenHash string, managerID int64, device types.Device) error
+	//ManagerIDByToken возвращает id продавца по хешу действующего токена
+	ManagerIDByToken(ctx context.Context, tokenHash string) (int64, error)
+}
+
+//PhoneCodes хранит коды подтверждения телефона, у пользователя не больше одного кода.
+//userType - customer или manager.
+type PhoneCodes interface {
+	//SavePhoneCode сохраняет код, заменяя прежний код пользователя
+	SavePhoneCode(ctx context.Context, code *types.PhoneCode) error
+	//PhoneCode возвращает код пользователя
+	PhoneCode(ctx context.Context, userType string, userID int64) (*types.PhoneCode, error)
+	//ClaimPhoneCode атомарно засчитывает попытку ввода кода и возвращает код для сверки.
+	//Если код истёк или попыток было уже maxAttempts, попытка не засчитывается и возвращается types.ErrNotFound
+	ClaimPhoneCode(ctx context.Context, userType string, userID int64, maxAttempts int) (*types.PhoneCode, error)
+	//ConfirmPhone удаляет код с хешем codeHash и отмечает телефон пользователя подтверждённым.
+	//Если кода с таким хешем уже нет или телефон пользователя уже не phone, возвращает types.ErrNotFound
+	ConfirmPhone(ctx context.Context, userType string, userID int64, phone, codeHash string) error
+}
+
+//PasswordResets хранит коды сброса пароля, у пользователя не больше одного кода.
+//userType - customer или manager.
+type PasswordResets interface {
+	//SavePasswordReset сохраняет код, заменяя прежний код пользователя
+	SavePasswordReset(ctx context.Context, reset *types.PasswordReset) error
+	//PasswordReset возвращает код пользователя
+	PasswordReset(ctx context.Context, userType string, userID int64) (*types.PasswordReset, error)
+	//ClaimPasswordReset атомарно засчитывает попытку ввода кода и возвращает код для сверки.
+	//Если код истёк или попыток было уже maxAttempts, попытка не засчитывается и возвращается types.ErrNotFound
+	ClaimPasswordReset(ctx context.Context, userType string, userID int64, maxAttempts int) (*types.PasswordReset, error)
+	//ResetPassword удаляет код с хешем codeHash, сохраняет новый bcrypt хеш пароля и удаляет все токены пользователя.
+	//Если кода с таким хешем уже нет (использован или заменён), возвращает types.ErrNotFound
+	ResetPassword(ctx context.Context, userType string, userID int64, codeHash, passwordHash string) error
+}
+
+//APIKeys хранит ключи API. Сами ключи не хранятся, только их хеши (utils.HashToken).
+type APIKeys interface {
+	//CreateAPIKey сохраняет ключ с хешем keyHash
+	CreateAPIKey(ctx context.Context, key *types.APIKey, keyHash string) (*types.APIKey, error)
+	//APIKeys возвращает все ключи, в том числе отозванные, новые первыми
+	APIKeys(ctx context.Context) ([]*types.APIKey, error)
+	//APIKeyByID возвращает ключ
+	APIKeyByID(ctx context.Context, id int64) (*types.APIKey, error)
+	//APIKeyByHash возвращает ключ по хешу
+	APIKeyByHash(ctx context.Context, keyHash string) (*types.APIKey, error)
+	//TouchAPIKey отмечает время последнего использования ключа, если прошлая отметка старше before
+	TouchAPIKey(ctx context.Context, id int64, at, before time.Time) error
+	//RevokeAPIKey отзывает ключ и возвращает его; отозванный раньше ключ не меняется
+	RevokeAPIKey(ctx context.Context, id int64) (*types.APIKey, error)
+}
+
+//TwoFactor хранит второй фактор продавцов: секреты TOTP, коды восстановления (только SHA-256)
+//и незавершённые входы, ждущие код.
+type TwoFactor interface {
+	//TOTP возвращает второй фактор продавца
+	TOTP(ctx context.Context, managerID int64) (*types.TOTP, error)
+	//SaveTOTPSecret сохраняет неподтверждённый секрет, заменяя прежний неподтверждённый.
+	//Если второй фактор уже подключён, возвращает types.ErrTwoFactorEnabled
+	SaveTOTPSecret(ctx context.Context, managerID int64, secret string) error
+	//EnableTOTP подтверждает второй фактор с принятым кодом периода step и заменяет коды восстановления
+	EnableTOTP(ctx context.Context, managerID int64, step int64, recoveryHashes []string) error
+	//UseTOTPStep запоминает период принятого кода; false - код этого или более нового периода уже принят
+	UseTOTPStep(ctx context.Context, managerID int64, step int64) (bool, error)
+	//UseRecoveryCode удаляет код восстановления; false - такого кода нет
+	UseRecoveryCode(ctx context.Context, managerID int64, codeHash string) (bool, error)
+	//DisableTOTP удаляет второй фактор, коды восстановления и незавершённые входы продавца
+	DisableTOTP(ctx context.Context, managerID int64) error
+	//SaveLoginChallenge сохраняет незавершённый вход
+	SaveLoginChallenge(ctx context.Context, challenge *types.LoginChallenge) error
+	//LoginChallenge возвращает незавершённый вход по хешу токена
+	LoginChallenge(ctx context.Context, hash string) (*types.LoginChallenge, error)
+	//AddLoginChallengeAttempt увеличивает число неудачных попыток ввода кода
+	AddLoginChallengeAttempt(ctx context.Context, hash string) error
+	//DeleteLoginChallenge удаляет незавершённый вход
+	DeleteLoginChallenge(ctx context.Context, hash string) error
+	//RequireAdminTOTP сообщает, нужен ли админам второй фактор
+	RequireAdminTOTP(ctx context.Context) (bool, error)
+	//SetRequireAdminTOTP включает или отключает обязательный второй фактор для админов
+	SetRequireAdminTOTP(ctx context.Context, required bool) error
+}
+
+//Sessions хранит сессии - токены из БД покупателей и продавцов (userType - types.UserCustomer или types.UserManager).
+type Sessions interface {
+	//Sessions возвращает сессии пользователя, последние использованные первыми
+	Sessions(ctx context.Context, userType string, userID int64) ([]*types.Session, error)
+	//SessionByToken возвращает сессию по хешу токена
+	SessionByToken(ctx context.Context, userType string, tokenHash string) (*types.Session, error)
+	//TouchSession отмечает использование сессии в момент at, если прошлая отметка была раньше before
+	TouchSession(ctx context.Context, userType string, tokenHash string, device types.Device, at, before time.Time) error
+	//RevokeSession удаляет сессию пользователя. Чужая или неизвестная сессия - types.ErrNotFound
+	RevokeSession(ctx context.Context, userType string, userID, id int64) (*types.Session, error)
+	//RotateSession заменяет хеш действующего токена сессии на newHash и продлевает её на types.TokenTTL.
+	//Возвращает id пользователя. Истёкший или неизвестный токен - types.ErrNotFound
+	RotateSession(ctx context.Context, userType string, tokenHash, newHash string) (int64, error)
+}
+
+//Store объединяет все хранилища.
+type Store interface {
+	Customers
+	Managers
+	Products
+	Sales
+	Tokens
+	PhoneCodes
+	PasswordResets
+	APIKeys
+	TwoFactor
+	Sessions
+}
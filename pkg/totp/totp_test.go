@@ -0,0 +1,91 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret - секрет SHA-1 из тестовых векторов RFC 6238 (приложение B)
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCodeRFC6238(t *testing.T) {
+	// в RFC коды из 8 цифр, у нас Digits младших цифр того же значения
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, test := range tests {
+		step := Step(time.Unix(test.unix, 0))
+		code, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatalf("Code(%d): %v", test.unix, err)
+		}
+		if want := test.code[len(test.code)-Digits:]; code != want {
+			t.Errorf("Code(%d) = %s, want %s", test.unix, code, want)
+		}
+	}
+
+	// секрет принимается в любом регистре, неверный base32 - ошибка
+	if code, err := Code(strings.ToLower(rfcSecret), 1); err != nil || code != "287082" {
+		t.Errorf("lowercase secret: %s, %v", code, err)
+	}
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("invalid secret accepted")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+	code := func(step int64) string {
+		value, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return value
+	}
+
+	tests := []struct {
+		name string
+		code string
+		step int64
+		ok   bool
+	}{
+		{"current", code(current), current, true},
+		{"previous", code(current - Skew), current - Skew, true},
+		{"next", code(current + Skew), current + Skew, true},
+		{"too old", code(current - Skew - 1), 0, false},
+		{"too new", code(current + Skew + 1), 0, false},
+		{"short", code(current)[1:], 0, false},
+		{"empty", "", 0, false},
+	}
+	for _, test := range tests {
+		step, ok := Validate(rfcSecret, test.code, now)
+		if ok != test.ok || step != test.step {
+			t.Errorf("%s: Validate = (%d, %v), want (%d, %v)", test.name, step, ok, test.step, test.ok)
+		}
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := encoding.DecodeString(secret)
+	if err != nil || len(key) != SecretSize || strings.Contains(secret, "=") {
+		t.Fatalf("secret %q: %d bytes, %v", secret, len(key), err)
+	}
+	if other, _ := GenerateSecret(); other == secret {
+		t.Fatal("secrets repeat")
+	}
+}
@@ -0,0 +1,45 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//QueryLogger превращает записи pgx о выполненных запросах в спаны.
+//pgx v4 не даёт хуков до начала запроса, поэтому спан открывается задним числом по его длительности.
+//Аргументы запросов в спан не попадают: среди них бывают пароли и токены
+type QueryLogger struct{}
+
+//Log реализует pgx.Logger
+func (QueryLogger) Log(ctx context.Context, level pgx.LogLevel, msg string, data map[string]interface{}) {
+	sql, ok := data["sql"].(string)
+	if !ok {
+		return
+	}
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		// запросы вне HTTP запроса (фоновые задачи) не трассируем
+		return
+	}
+
+	end := time.Now()
+	start := end
+	if duration, ok := data["time"].(time.Duration); ok {
+		start = end.Add(-duration)
+	}
+
+	_, span := Start(ctx, "db."+msg,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(start),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBStatementKey.String(sql)),
+	)
+	if level == pgx.LogLevelError {
+		span.SetStatus(codes.Error, fmt.Sprint(data["err"]))
+	}
+	span.End(trace.WithTimestamp(end))
+}
@@ -1,6 +1,7 @@
 package types
 
 import (
+	"encoding/json"
 	"errors"
 	"time"
 )
@@ -21,13 +22,87 @@ var (
 	//ErrInvalidPassword возвращается, когда пороль не верен
 	ErrInvalidPassword = errors.New("invalid password")
 
-	//ErrPhoneUsed возвращается, когда телефон (логин) не найден
+	//ErrPhoneUsed возвращается, когда телефон (логин) уже занят
 	ErrPhoneUsed = errors.New("phone alredy registered")
 
 	//ErrExpireToken возвращается, когда время ожидания токена истекает
 	ErrExpireToken = errors.New("token expired")
+
+	//ErrCartEmpty возвращается, когда корзина покупателя пуста
+	ErrCartEmpty = errors.New("cart is empty")
+
+	//ErrInvalidPosition возвращается, когда товара нет в наличии или он неактивен
+	ErrInvalidPosition = errors.New("invalid sale position")
+
+	//ErrInvalidBoss возвращается, когда руководитель не найден или назначение создаёт цикл
+	ErrInvalidBoss = errors.New("invalid boss")
+
+	//ErrPayrollLocked возвращается, когда расчёт зарплаты уже заблокирован
+	ErrPayrollLocked = errors.New("payroll is locked")
+
+	//ErrOrderStatus возвращается, когда заказ нельзя перевести в новый статус
+	ErrOrderStatus = errors.New("invalid order status")
+
+	//ErrInvalidPhone возвращается, когда номер телефона нельзя привести к формату E.164
+	ErrInvalidPhone = errors.New("invalid phone number")
+
+	//ErrInvalidCode возвращается, когда код подтверждения неверен, истёк или не запрашивался
+	ErrInvalidCode = errors.New("invalid verification code")
+
+	//ErrTooManyAttempts возвращается, когда попытки ввода кода исчерпаны или код запрашивается слишком часто
+	ErrTooManyAttempts = errors.New("too many attempts")
+
+	//ErrPhoneVerified возвращается, когда телефон уже подтверждён
+	ErrPhoneVerified = errors.New("phone already verified")
+
+	//ErrTwoFactorRequired возвращается, когда для входа нужен код второго фактора
+	ErrTwoFactorRequired = errors.New("two-factor code required")
+
+	//ErrTwoFactorEnabled возвращается, когда второй фактор уже подключён
+	ErrTwoFactorEnabled = errors.New("two-factor already enabled")
+
+	//ErrTwoFactorDisabled возвращается, когда второй фактор не подключён
+	ErrTwoFactorDisabled = errors.New("two-factor not enabled")
+)
+
+// Статусы заказа
+const (
+	OrderPending   = "pending"   // ждёт подтверждения продавцом
+	OrderConfirmed = "confirmed" // подтверждён, по нему создана продажа
+	OrderFulfilled = "fulfilled" // выдан покупателю
+	OrderCancelled = "cancelled" // отменён
 )
 
+// Статусы расчёта зарплаты
+const (
+	PayrollDraft  = "draft"  // на проверке у админа
+	PayrollLocked = "locked" // утверждён, больше не меняется
+)
+
+// Типы пользователей
+const (
+	UserCustomer = "customer" // покупатель
+	UserManager  = "manager"  // продавец
+)
+
+// Роли в токене доступа
+const (
+	RoleCustomer = "CUSTOMER" // покупатель
+	RoleManager  = "MANAGER"  // продавец
+	RoleAdmin    = "ADMIN"    // продавец-админ
+)
+
+//AuthTokens - ответ на вход. В режиме подписанных токенов Token - короткоживущий токен доступа,
+//а RefreshToken хранится в БД и обменивается на новый токен доступа.
+//Если у продавца подключён второй фактор, после пароля возвращается только Challenge - его вместе с кодом
+//обменивают на токены
+type AuthTokens struct {
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"` // через сколько секунд истекает Token
+	Challenge    string `json:"challenge,omitempty"`
+}
+
 //Manager представляет информацию о продавцов.
 type Manager struct {
 	ID          int64     `json:"id"`
@@ -39,43 +114,308 @@ type Manager struct {
 	Phone       string    `json:"phone"`
 	Password    string    `json:"password"`
 	IsAdmin     bool      `json:"is_admin"`
+	Verified    bool      `json:"phone_verified"`
 	Created     time.Time `json:"created"`
 }
 
 //Product представляет информацию о покупатках.
 type Product struct {
-	ID      int64     `json:"id"`
-	Name    string    `json:"name"`
-	Price   int       `json:"price"`
-	Qty     int       `json:"qty"`
-	Active  bool      `json:"active"`
-	Created time.Time `json:"created"`
+	ID        int64     `json:"id"`
+	Name      string    `json:"name" validate:"required,max=255"`
+	Price     int       `json:"price" validate:"min=1"`
+	Qty       int       `json:"qty" validate:"min=0"`
+	Available int       `json:"available"`
+	Category  string    `json:"category" validate:"max=100"`
+	Active    bool      `json:"active"`
+	Created   time.Time `json:"created"`
 }
 
 //Sale представляет информацию о скидках.
 type Sale struct {
 	ID         int64           `json:"id"`
 	ManagerID  int64           `json:"manager_id"`
-	CustomerID int64           `json:"customer_id"`
+	CustomerID int64           `json:"customer_id" validate:"min=0"`
 	Created    time.Time       `json:"created"`
-	Positions  []*SalePosition `json:"positions"`
+	Positions  []*SalePosition `json:"positions" validate:"required,dive"`
+	OrderID    int64           `json:"-"` // заказ, по которому создаётся продажа; он подтверждается и его резервы снимаются вместе с ней
 }
 
 //SalePosition представляет информацию о позиции скидки.
 type SalePosition struct {
 	ID        int64     `json:"id"`
-	ProductID int64     `json:"product_id"`
+	ProductID int64     `json:"product_id" validate:"required"`
 	SaleID    int64     `json:"sale_id"`
-	Price     int       `json:"price"`
-	Qty       int       `json:"qty"`
+	Price     int       `json:"price" validate:"min=0"`
+	Qty       int       `json:"qty" validate:"min=1"`
 	Created   time.Time `json:"created"`
 }
 
 //Customer представляет информацию о покупателе.
 type Customer struct {
-	ID      int64     `json:"id"`
-	Name    string    `json:"name"`
-	Phone   string    `json:"phone"`
-	Active  bool      `json:"active"`
-	Created time.Time `json:"created"`
+	ID       int64     `json:"id"`
+	Name     string    `json:"name" validate:"required,max=255"`
+	Phone    string    `json:"phone" validate:"required,phone"`
+	Verified bool      `json:"phone_verified"`
+	Active   bool      `json:"active"`
+	Created  time.Time `json:"created"`
+}
+
+//CartPosition представляет информацию о позиции в корзине покупателя.
+type CartPosition struct {
+	ProductID int64     `json:"product_id" validate:"required"`
+	Name      string    `json:"name"`
+	Price     int       `json:"price"`
+	Qty       int       `json:"qty" validate:"min=0"`
+	Created   time.Time `json:"created"`
+}
+
+//Order представляет информацию о заказе покупателя.
+type Order struct {
+	ID         int64            `json:"id"`
+	CustomerID int64            `json:"customer_id"`
+	ManagerID  int64            `json:"manager_id"`
+	SaleID     int64            `json:"sale_id"`
+	Status     string           `json:"status"`
+	Created    time.Time        `json:"created"`
+	Positions  []*OrderPosition `json:"positions"`
+}
+
+//OrderPosition представляет информацию о позиции заказа.
+type OrderPosition struct {
+	ID        int64 `json:"id"`
+	OrderID   int64 `json:"order_id"`
+	ProductID int64 `json:"product_id"`
+	Price     int   `json:"price"`
+	Qty       int   `json:"qty"`
+}
+
+//Reservation представляет информацию о резерве товара под заказ или черновик продажи.
+type Reservation struct {
+	ID        int64     `json:"id"`
+	ProductID int64     `json:"product_id" validate:"required"`
+	Qty       int       `json:"qty" validate:"min=1"`
+	OrderID   int64     `json:"order_id"`
+	ManagerID int64     `json:"manager_id"`
+	Expire    time.Time `json:"expire"`
+	Created   time.Time `json:"created"`
+}
+
+//Performance представляет показатели продавца за период отчёта.
+type Performance struct {
+	ManagerID     int64     `json:"manager_id"`
+	Name          string    `json:"name"`
+	Period        time.Time `json:"period"`
+	Revenue       int64     `json:"revenue"`
+	Sales         int64     `json:"sales"`
+	AverageTicket int64     `json:"average_ticket"`
+	Plan          int64     `json:"plan"`
+	PlanPercent   float64   `json:"plan_percent"`
+}
+
+//TeamNode представляет продавца в оргструктуре вместе с подчинёнными.
+type TeamNode struct {
+	ID          int64       `json:"id"`
+	Name        string      `json:"name"`
+	BossID      int64       `json:"boss_id"`
+	Departament string      `json:"departament"`
+	Children    []*TeamNode `json:"children"`
+}
+
+//TeamSales представляет продажи продавца команды.
+type TeamSales struct {
+	ManagerID int64  `json:"manager_id"`
+	Name      string `json:"name"`
+	BossID    int64  `json:"boss_id"`
+	Sales     int64  `json:"sales"`
+	Total     int64  `json:"total"`
+}
+
+//CommissionTier представляет ставку комиссии начиная с уровня выполнения плана.
+type CommissionTier struct {
+	MinPercent int `json:"min_percent" validate:"min=0"`
+	Rate       int `json:"rate" validate:"min=0,max=10000"`
+}
+
+//CategoryRate представляет ставку комиссии для категории товара.
+type CategoryRate struct {
+	Category string `json:"category" validate:"required"`
+	Rate     int    `json:"rate" validate:"min=0,max=10000"`
+}
+
+//CommissionRules представляет правила расчёта комиссии, ставки - в сотых долях процента.
+type CommissionRules struct {
+	Tiers      []*CommissionTier `json:"tiers" validate:"dive"`
+	Categories []*CategoryRate   `json:"categories" validate:"dive"`
+}
+
+//Payroll представляет расчёт зарплаты продавцов за месяц.
+type Payroll struct {
+	ID        int64          `json:"id"`
+	Period    time.Time      `json:"period"`
+	Status    string         `json:"status"`
+	CreatedBy int64          `json:"created_by"`
+	LockedBy  int64          `json:"locked_by"`
+	Locked    *time.Time     `json:"locked"`
+	Created   time.Time      `json:"created"`
+	Items     []*PayrollItem `json:"items,omitempty"`
+}
+
+//PayrollItem представляет начисление продавцу в расчёте зарплаты.
+type PayrollItem struct {
+	PayrollID  int64  `json:"payroll_id"`
+	ManagerID  int64  `json:"manager_id"`
+	Name       string `json:"name"`
+	Salary     int64  `json:"salary"`
+	Plan       int64  `json:"plan"`
+	Revenue    int64  `json:"revenue"`
+	Commission int64  `json:"commission"`
+	Total      int64  `json:"total"`
+}
+
+//RevenuePoint представляет выручку за период временного ряда.
+type RevenuePoint struct {
+	Period  time.Time `json:"period"`
+	Sales   int64     `json:"sales"`
+	Units   int64     `json:"units"`
+	Revenue int64     `json:"revenue"`
+}
+
+//ProductStat представляет продажи товара за период.
+type ProductStat struct {
+	ProductID int64  `json:"product_id"`
+	Name      string `json:"name"`
+	Qty       int64  `json:"qty"`
+	Revenue   int64  `json:"revenue"`
+}
+
+//BasketStat представляет средний размер чека за период.
+type BasketStat struct {
+	Sales          int64   `json:"sales"`
+	Units          int64   `json:"units"`
+	Revenue        int64   `json:"revenue"`
+	AverageRevenue float64 `json:"average_revenue"`
+	AverageUnits   float64 `json:"average_units"`
+}
+
+//Cohort представляет покупателей, впервые купивших в одном месяце.
+type Cohort struct {
+	Period     time.Time `json:"period"`
+	Customers  int64     `json:"customers"`
+	Repeat     int64     `json:"repeat"`
+	RepeatRate float64   `json:"repeat_rate"`
+}
+
+//CustomerStat представляет долю повторных покупателей в целом и по когортам.
+type CustomerStat struct {
+	Customers  int64     `json:"customers"`
+	Repeat     int64     `json:"repeat"`
+	RepeatRate float64   `json:"repeat_rate"`
+	Cohorts    []*Cohort `json:"cohorts"`
+}
+
+//AuditEntry представляет запись журнала изменений.
+type AuditEntry struct {
+	ID        int64           `json:"id"`
+	ActorType string          `json:"actor_type"`
+	ActorID   int64           `json:"actor_id"`
+	Action    string          `json:"action"`
+	Entity    string          `json:"entity"`
+	EntityID  int64           `json:"entity_id"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	Diff      json.RawMessage `json:"diff"`
+	IP        string          `json:"ip"`
+	Created   time.Time       `json:"created"`
+}
+
+//AuditFilter представляет условия выборки из журнала изменений, пустые поля не учитываются.
+type AuditFilter struct {
+	ActorType string
+	ActorID   int64
+	Action    string
+	Entity    string
+	EntityID  int64
+	From      time.Time
+	To        time.Time
+	Limit     int
+	Offset    int
+}
+
+//PhoneCode представляет одноразовый код подтверждения телефона.
+type PhoneCode struct {
+	UserType string // customer или manager
+	UserID   int64
+	Phone    string // номер, на который отправлен код
+	Hash     string // bcrypt хеш кода
+	Attempts int    // неудачные попытки ввода
+	Expire   time.Time
+	Created  time.Time
+}
+
+//PasswordReset представляет одноразовый код сброса пароля.
+type PasswordReset struct {
+	UserType string // customer или manager
+	UserID   int64
+	Phone    string // номер, на который отправлен код
+	Hash     string // bcrypt хеш кода
+	Attempts int    // неудачные попытки ввода
+	Expire   time.Time
+	Created  time.Time
+}
+
+//APIKey представляет ключ API для интеграций. Сам ключ не хранится, только его хеш (utils.HashToken).
+type APIKey struct {
+	ID        int64      `json:"id"`
+	ManagerID int64      `json:"manager_id"` // создавший ключ админ, ключ действует от его имени
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"` // начало ключа, чтобы узнать его в списке
+	Scopes    []string   `json:"scopes"`
+	Expire    time.Time  `json:"expire"`
+	LastUsed  *time.Time `json:"last_used"`
+	Revoked   *time.Time `json:"revoked"`
+	Created   time.Time  `json:"created"`
+}
+
+//TOTP представляет второй фактор продавца - секрет одноразовых кодов (RFC 6238).
+type TOTP struct {
+	ManagerID int64
+	Secret    string // base32
+	Enabled   bool   // false - подключение ещё не подтверждено кодом
+	LastStep  int64  // период последнего принятого кода, коды не новее него не принимаются
+	Created   time.Time
+}
+
+//TOTPEnrollment - данные для подключения приложения-аутентификатора.
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"` // otpauth:// ссылка для QR-кода
+}
+
+//LoginChallenge представляет вход продавца, который ждёт код второго фактора.
+type LoginChallenge struct {
+	Hash      string // SHA-256 токена (utils.HashToken)
+	ManagerID int64
+	Attempts  int // неудачные попытки ввода кода
+	Expire    time.Time
+}
+
+//Device - откуда выполнен запрос: браузер или приложение и адрес клиента.
+type Device struct {
+	UserAgent string
+	IP        string
+}
+
+//TokenTTL - сколько действует токен из БД после входа или последнего обновления (expire в схеме)
+const TokenTTL = time.Hour
+
+//Session представляет вход пользователя - токен из БД. Сам токен не отдаётся, сессия узнаётся по ID.
+type Session struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	UserAgent string    `json:"user_agent"`
+	IP        string    `json:"ip"`
+	LastSeen  time.Time `json:"last_seen"` // обновляется не чаще раза в sessions.LastSeenInterval
+	Created   time.Time `json:"created"`
+	Expire    time.Time `json:"expire"`  // после него токен не принимается, обновление продлевает сессию
+	Current   bool      `json:"current"` // сессия, токеном которой выполнен запрос
 }
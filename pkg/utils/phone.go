@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"strings"
+
+	"github.com/KarrenAeris/crud/pkg/types"
+)
+
+//NormalizePhone приводит номер к формату E.164: + и от 8 до 15 цифр.
+//Пробелы, скобки, дефисы и точки убираются, префикс 00 заменяется на +.
+//Номер без + и 00 считается записанным вместе с кодом страны: "992 900 000 123" -> "+992900000123"
+func NormalizePhone(phone string) (string, error) {
+	phone = strings.TrimSpace(phone)
+	switch {
+	case strings.HasPrefix(phone, "+"):
+		phone = phone[1:]
+	case strings.HasPrefix(phone, "00"):
+		phone = phone[2:]
+	}
+
+	digits := make([]byte, 0, len(phone))
+	for i := 0; i < len(phone); i++ {
+		switch c := phone[i]; {
+		case c >= '0' && c <= '9':
+			digits = append(digits, c)
+		case c == ' ' || c == '-' || c == '(' || c == ')' || c == '.':
+		default:
+			return "", types.ErrInvalidPhone
+		}
+	}
+
+	// код страны не начинается с 0
+	if len(digits) < 8 || len(digits) > 15 || digits[0] == '0' {
+		return "", types.ErrInvalidPhone
+	}
+	return "+" + string(digits), nil
+}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/KarrenAeris/crud/pkg/types"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		phone string
+		want  string // пусто - types.ErrInvalidPhone
+	}{
+		{"+992900000123", "+992900000123"},
+		{"  +992 (900) 00-01.23 ", "+992900000123"},
+		{"00992900000123", "+992900000123"},
+		{"992 900 000 123", "+992900000123"},
+		{"+7 000 000 00 02", "+70000000002"},
+		{"+0992900000123", ""}, // код страны не начинается с 0
+		{"12345678", "+12345678"},
+		{"1234567", ""},
+		{"123456789012345", "+123456789012345"},
+		{"1234567890123456", ""},
+		{"+992-900-000-12a", ""},
+		{"+992/900000123", ""},
+		{"++992900000123", ""},
+		{"", ""},
+		{"+", ""},
+	}
+	for _, test := range tests {
+		got, err := NormalizePhone(test.phone)
+		if test.want == "" {
+			if err != types.ErrInvalidPhone {
+				t.Errorf("NormalizePhone(%q) = %q, %v, want ErrInvalidPhone", test.phone, got, err)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("NormalizePhone(%q) = %q, %v, want %q", test.phone, got, err, test.want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 
 	"github.com/KarrenAeris/crud/pkg/types"
@@ -18,3 +19,9 @@ func GenerateTokenStr() (string, error) {
 
 	return hex.EncodeToString(buffer), nil
 }
+
+//HashToken возвращает SHA-256 токена в hex. В БД хранится только хеш, поэтому дамп не даёт рабочих токенов
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
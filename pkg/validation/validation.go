@@ -0,0 +1,224 @@
+package validation
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/KarrenAeris/crud/pkg/utils"
+)
+
+// MaxBodySize - наибольший размер тела запроса, который принимает Decode
+const MaxBodySize = 1 << 20
+
+var (
+	//ErrBodyTooLarge возвращается, когда тело запроса больше допустимого размера
+	ErrBodyTooLarge = errors.New("request body too large")
+
+	//ErrEmptyBody возвращается, когда тело запроса пустое
+	ErrEmptyBody = errors.New("request body is empty")
+)
+
+//Errors - ошибки проверки по полям: имя поля в JSON -> сообщение.
+type Errors map[string]string
+
+func (e Errors) Error() string {
+	fields := make([]string, 0, len(e))
+	for field := range e {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	messages := make([]string, 0, len(fields))
+	for _, field := range fields {
+		messages = append(messages, field+": "+e[field])
+	}
+	return strings.Join(messages, "; ")
+}
+
+//Decode строго разбирает JSON из r в dst (неизвестные поля и лишние данные после объекта - ошибка)
+//и проверяет результат по тегам validate. Ошибки проверки возвращаются как Errors.
+//Тело больше MaxBodySize не читается, другой размер задаёт DecodeLimit
+func Decode(r io.Reader, dst interface{}) error {
+	return DecodeLimit(r, dst, MaxBodySize)
+}
+
+//DecodeLimit работает как Decode, но принимает тело не больше limit байт
+func DecodeLimit(r io.Reader, dst interface{}, limit int64) error {
+	body, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(body)) > limit {
+		return ErrBodyTooLarge
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return ErrEmptyBody
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(dst); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return errors.New("request body must contain a single JSON value")
+	}
+
+	return Validate(dst)
+}
+
+//Validate проверяет структуру по тегам validate:
+//	required - поле не пустое (строка не из одних пробелов, срез не пустой, число не 0)
+//	min=N, max=N - границы числа или длины строки и среза
+//	phone - номер телефона, который приводится к формату E.164 (utils.NormalizePhone)
+//	oneof=a b - строка пустая или одно из значений через пробел
+//	dive - проверить каждый элемент среза
+func Validate(v interface{}) error {
+	errs := Errors{}
+	validateStruct(reflect.ValueOf(v), "", errs)
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func validateStruct(value reflect.Value, prefix string, errs Errors) {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return
+	}
+
+	valueType := value.Type()
+	for i := 0; i < valueType.NumField(); i++ {
+		field := valueType.Field(i)
+		tag := field.Tag.Get("validate")
+		if tag == "" || field.PkgPath != "" {
+			continue
+		}
+		validateField(value.Field(i), prefix+jsonName(field), strings.Split(tag, ","), errs)
+	}
+}
+
+func validateField(value reflect.Value, name string, rules []string, errs Errors) {
+	for _, rule := range rules {
+		key, param := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			key, param = rule[:i], rule[i+1:]
+		}
+
+		var message string
+		switch key {
+		case "required":
+			if isEmpty(value) {
+				message = "is required"
+			}
+		case "min", "max":
+			message = checkBound(value, key, param)
+		case "phone":
+			if value.Kind() == reflect.String && value.String() != "" {
+				if _, err := utils.NormalizePhone(value.String()); err != nil {
+					message = "must be a phone number with country code"
+				}
+			}
+		case "oneof":
+			if value.Kind() == reflect.String && value.String() != "" && !contains(strings.Fields(param), value.String()) {
+				message = "must be one of: " + strings.Join(strings.Fields(param), ", ")
+			}
+		case "dive":
+			if value.Kind() == reflect.Slice {
+				for j := 0; j < value.Len(); j++ {
+					element := value.Index(j)
+					if element.Kind() == reflect.Ptr && element.IsNil() {
+						errs[fmt.Sprintf("%s[%d]", name, j)] = "is required"
+						continue
+					}
+					validateStruct(element, fmt.Sprintf("%s[%d].", name, j), errs)
+				}
+			}
+		default:
+			panic("validation: unknown rule " + rule)
+		}
+
+		// по полю показываем первую ошибку
+		if message != "" {
+			errs[name] = message
+			return
+		}
+	}
+}
+
+func checkBound(value reflect.Value, key, param string) string {
+	bound, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		panic("validation: invalid bound " + key + "=" + param)
+	}
+
+	var actual float64
+	var what string
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		actual, what = float64(value.Int()), "be"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		actual, what = float64(value.Uint()), "be"
+	case reflect.Float32, reflect.Float64:
+		actual, what = value.Float(), "be"
+	case reflect.String:
+		actual, what = float64(len([]rune(value.String()))), "have length"
+	case reflect.Slice, reflect.Map:
+		actual, what = float64(value.Len()), "have length"
+	default:
+		return ""
+	}
+
+	if key == "min" && actual < bound {
+		return fmt.Sprintf("must %s at least %s", what, param)
+	}
+	if key == "max" && actual > bound {
+		return fmt.Sprintf("must %s at most %s", what, param)
+	}
+	return ""
+}
+
+func isEmpty(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(value.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return value.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return value.IsNil()
+	default:
+		return value.IsZero()
+	}
+}
+
+func contains(items []string, item string) bool {
+	for _, candidate := range items {
+		if candidate == item {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonName возвращает имя поля в JSON
+func jsonName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
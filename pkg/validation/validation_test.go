@@ -0,0 +1,119 @@
+package validation
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type item struct {
+	Name  string  `json:"name" validate:"required,max=5"`
+	Qty   int     `json:"qty" validate:"min=1,max=10"`
+	Phone string  `json:"phone" validate:"phone"`
+	Kind  string  `json:"kind" validate:"oneof=a b"`
+	Tags  []*tag  `json:"tags" validate:"dive"`
+	Note  string  `json:"-" validate:"max=1"`
+	Skip  *string `json:"skip"`
+}
+
+type tag struct {
+	Value string `json:"value" validate:"required"`
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() *item {
+		return &item{Name: "abc", Qty: 1, Phone: "+992 900 000 123", Kind: "a", Tags: []*tag{{Value: "x"}}}
+	}
+
+	tests := []struct {
+		name   string
+		change func(*item)
+		errs   Errors
+	}{
+		{"valid", func(*item) {}, nil},
+		{"empty optional", func(v *item) { v.Phone, v.Kind, v.Tags = "", "", nil }, nil},
+		{"blank required", func(v *item) { v.Name = "  " }, Errors{"name": "is required"}},
+		{"long string", func(v *item) { v.Name = "абвгде" }, Errors{"name": "must have length at most 5"}},
+		{"runes, not bytes", func(v *item) { v.Name = "абвгд" }, nil},
+		{"below min", func(v *item) { v.Qty = 0 }, Errors{"qty": "must be at least 1"}},
+		{"above max", func(v *item) { v.Qty = 11 }, Errors{"qty": "must be at most 10"}},
+		{"phone", func(v *item) { v.Phone = "12-34" }, Errors{"phone": "must be a phone number with country code"}},
+		{"oneof", func(v *item) { v.Kind = "c" }, Errors{"kind": "must be one of: a, b"}},
+		{"dive", func(v *item) { v.Tags = []*tag{{Value: "x"}, nil, {}} },
+			Errors{"tags[1]": "is required", "tags[2].value": "is required"}},
+		{"field without json name", func(v *item) { v.Note = "ab" }, Errors{"Note": "must have length at most 1"}},
+		{"first error per field", func(v *item) { v.Name = "" }, Errors{"name": "is required"}},
+	}
+	for _, test := range tests {
+		value := valid()
+		test.change(value)
+		err := Validate(value)
+		if test.errs == nil {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", test.name, err)
+			}
+			continue
+		}
+		var errs Errors
+		if !errors.As(err, &errs) || !reflect.DeepEqual(errs, test.errs) {
+			t.Errorf("%s: errors = %v, want %v", test.name, err, test.errs)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		err  error // nil - любая ошибка, кроме Errors
+		ok   bool
+	}{
+		{"valid", `{"name":"abc","qty":2}`, nil, true},
+		{"empty", "  \n", ErrEmptyBody, false},
+		{"unknown field", `{"name":"abc","qty":2,"extra":1}`, nil, false},
+		{"trailing data", `{"name":"abc","qty":2} {}`, nil, false},
+		{"broken json", `{"name":`, nil, false},
+		{"invalid", `{"name":"","qty":2}`, Errors{"name": "is required"}, false},
+	}
+	for _, test := range tests {
+		dst := &item{}
+		err := Decode(strings.NewReader(test.body), dst)
+		switch {
+		case test.ok:
+			if err != nil || dst.Name != "abc" || dst.Qty != 2 {
+				t.Errorf("%s: %+v, %v", test.name, dst, err)
+			}
+		case test.err != nil:
+			if !reflect.DeepEqual(err, test.err) {
+				t.Errorf("%s: err = %v, want %v", test.name, err, test.err)
+			}
+		default:
+			var errs Errors
+			if err == nil || errors.As(err, &errs) {
+				t.Errorf("%s: err = %v, want decode error", test.name, err)
+			}
+		}
+	}
+}
+
+func TestDecodeLimit(t *testing.T) {
+	body := `{"name":"abc","qty":2}`
+	if err := DecodeLimit(strings.NewReader(body), &item{}, int64(len(body))); err != nil {
+		t.Fatalf("body of exactly limit: %v", err)
+	}
+	if err := DecodeLimit(strings.NewReader(body), &item{}, int64(len(body)-1)); err != ErrBodyTooLarge {
+		t.Fatalf("body over limit: %v", err)
+	}
+	large := `{"name":"` + strings.Repeat(" ", MaxBodySize) + `"}`
+	if err := Decode(strings.NewReader(large), &item{}); err != ErrBodyTooLarge {
+		t.Fatalf("body over MaxBodySize: %v", err)
+	}
+}
+
+func TestErrorsMessage(t *testing.T) {
+	errs := Errors{"qty": "must be at least 1", "name": "is required"}
+	if got := errs.Error(); got != "name: is required; qty: must be at least 1" {
+		t.Fatalf("Error() = %q", got)
+	}
+}
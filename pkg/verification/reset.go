@@ -0,0 +1,140 @@
+package verification
+
+import (
+	"context"
+	"time"
+
+	"github.com/KarrenAeris/crud/pkg/logger"
+	"github.com/KarrenAeris/crud/pkg/types"
+	"github.com/KarrenAeris/crud/pkg/utils"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+//SendResetCode отправляет код сброса пароля на телефон пользователя, прежний код перестаёт действовать.
+//Если телефон не зарегистрирован или код запрашивали недавно, ничего не отправляет и ошибку не возвращает,
+//чтобы по ответу нельзя было узнать, зарегистрирован ли номер. Каждый запрос засчитывается в ограничения
+//входа с адреса клиента, после частых запросов возвращает *lockout.Error
+func (s *Service) SendResetCode(ctx context.Context, userType, phone string) error {
+	if lockErr := s.lockoutSvc.Attempt(ctx, userType, ""); lockErr != nil {
+		return lockErr
+	}
+
+	userID, phone, err := s.userByPhone(ctx, userType, phone)
+	if err == types.ErrNotFound {
+		logger.Info(ctx, "password reset for unknown phone", "user_type", userType)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	previous, err := s.store.PasswordReset(ctx, userType, userID)
+	if err != nil && err != types.ErrNotFound {
+		return err
+	}
+	if err == nil && time.Since(previous.Created) < ResendInterval {
+		logger.Info(ctx, "password reset requested too often", "user_type", userType, "user_id", userID)
+		return nil
+	}
+
+	code, hash, err := newCode(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = s.store.SavePasswordReset(ctx, &types.PasswordReset{
+		UserType: userType,
+		UserID:   userID,
+		Phone:    phone,
+		Hash:     hash,
+		Expire:   time.Now().UTC().Add(s.ttl),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.send(ctx, phone, "Код для сброса пароля: "+code)
+}
+
+//ResetPassword меняет пароль пользователя по коду из SMS и отзывает все его токены.
+//Код действует один раз. Неизвестный телефон, неверный или истёкший код - types.ErrInvalidCode,
+//после MaxAttempts ошибок - types.ErrTooManyAttempts. Ошибки засчитываются в ограничения входа
+//по телефону и адресу клиента, после частых ошибок возвращает *lockout.Error
+func (s *Service) ResetPassword(ctx context.Context, userType, phone, code, password string) error {
+
+	// неверный номер пустой, по нему ограничивается только адрес клиента
+	normalized, _ := utils.NormalizePhone(phone)
+	if lockErr := s.lockoutSvc.Attempt(ctx, userType, normalized); lockErr != nil {
+		return lockErr
+	}
+
+	userID, phone, err := s.userByPhone(ctx, userType, phone)
+	if err == types.ErrNotFound {
+		return types.ErrInvalidCode
+	}
+	if err != nil {
+		s.lockoutSvc.Release(ctx, userType, normalized)
+		return err
+	}
+
+	// попытка засчитывается до сверки кода, поэтому параллельные запросы не получат лишних попыток
+	item, err := s.store.ClaimPasswordReset(ctx, userType, userID, MaxAttempts)
+	if err == types.ErrNotFound {
+		item, err = s.store.PasswordReset(ctx, userType, userID)
+		if err == nil && item.Attempts >= MaxAttempts {
+			return types.ErrTooManyAttempts
+		}
+		return types.ErrInvalidCode
+	}
+	if err != nil {
+		s.lockoutSvc.Release(ctx, userType, phone)
+		return err
+	}
+	// код отправлен на прежний номер, если телефон сменили после отправки
+	if item.Phone != phone {
+		return types.ErrInvalidCode
+	}
+	if !matchCode(item.Hash, code) {
+		logger.Warn(ctx, "invalid password reset code", "user_type", userType, "user_id", userID)
+		return types.ErrInvalidCode
+	}
+	s.lockoutSvc.Release(ctx, userType, phone)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		logger.Error(ctx, err)
+		return types.ErrInternal
+	}
+
+	// код удаляется вместе со сменой пароля: второй запрос с тем же кодом получит types.ErrInvalidCode
+	err = s.store.ResetPassword(ctx, userType, userID, item.Hash, string(hash))
+	if err == types.ErrNotFound {
+		return types.ErrInvalidCode
+	}
+	if err != nil {
+		return err
+	}
+
+	logger.Info(ctx, "password reset", "user_type", userType, "user_id", userID)
+	return nil
+}
+
+// userByPhone возвращает id пользователя и его телефон в формате E.164
+func (s *Service) userByPhone(ctx context.Context, userType, phone string) (int64, string, error) {
+	phone, err := utils.NormalizePhone(phone)
+	if err != nil {
+		return 0, "", types.ErrNotFound
+	}
+
+	var id int64
+	if userType == types.UserManager {
+		id, _, err = s.store.ManagerCredentials(ctx, phone)
+	} else {
+		id, _, err = s.store.CustomerCredentials(ctx, phone)
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	return id, phone, nil
+}
@@ -0,0 +1,171 @@
+package verification
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/KarrenAeris/crud/pkg/lockout"
+	"github.com/KarrenAeris/crud/pkg/logger"
+	"github.com/KarrenAeris/crud/pkg/sms"
+	"github.com/KarrenAeris/crud/pkg/store"
+	"github.com/KarrenAeris/crud/pkg/types"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	//MaxAttempts - сколько раз можно ошибиться при вводе кода, потом нужен новый код
+	MaxAttempts = 5
+
+	//ResendInterval - как часто можно запрашивать новый код
+	ResendInterval = time.Minute
+
+	codeDigits = 6
+)
+
+//Service описывает сервис одноразовых кодов из SMS: подтверждение телефона и сброс пароля.
+type Service struct {
+	store      store.Store
+	sender     sms.Sender
+	lockoutSvc *lockout.Service
+	ttl        time.Duration
+}
+
+//NewService создаёт сервис, ttl - сколько действует код. Сброс пароля ограничивается так же, как вход
+func NewService(st store.Store, sender sms.Sender, lockoutSvc *lockout.Service, ttl time.Duration) *Service {
+	return &Service{store: st, sender: sender, lockoutSvc: lockoutSvc, ttl: ttl}
+}
+
+//SendCode отправляет новый код на телефон пользователя, прежний код перестаёт действовать.
+//userType - types.UserCustomer или types.UserManager
+func (s *Service) SendCode(ctx context.Context, userType string, userID int64) error {
+
+	phone, verified, err := s.phone(ctx, userType, userID)
+	if err != nil {
+		return err
+	}
+	if verified {
+		return types.ErrPhoneVerified
+	}
+
+	previous, err := s.store.PhoneCode(ctx, userType, userID)
+	if err != nil && err != types.ErrNotFound {
+		return err
+	}
+	if err == nil && time.Since(previous.Created) < ResendInterval {
+		return types.ErrTooManyAttempts
+	}
+
+	code, hash, err := newCode(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = s.store.SavePhoneCode(ctx, &types.PhoneCode{
+		UserType: userType,
+		UserID:   userID,
+		Phone:    phone,
+		Hash:     hash,
+		Expire:   time.Now().UTC().Add(s.ttl),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.send(ctx, phone, "Код подтверждения: "+code)
+}
+
+//Verify проверяет код и отмечает телефон пользователя подтверждённым.
+//Неверный, истёкший и не запрошенный код - types.ErrInvalidCode,
+//после MaxAttempts ошибок - types.ErrTooManyAttempts
+func (s *Service) Verify(ctx context.Context, userType string, userID int64, code string) error {
+
+	// попытка засчитывается до сверки кода, поэтому параллельные запросы не получат лишних попыток
+	item, err := s.store.ClaimPhoneCode(ctx, userType, userID, MaxAttempts)
+	if err == types.ErrNotFound {
+		item, err = s.store.PhoneCode(ctx, userType, userID)
+		if err == nil && item.Attempts >= MaxAttempts {
+			return types.ErrTooManyAttempts
+		}
+		return types.ErrInvalidCode
+	}
+	if err != nil {
+		return err
+	}
+
+	if !matchCode(item.Hash, code) {
+		logger.Warn(ctx, "invalid phone code", "user_type", userType, "user_id", userID)
+		return types.ErrInvalidCode
+	}
+
+	// код отправлен на прежний номер, если телефон сменили после отправки.
+	// Код удаляется вместе с подтверждением: второй запрос с тем же кодом получит types.ErrInvalidCode
+	err = s.store.ConfirmPhone(ctx, userType, userID, item.Phone, item.Hash)
+	if err == types.ErrNotFound {
+		return types.ErrInvalidCode
+	}
+	return err
+}
+
+// phone возвращает телефон пользователя и подтверждён ли он
+func (s *Service) phone(ctx context.Context, userType string, userID int64) (string, bool, error) {
+	if userType == types.UserManager {
+		item, err := s.store.ManagerByID(ctx, userID)
+		if err != nil {
+			return "", false, err
+		}
+		return item.Phone, item.Verified, nil
+	}
+
+	item, err := s.store.CustomerByID(ctx, userID)
+	if err != nil {
+		return "", false, err
+	}
+	return item.Phone, item.Verified, nil
+}
+
+// send отправляет SMS
+func (s *Service) send(ctx context.Context, phone, text string) error {
+	if err := s.sender.Send(ctx, phone, text); err != nil {
+		logger.Error(ctx, err, "phone", phone)
+		return types.ErrInternal
+	}
+	return nil
+}
+
+// newCode возвращает новый код и его bcrypt хеш
+func newCode(ctx context.Context) (string, string, error) {
+	code, err := generateCode()
+	if err != nil {
+		logger.Error(ctx, err)
+		return "", "", types.ErrInternal
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+	if err != nil {
+		logger.Error(ctx, err)
+		return "", "", types.ErrInternal
+	}
+	return code, string(hash), nil
+}
+
+// matchCode сверяет code с bcrypt хешем сохранённого кода
+func matchCode(hash, code string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(code)) == nil
+}
+
+// generateCode возвращает случайный код из codeDigits цифр
+func generateCode() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < codeDigits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", codeDigits, n), nil
+}
@@ -0,0 +1,76 @@
+-- Телефоны в формате E.164 и их подтверждение кодом из SMS для баз, созданных до этого изменения.
+-- Скрипт в docker-entrypoint-initdb.d выполняется только на пустой базе, поэтому существующие базы
+-- обновляются этим скриптом. Повторный запуск ничего не меняет:
+--
+--   psql "$DATABASE_URL" -v ON_ERROR_STOP=1 -f sql/migrations/001_phones_e164.sql
+--
+-- После запуска проверьте phone_conflicts: эти номера не изменены, и по ним нельзя войти, пока их не исправят вручную.
+BEGIN;
+
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS phone_verified BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE managers ADD COLUMN IF NOT EXISTS phone_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- номера, которые нельзя привести к E.164 автоматически, не меняются и попадают сюда для ручного разбора:
+-- invalid - после нормализации не номер (меньше 8 или больше 15 цифр, код страны с 0), по нему не войти;
+-- duplicate - совпадает с номером другого пользователя. Номер остаётся у того, чей номер уже в E.164,
+-- иначе у пользователя с меньшим id
+CREATE TABLE IF NOT EXISTS phone_conflicts
+(
+    user_type  TEXT      NOT NULL,
+    user_id    BIGINT    NOT NULL,
+    phone      TEXT      NOT NULL,
+    normalized TEXT      NOT NULL,
+    reason     TEXT      NOT NULL,
+    created    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_type, user_id)
+);
+
+INSERT INTO phone_conflicts(user_type, user_id, phone, normalized, reason)
+SELECT 'customer', id, phone, normalized,
+       CASE WHEN normalized !~ '^\+[1-9][0-9]{7,14}$' THEN 'invalid' ELSE 'duplicate' END
+FROM (
+    SELECT id, phone, normalized,
+           row_number() OVER (PARTITION BY normalized ORDER BY phone = normalized DESC, id) AS n
+    FROM (
+        SELECT id, phone, '+' || regexp_replace(regexp_replace(phone, '[^0-9]', '', 'g'), '^00', '') AS normalized
+        FROM customers
+    ) c
+) c
+WHERE normalized !~ '^\+[1-9][0-9]{7,14}$' OR n > 1
+ON CONFLICT (user_type, user_id) DO NOTHING;
+
+INSERT INTO phone_conflicts(user_type, user_id, phone, normalized, reason)
+SELECT 'manager', id, phone, normalized,
+       CASE WHEN normalized !~ '^\+[1-9][0-9]{7,14}$' THEN 'invalid' ELSE 'duplicate' END
+FROM (
+    SELECT id, phone, normalized,
+           row_number() OVER (PARTITION BY normalized ORDER BY phone = normalized DESC, id) AS n
+    FROM (
+        SELECT id, phone, '+' || regexp_replace(regexp_replace(phone, '[^0-9]', '', 'g'), '^00', '') AS normalized
+        FROM managers
+    ) m
+) m
+WHERE normalized !~ '^\+[1-9][0-9]{7,14}$' OR n > 1
+ON CONFLICT (user_type, user_id) DO NOTHING;
+
+UPDATE customers SET phone = '+' || regexp_replace(regexp_replace(phone, '[^0-9]', '', 'g'), '^00', '')
+WHERE phone !~ '^\+[1-9][0-9]+$'
+  AND id NOT IN (SELECT user_id FROM phone_conflicts WHERE user_type = 'customer');
+UPDATE managers SET phone = '+' || regexp_replace(regexp_replace(phone, '[^0-9]', '', 'g'), '^00', '')
+WHERE phone !~ '^\+[1-9][0-9]+$'
+  AND id NOT IN (SELECT user_id FROM phone_conflicts WHERE user_type = 'manager');
+
+-- код подтверждения телефона, у пользователя не больше одного
+CREATE TABLE IF NOT EXISTS phone_codes
+(
+    user_type TEXT      NOT NULL,
+    user_id   BIGINT    NOT NULL,
+    phone     TEXT      NOT NULL,
+    code_hash TEXT      NOT NULL,
+    attempts  INTEGER   NOT NULL DEFAULT 0,
+    expire    TIMESTAMP NOT NULL,
+    created   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_type, user_id)
+);
+
+COMMIT;
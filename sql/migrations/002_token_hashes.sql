@@ -0,0 +1,40 @@
+-- Хеши токенов вместо самих токенов для баз, созданных до этого изменения.
+-- Скрипт в docker-entrypoint-initdb.d выполняется только на пустой базе, поэтому существующие базы
+-- обновляются этим скриптом. Повторный запуск ничего не меняет:
+--
+--   psql "$DATABASE_URL" -v ON_ERROR_STOP=1 -f sql/migrations/002_token_hashes.sql
+--
+-- Выданные раньше токены хранились открыто, поэтому удаляются: пользователям нужно войти заново.
+-- Сохранённые ответы на запросы с ключом идемпотентности тоже могли содержать токены и удаляются вместе с ними.
+BEGIN;
+
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_schema = current_schema() AND table_name = 'customers_tokens' AND column_name = 'token') THEN
+        DELETE FROM customers_tokens;
+        ALTER TABLE customers_tokens RENAME COLUMN token TO token_hash;
+        IF to_regclass('idempotency_keys') IS NOT NULL THEN
+            DELETE FROM idempotency_keys;
+        END IF;
+    END IF;
+
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_schema = current_schema() AND table_name = 'managers_tokens' AND column_name = 'token') THEN
+        DELETE FROM managers_tokens;
+        ALTER TABLE managers_tokens RENAME COLUMN token TO token_hash;
+        IF to_regclass('idempotency_keys') IS NOT NULL THEN
+            DELETE FROM idempotency_keys;
+        END IF;
+    END IF;
+
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'customers_tokens_hash_check') THEN
+        ALTER TABLE customers_tokens ADD CONSTRAINT customers_tokens_hash_check CHECK (token_hash ~ '^[0-9a-f]{64}$');
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'managers_tokens_hash_check') THEN
+        ALTER TABLE managers_tokens ADD CONSTRAINT managers_tokens_hash_check CHECK (token_hash ~ '^[0-9a-f]{64}$');
+    END IF;
+END
+$$;
+
+COMMIT;
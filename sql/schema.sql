@@ -31,6 +31,7 @@ CREATE TABLE customers
     name      TEXT      NOT NULL,
     phone     TEXT      NOT NULL UNIQUE,
     password  TEXT      NOT NULL,
+    phone_verified BOOLEAN NOT NULL DEFAULT FALSE,
     active    BOOLEAN   NOT NULL DEFAULT TRUE,
     created   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
@@ -56,9 +57,9 @@ CREATE TABLE sale_positions
     created     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
--- таблица токенов зарегистрированных покупателей
+-- таблица токенов зарегистрированных покупателей, хранится только SHA-256 токена
 CREATE TABLE customers_tokens (
-    token       TEXT      NOT NULL UNIQUE,
+    token_hash  TEXT      NOT NULL UNIQUE CHECK (token_hash ~ '^[0-9a-f]{64}$'),
     customer_id BIGINT    NOT NULL references customers,
     expire      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP + INTERVAL '1 hour',
     created     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP